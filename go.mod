@@ -6,4 +6,5 @@ require (
 	github.com/petar/GoMNIST v0.0.0-20150320212226-2fbe10d0fa63
 	gonum.org/v1/gonum v0.0.0-20190419091250-b869779d1d53
 	gonum.org/v1/plot v0.0.0-20190410204940-3a5f52653745
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,266 @@
+package initializer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// Initializer は、重みの初期値を作る
+// rows×colsは重みを2次元とみなしたときの形（Orthogonalで使う）
+type Initializer interface {
+	Initialize(rows, cols, fanIn, fanOut int) vec.Vector
+}
+
+// random は、複数のgoroutineから使うのでmuで守る（rand.Randは並行に使えない）
+var (
+	mu     sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Seed は、初期値の乱数を再現できるようにする
+func Seed(seed int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	random = rand.New(rand.NewSource(seed))
+}
+
+// Matrix は、Affineなどの(入力の次元, 出力の次元)の重みを作る
+func Matrix(init Initializer, rows, cols int) *num.Matrix {
+	return &num.Matrix{
+		Vector:  init.Initialize(rows, cols, rows, cols),
+		Rows:    rows,
+		Columns: cols,
+	}
+}
+
+// Tensor4D は、畳み込みの(FN, C, FH, FW)のフィルタを作る
+// fan_in = C*FH*FW, fan_out = FN*FH*FW
+func Tensor4D(init Initializer, fn, c, fh, fw int) num.Tensor4D {
+	v := init.Initialize(fn, c*fh*fw, c*fh*fw, fn*fh*fw)
+	m := &num.Matrix{Vector: v, Rows: fn, Columns: c * fh * fw}
+	return m.ReshapeTo4D(fn, c, fh, fw)
+}
+
+// Tensor3D は、Conv1Dの(FN, C, K)のフィルタを作る
+// fan_in = C*K, fan_out = FN*K
+func Tensor3D(init Initializer, fn, c, k int) num.Tensor3D {
+	v := init.Initialize(fn, c*k, c*k, fn*k)
+	t3d := make(num.Tensor3D, fn)
+	for i := range t3d {
+		t3d[i] = &num.Matrix{Vector: v[i*c*k : (i+1)*c*k], Rows: c, Columns: k}
+	}
+	return t3d
+}
+
+// Tensor5D は、Conv3Dの(FN, C, FD, FH, FW)のフィルタを作る
+// fan_in = C*FD*FH*FW, fan_out = FN*FD*FH*FW
+func Tensor5D(init Initializer, fn, c, fd, fh, fw int) num.Tensor5D {
+	k := fd * fh * fw
+	v := init.Initialize(fn, c*k, c*k, fn*k)
+	m := &num.Matrix{Vector: v, Rows: fn, Columns: c * k}
+	return m.ReshapeTo5D(fn, c, fd, fh, fw)
+}
+
+// ByName は、名前から初期化方法を選ぶ（パラメタは既定値）
+func ByName(name string) (Initializer, error) {
+	switch name {
+	case "zeros":
+		return NewConstant(0), nil
+	case "ones":
+		return NewConstant(1), nil
+	case "normal":
+		return NewNormal(0.01), nil
+	case "xavier_uniform", "glorot_uniform":
+		return NewXavierUniform(), nil
+	case "xavier_normal", "glorot_normal":
+		return NewXavierNormal(), nil
+	case "he_uniform", "kaiming_uniform":
+		return NewHeUniform(), nil
+	case "he_normal", "kaiming_normal":
+		return NewHeNormal(), nil
+	case "lecun_uniform":
+		return NewLeCunUniform(), nil
+	case "lecun_normal":
+		return NewLeCunNormal(), nil
+	case "orthogonal":
+		return NewOrthogonal(1), nil
+	}
+	return nil, fmt.Errorf("unknown initializer %q", name)
+}
+
+func normal(size int, std float64) vec.Vector {
+	mu.Lock()
+	defer mu.Unlock()
+	v := vec.Zeros(size)
+	for i := range v {
+		v[i] = random.NormFloat64() * std
+	}
+	return v
+}
+
+// uniform は、[-limit, limit)の一様分布
+func uniform(size int, limit float64) vec.Vector {
+	mu.Lock()
+	defer mu.Unlock()
+	v := vec.Zeros(size)
+	for i := range v {
+		v[i] = (2*random.Float64() - 1) * limit
+	}
+	return v
+}
+
+type Constant struct {
+	Value float64
+}
+
+func NewConstant(value float64) *Constant {
+	return &Constant{
+		Value: value,
+	}
+}
+
+func (c *Constant) Initialize(rows, cols, _, _ int) vec.Vector {
+	v := vec.Zeros(rows * cols)
+	for i := range v {
+		v[i] = c.Value
+	}
+	return v
+}
+
+// Normal は、標準偏差Stdの正規分布
+type Normal struct {
+	Std float64
+}
+
+func NewNormal(std float64) *Normal {
+	return &Normal{
+		Std: std,
+	}
+}
+
+func (n *Normal) Initialize(rows, cols, _, _ int) vec.Vector {
+	return normal(rows*cols, n.Std)
+}
+
+// XavierUniform は、[-sqrt(6/(fan_in+fan_out)), sqrt(6/(fan_in+fan_out))]の一様分布
+// http://proceedings.mlr.press/v9/glorot10a.html
+type XavierUniform struct{}
+
+func NewXavierUniform() *XavierUniform {
+	return &XavierUniform{}
+}
+
+func (x *XavierUniform) Initialize(rows, cols, fanIn, fanOut int) vec.Vector {
+	return uniform(rows*cols, math.Sqrt(6/float64(fanIn+fanOut)))
+}
+
+// XavierNormal は、標準偏差sqrt(2/(fan_in+fan_out))の正規分布
+type XavierNormal struct{}
+
+func NewXavierNormal() *XavierNormal {
+	return &XavierNormal{}
+}
+
+func (x *XavierNormal) Initialize(rows, cols, fanIn, fanOut int) vec.Vector {
+	return normal(rows*cols, math.Sqrt(2/float64(fanIn+fanOut)))
+}
+
+// HeUniform は、[-sqrt(6/fan_in), sqrt(6/fan_in)]の一様分布（ReLU向け）
+// https://arxiv.org/abs/1502.01852
+type HeUniform struct{}
+
+func NewHeUniform() *HeUniform {
+	return &HeUniform{}
+}
+
+func (h *HeUniform) Initialize(rows, cols, fanIn, _ int) vec.Vector {
+	return uniform(rows*cols, math.Sqrt(6/float64(fanIn)))
+}
+
+// HeNormal は、標準偏差sqrt(2/fan_in)の正規分布（ReLU向け）
+type HeNormal struct{}
+
+func NewHeNormal() *HeNormal {
+	return &HeNormal{}
+}
+
+func (h *HeNormal) Initialize(rows, cols, fanIn, _ int) vec.Vector {
+	return normal(rows*cols, math.Sqrt(2/float64(fanIn)))
+}
+
+// LeCunUniform は、[-sqrt(3/fan_in), sqrt(3/fan_in)]の一様分布
+type LeCunUniform struct{}
+
+func NewLeCunUniform() *LeCunUniform {
+	return &LeCunUniform{}
+}
+
+func (l *LeCunUniform) Initialize(rows, cols, fanIn, _ int) vec.Vector {
+	return uniform(rows*cols, math.Sqrt(3/float64(fanIn)))
+}
+
+// LeCunNormal は、標準偏差sqrt(1/fan_in)の正規分布（SELU向け）
+type LeCunNormal struct{}
+
+func NewLeCunNormal() *LeCunNormal {
+	return &LeCunNormal{}
+}
+
+func (l *LeCunNormal) Initialize(rows, cols, fanIn, _ int) vec.Vector {
+	return normal(rows*cols, math.Sqrt(1/float64(fanIn)))
+}
+
+// Orthogonal は、rows×colsの行列とみなしたとき行（または列）が直交するようにGainを掛けた値
+// https://arxiv.org/abs/1312.6120
+type Orthogonal struct {
+	Gain float64
+}
+
+func NewOrthogonal(gain float64) *Orthogonal {
+	return &Orthogonal{
+		Gain: gain,
+	}
+}
+
+func (o *Orthogonal) Initialize(rows, cols, _, _ int) vec.Vector {
+	// 縦長の正規乱数行列の列をグラム・シュミットで正規直交化する
+	long, short := rows, cols
+	if rows < cols {
+		long, short = cols, rows
+	}
+	q := make([]vec.Vector, short)
+	for j := range q {
+		for {
+			col := normal(long, 1)
+			for _, prev := range q[:j] {
+				dot := vec.Sum(vec.Mul(col, prev))
+				for i := range col {
+					col[i] -= dot * prev[i]
+				}
+			}
+			norm := math.Sqrt(vec.Sum(vec.Mul(col, col)))
+			if norm > 1e-8 {
+				q[j] = vec.Div(col, norm)
+				break
+			}
+		}
+	}
+
+	v := vec.Zeros(rows * cols)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if rows >= cols {
+				v[r*cols+c] = q[c][r] * o.Gain
+			} else {
+				v[r*cols+c] = q[r][c] * o.Gain
+			}
+		}
+	}
+	return v
+}
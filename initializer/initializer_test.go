@@ -0,0 +1,147 @@
+package initializer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func std(v vec.Vector) float64 {
+	mean := vec.Sum(v) / float64(len(v))
+	sq := 0.0
+	for _, e := range v {
+		sq += (e - mean) * (e - mean)
+	}
+	return math.Sqrt(sq / float64(len(v)))
+}
+
+func TestStd(t *testing.T) {
+	Seed(1)
+	// 一様分布[-a, a]の標準偏差はa/sqrt(3)
+	cases := []struct {
+		name     string
+		init     Initializer
+		expected float64
+	}{
+		{"normal", NewNormal(0.5), 0.5},
+		{"xavier_uniform", NewXavierUniform(), math.Sqrt(2.0 / (300 + 200))},
+		{"xavier_normal", NewXavierNormal(), math.Sqrt(2.0 / (300 + 200))},
+		{"he_uniform", NewHeUniform(), math.Sqrt(2.0 / 300)},
+		{"he_normal", NewHeNormal(), math.Sqrt(2.0 / 300)},
+		{"lecun_uniform", NewLeCunUniform(), math.Sqrt(1.0 / 300)},
+		{"lecun_normal", NewLeCunNormal(), math.Sqrt(1.0 / 300)},
+	}
+	for _, c := range cases {
+		w := Matrix(c.init, 300, 200)
+		if w.Rows != 300 || w.Columns != 200 {
+			fmt.Println(c.name, w.Rows, w.Columns)
+			t.Fail()
+		}
+		actual := std(w.Vector)
+		if math.Abs(actual-c.expected) > 0.02*c.expected {
+			fmt.Println(c.name, actual, c.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestConvFan(t *testing.T) {
+	Seed(1)
+	// fan_in = C*FH*FW = 16*3*3
+	w := Tensor4D(NewHeNormal(), 32, 16, 3, 3)
+	if len(w) != 32 || len(w[0]) != 16 || w[0][0].Rows != 3 || w[0][0].Columns != 3 {
+		fmt.Println(len(w), len(w[0]), w[0][0].Rows, w[0][0].Columns)
+		t.Fail()
+	}
+	actual := std(w.Flatten())
+	expected := math.Sqrt(2.0 / (16 * 3 * 3))
+	if math.Abs(actual-expected) > 0.03*expected {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+	// fan_in + fan_out = 16*3*3 + 32*3*3
+	actual = std(Tensor4D(NewXavierNormal(), 32, 16, 3, 3).Flatten())
+	expected = math.Sqrt(2.0 / (16*3*3 + 32*3*3))
+	if math.Abs(actual-expected) > 0.03*expected {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	// Conv1D・Conv3Dも、fan_in = 16*9
+	w3 := Tensor3D(NewHeNormal(), 32, 16, 9)
+	w5 := Tensor5D(NewHeNormal(), 32, 16, 1, 3, 3)
+	if len(w3) != 32 || w3[0].Rows != 16 || w3[0].Columns != 9 || len(w5) != 32 || len(w5[0]) != 16 || len(w5[0][0]) != 1 ||
+		w5[0][0][0].Rows != 3 || w5[0][0][0].Columns != 3 {
+		fmt.Println(len(w3), w3[0].Rows, w3[0].Columns, len(w5), len(w5[0]), len(w5[0][0]), w5[0][0][0].Rows, w5[0][0][0].Columns)
+		t.Fail()
+	}
+	expected = math.Sqrt(2.0 / (16 * 9))
+	for _, v := range []vec.Vector{w3.Flatten(), w5.Flatten()} {
+		if actual := std(v); math.Abs(actual-expected) > 0.03*expected {
+			fmt.Println(actual, expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestConcurrent は、goroutineから同時に初期化・Seedしても壊れないことを確かめる（go test -raceで見る）
+func TestConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Seed(int64(i))
+			if w := Matrix(NewHeUniform(), 20, 10); len(w.Vector) != 200 {
+				t.Fail()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestOrthogonal(t *testing.T) {
+	for _, shape := range [][2]int{{6, 4}, {4, 6}, {5, 5}} {
+		w := Matrix(NewOrthogonal(2), shape[0], shape[1])
+		// 短い方の辺の向きにWW^T（またはW^TW）が4I
+		var g *num.Matrix
+		if shape[0] >= shape[1] {
+			g = num.Dot(w.T(), w)
+		} else {
+			g = num.Dot(w, w.T())
+		}
+		for i := 0; i < g.Rows; i++ {
+			for j := 0; j < g.Columns; j++ {
+				expected := 0.0
+				if i == j {
+					expected = 4
+				}
+				if math.Abs(g.Element(i, j)-expected) > 1e-9 {
+					fmt.Println(shape, g)
+					t.Fail()
+				}
+			}
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	init, err := ByName("ones")
+	if err != nil {
+		t.Fail()
+	}
+	if w := Matrix(init, 2, 3); vec.Sum(w.Vector) != 6 {
+		fmt.Println(w)
+		t.Fail()
+	}
+	if _, err := ByName("kaiming_normal"); err != nil {
+		t.Fail()
+	}
+	if _, err := ByName("unknown"); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,303 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// 活性化関数の層は、*num.Matrix・Tensor3D〜Tensor6Dのどのランクでも使える
+
+// mapTensor は、xを構成する各行列にapplyを適用して同じ形のテンソルを作る
+func mapTensor(x interface{}, apply func(*num.Matrix) *num.Matrix) interface{} {
+	switch t := x.(type) {
+	case *num.Matrix:
+		return apply(t)
+	case num.Tensor3D:
+		out := make(num.Tensor3D, len(t))
+		for i, m := range t {
+			out[i] = apply(m)
+		}
+		return out
+	case num.Tensor4D:
+		out := make(num.Tensor4D, len(t))
+		for i, t3d := range t {
+			out[i] = mapTensor(t3d, apply).(num.Tensor3D)
+		}
+		return out
+	case num.Tensor5D:
+		out := make(num.Tensor5D, len(t))
+		for i, t4d := range t {
+			out[i] = mapTensor(t4d, apply).(num.Tensor4D)
+		}
+		return out
+	case num.Tensor6D:
+		out := make(num.Tensor6D, len(t))
+		for i, t5d := range t {
+			out[i] = mapTensor(t5d, apply).(num.Tensor5D)
+		}
+		return out
+	}
+	panic(x)
+}
+
+// elementwise は、xの各要素にfを適用する
+// fには要素の通し番号（平坦化したときの位置）と値を渡す
+func elementwise(x interface{}, f func(i int, v float64) float64) interface{} {
+	i := 0
+	return mapTensor(x, func(m *num.Matrix) *num.Matrix {
+		out := num.Zeros(m.Rows, m.Columns)
+		for k, v := range m.Vector {
+			out.Vector[k] = f(i, v)
+			i++
+		}
+		return out
+	})
+}
+
+// flattenTensor は、任意のランクのテンソルを平坦化する
+func flattenTensor(x interface{}) vec.Vector {
+	flat := vec.Vector{}
+	mapTensor(x, func(m *num.Matrix) *num.Matrix {
+		flat = append(flat, m.Vector...)
+		return m
+	})
+	return flat
+}
+
+// channelIndex は、通し番号からチャンネルの位置を求める関数を返す
+// 行列とTensor3Dは最後の軸、Tensor4D以上は2番目の軸をチャンネルとする
+func channelIndex(x interface{}) func(int) int {
+	switch t := x.(type) {
+	case *num.Matrix:
+		return func(i int) int { return i % t.Columns }
+	case num.Tensor3D:
+		return func(i int) int { return i % t[0].Columns }
+	case num.Tensor4D:
+		hw := t[0][0].Rows * t[0][0].Columns
+		c := len(t[0])
+		return func(i int) int { return i / hw % c }
+	case num.Tensor5D:
+		dhw := len(t[0][0]) * t[0][0][0].Rows * t[0][0][0].Columns
+		c := len(t[0])
+		return func(i int) int { return i / dhw % c }
+	case num.Tensor6D:
+		rest := len(t[0][0]) * len(t[0][0][0]) * t[0][0][0][0].Rows * t[0][0][0][0].Columns
+		c := len(t[0])
+		return func(i int) int { return i / rest % c }
+	}
+	panic(fmt.Sprintf("per-channel parameters do not support %T", x))
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+type Tanh struct {
+	Out vec.Vector
+}
+
+func NewTanh() *Tanh {
+	return &Tanh{}
+}
+
+func (ta *Tanh) Forward(x interface{}) interface{} {
+	out := elementwise(x, func(_ int, v float64) float64 {
+		return math.Tanh(v)
+	})
+	ta.Out = flattenTensor(out)
+	return out
+}
+
+func (ta *Tanh) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		return d * (1 - ta.Out[i]*ta.Out[i])
+	})
+}
+
+// LeakyReLU は、負の入力にAlphaの傾きを持たせたReLU
+type LeakyReLU struct {
+	Alpha float64
+	X     vec.Vector
+}
+
+func NewLeakyRelu(alpha float64) *LeakyReLU {
+	return &LeakyReLU{
+		Alpha: alpha,
+	}
+}
+
+func (r *LeakyReLU) Forward(x interface{}) interface{} {
+	r.X = flattenTensor(x)
+	return elementwise(x, func(_ int, v float64) float64 {
+		if v > 0 {
+			return v
+		}
+		return r.Alpha * v
+	})
+}
+
+func (r *LeakyReLU) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		if r.X[i] > 0 {
+			return d
+		}
+		return r.Alpha * d
+	})
+}
+
+// PReLU は、負の入力の傾きを学習するReLU
+// https://arxiv.org/abs/1502.01852
+type PReLU struct {
+	Alpha *num.Matrix // (1, 1)なら全チャンネル共通、(1, C)ならチャンネルごと
+	// 中間データ（backward時に使用）
+	X       vec.Vector
+	channel func(int) int
+	// パラメータの勾配
+	DAlpha *num.Matrix
+}
+
+func NewPRelu(alpha *num.Matrix) *PReLU {
+	return &PReLU{
+		Alpha: alpha,
+	}
+}
+
+func (r *PReLU) Forward(x interface{}) interface{} {
+	r.X = flattenTensor(x)
+	r.channel = func(int) int { return 0 }
+	if len(r.Alpha.Vector) > 1 {
+		r.channel = channelIndex(x)
+	}
+	return elementwise(x, func(i int, v float64) float64 {
+		if v > 0 {
+			return v
+		}
+		return r.Alpha.Vector[r.channel(i)] * v
+	})
+}
+
+func (r *PReLU) Backward(dout interface{}) interface{} {
+	r.DAlpha = num.Zeros(r.Alpha.Rows, r.Alpha.Columns)
+	return elementwise(dout, func(i int, d float64) float64 {
+		if r.X[i] > 0 {
+			return d
+		}
+		c := r.channel(i)
+		r.DAlpha.Vector[c] += d * r.X[i]
+		return r.Alpha.Vector[c] * d
+	})
+}
+
+// ELU は、負の入力で Alpha*(exp(x)-1) になる活性化関数
+// https://arxiv.org/abs/1511.07289
+type ELU struct {
+	Alpha float64
+	X     vec.Vector
+}
+
+func NewElu(alpha float64) *ELU {
+	return &ELU{
+		Alpha: alpha,
+	}
+}
+
+func (e *ELU) Forward(x interface{}) interface{} {
+	e.X = flattenTensor(x)
+	return elementwise(x, func(_ int, v float64) float64 {
+		if v > 0 {
+			return v
+		}
+		return e.Alpha * (math.Exp(v) - 1)
+	})
+}
+
+func (e *ELU) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		if e.X[i] > 0 {
+			return d
+		}
+		return d * e.Alpha * math.Exp(e.X[i])
+	})
+}
+
+// GELU は、x*Φ(x)（Φは標準正規分布の累積分布関数）
+// tanhによる近似ではなく、erfで厳密に計算する
+// https://arxiv.org/abs/1606.08415
+type GELU struct {
+	X vec.Vector
+}
+
+func NewGelu() *GELU {
+	return &GELU{}
+}
+
+func (g *GELU) Forward(x interface{}) interface{} {
+	g.X = flattenTensor(x)
+	return elementwise(x, func(_ int, v float64) float64 {
+		return v * 0.5 * (1 + math.Erf(v/math.Sqrt2))
+	})
+}
+
+func (g *GELU) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		v := g.X[i]
+		cdf := 0.5 * (1 + math.Erf(v/math.Sqrt2))
+		pdf := math.Exp(-v*v/2) / math.Sqrt(2*math.Pi)
+		return d * (cdf + v*pdf)
+	})
+}
+
+// Swish は、x*sigmoid(Beta*x)
+// Beta = 1のときはSiLUと同じ
+// https://arxiv.org/abs/1710.05941
+type Swish struct {
+	Beta float64
+	X    vec.Vector
+}
+
+func NewSwish(beta float64) *Swish {
+	return &Swish{
+		Beta: beta,
+	}
+}
+
+func (s *Swish) Forward(x interface{}) interface{} {
+	s.X = flattenTensor(x)
+	return elementwise(x, func(_ int, v float64) float64 {
+		return v * sigmoid(s.Beta*v)
+	})
+}
+
+func (s *Swish) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		v := s.X[i]
+		sig := sigmoid(s.Beta * v)
+		return d * (sig + s.Beta*v*sig*(1-sig))
+	})
+}
+
+// Softplus は、log(1+exp(x))
+type Softplus struct {
+	X vec.Vector
+}
+
+func NewSoftplus() *Softplus {
+	return &Softplus{}
+}
+
+func (s *Softplus) Forward(x interface{}) interface{} {
+	s.X = flattenTensor(x)
+	return elementwise(x, func(_ int, v float64) float64 {
+		// exp(x)のオーバーフローを避ける
+		return math.Max(v, 0) + math.Log1p(math.Exp(-math.Abs(v)))
+	})
+}
+
+func (s *Softplus) Backward(dout interface{}) interface{} {
+	return elementwise(dout, func(i int, d float64) float64 {
+		return d * sigmoid(s.X[i])
+	})
+}
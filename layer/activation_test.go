@@ -0,0 +1,114 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// avoidKink は、LeakyReLU・PReLUの0で微分できない点の近くの値をずらす（数値微分がずれるので）
+func avoidKink(x *num.Matrix) {
+	for i, v := range x.Vector {
+		if math.Abs(v) < 0.01 {
+			x.Vector[i] = math.Copysign(0.1, v)
+		}
+	}
+}
+
+func TestActivationGradient(t *testing.T) {
+	activations := map[string]func() T4DLayer{
+		"Tanh":      func() T4DLayer { return NewTanh() },
+		"LeakyReLU": func() T4DLayer { return NewLeakyRelu(0.1) },
+		"PReLU": func() T4DLayer {
+			alpha, _ := num.NewMatrix(1, 3, vec.Vector{0.1, 0.2, 0.3})
+			return NewPRelu(alpha)
+		},
+		"ELU":      func() T4DLayer { return NewElu(1.0) },
+		"GELU":     func() T4DLayer { return NewGelu() },
+		"Swish":    func() T4DLayer { return NewSwish(1.5) },
+		"Softplus": func() T4DLayer { return NewSoftplus() },
+	}
+	for name, newLayer := range activations {
+		x, _ := num.NewRandnMatrix(4, 3)
+		avoidKink(x)
+		analytic, numerical := gradientCheck(newLayer(), x, nil)
+		if !closeEnough(analytic, numerical) {
+			fmt.Println(name, analytic, numerical)
+			t.Fail()
+		}
+
+		x, _ = num.NewRandnMatrix(2, 3*2*3)
+		avoidKink(x)
+		analytic, numerical = gradientCheck(newLayer(), x, []int{2, 3, 2, 3})
+		if !closeEnough(analytic, numerical) {
+			fmt.Println(name, analytic, numerical)
+			t.Fail()
+		}
+	}
+}
+
+func TestActivationRank(t *testing.T) {
+	m, _ := num.NewMatrix(1, 3, vec.Vector{-1, 0, 2})
+	t3d := num.Tensor3D{m, m}
+	t5d := num.Tensor5D{num.Tensor4D{t3d}}
+	expected := vec.Vector{math.Tanh(-1), 0, math.Tanh(2)}
+
+	out3d := NewTanh().Forward(t3d).(num.Tensor3D)
+	out5d := NewTanh().Forward(t5d).(num.Tensor5D)
+	for _, actual := range []*num.Matrix{out3d[1], out5d[0][0][1]} {
+		if vec.NotEqual(actual.Vector, expected) || actual.Rows != 1 || actual.Columns != 3 {
+			fmt.Println(actual, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestPReLUAlphaGradient(t *testing.T) {
+	alpha, _ := num.NewMatrix(1, 2, vec.Vector{0.25, -0.5})
+	prelu := NewPRelu(alpha)
+	x, _ := num.NewRandnMatrix(3, 2*2*2)
+	shape := []int{3, 2, 2, 2}
+
+	out, outShape := toMatrix(prelu.Forward(fromMatrix(x, shape)))
+	prelu.Backward(fromMatrix(num.Mul(out, 2.0), outShape))
+	numerical := numericalGradient(func() float64 {
+		y, _ := toMatrix(prelu.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}, alpha.Vector)
+	if !closeEnough(prelu.DAlpha.Vector, numerical) {
+		fmt.Println(prelu.DAlpha, numerical)
+		t.Fail()
+	}
+}
+
+func TestPReLUTensor6D(t *testing.T) {
+	alpha, _ := num.NewMatrix(1, 2, vec.Vector{0.25, -0.5})
+	prelu := NewPRelu(alpha)
+	// (1, 2, 1, 1, 1, 2)で、2番目の軸がチャンネル
+	channel := func(v ...float64) num.Tensor4D {
+		return num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: v, Rows: 1, Columns: 2}}}
+	}
+	x := num.Tensor6D{num.Tensor5D{channel(-1, 2), channel(-2, 3)}}
+	out := prelu.Forward(x).(num.Tensor6D)
+	actual := vec.Vector{}
+	for _, t4d := range out[0] {
+		actual = append(actual, t4d[0][0].Vector...)
+	}
+	if vec.NotEqual(actual, vec.Vector{-0.25, 2, 1, 3}) {
+		fmt.Println(actual)
+		t.Fail()
+	}
+}
+
+func TestSoftplusOverflow(t *testing.T) {
+	x, _ := num.NewMatrix(1, 3, vec.Vector{-1000, 0, 1000})
+	actual := NewSoftplus().Forward(x).(*num.Matrix)
+	expected := vec.Vector{0, math.Log(2), 1000}
+	if vec.NotEqual(actual.Vector, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+}
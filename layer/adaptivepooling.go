@@ -0,0 +1,183 @@
+package layer
+
+import (
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// adaptiveRange は、出力のi番目が担当する入力の区間[start, end)
+// 区間は隣と重なることがある
+func adaptiveRange(i, in, out int) (int, int) {
+	start := i * in / out
+	end := ((i+1)*in + out - 1) / out
+	return start, end
+}
+
+// AdaptiveAveragePooling は、入力サイズによらず(OutH, OutW)に平均プーリングする
+type AdaptiveAveragePooling struct {
+	OutH int
+	OutW int
+
+	XShape []int
+}
+
+func NewAdaptiveAveragePooling(outh, outw int) *AdaptiveAveragePooling {
+	return &AdaptiveAveragePooling{
+		OutH: outh,
+		OutW: outw,
+	}
+}
+
+func (p *AdaptiveAveragePooling) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	out := num.ZerosT4D(N, C, p.OutH, p.OutW)
+	for n, t3d := range x {
+		for c, mat := range t3d {
+			for oh := 0; oh < p.OutH; oh++ {
+				hs, he := adaptiveRange(oh, H, p.OutH)
+				for ow := 0; ow < p.OutW; ow++ {
+					ws, we := adaptiveRange(ow, W, p.OutW)
+					sum := 0.0
+					for i := hs; i < he; i++ {
+						for j := ws; j < we; j++ {
+							sum += mat.Vector[i*W+j]
+						}
+					}
+					out[n][c].Vector[oh*p.OutW+ow] = sum / float64((he-hs)*(we-ws))
+				}
+			}
+		}
+	}
+	p.XShape = []int{N, C, H, W}
+	return out
+}
+
+func (p *AdaptiveAveragePooling) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	N, C, H, W := p.XShape[0], p.XShape[1], p.XShape[2], p.XShape[3]
+	dx := num.ZerosT4D(N, C, H, W)
+	for n, t3d := range dout {
+		for c, mat := range t3d {
+			for oh := 0; oh < p.OutH; oh++ {
+				hs, he := adaptiveRange(oh, H, p.OutH)
+				for ow := 0; ow < p.OutW; ow++ {
+					ws, we := adaptiveRange(ow, W, p.OutW)
+					d := mat.Vector[oh*p.OutW+ow] / float64((he-hs)*(we-ws))
+					for i := hs; i < he; i++ {
+						for j := ws; j < we; j++ {
+							dx[n][c].Vector[i*W+j] += d
+						}
+					}
+				}
+			}
+		}
+	}
+	return dx
+}
+
+// AdaptiveMaxPooling は、入力サイズによらず(OutH, OutW)に最大値プーリングする
+type AdaptiveMaxPooling struct {
+	OutH int
+	OutW int
+
+	XShape []int
+	ArgMax []int // 出力ごとの、入力の行列内でのインデックス
+}
+
+func NewAdaptiveMaxPooling(outh, outw int) *AdaptiveMaxPooling {
+	return &AdaptiveMaxPooling{
+		OutH: outh,
+		OutW: outw,
+	}
+}
+
+func (p *AdaptiveMaxPooling) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	out := num.ZerosT4D(N, C, p.OutH, p.OutW)
+	p.ArgMax = make([]int, N*C*p.OutH*p.OutW)
+	for n, t3d := range x {
+		for c, mat := range t3d {
+			for oh := 0; oh < p.OutH; oh++ {
+				hs, he := adaptiveRange(oh, H, p.OutH)
+				for ow := 0; ow < p.OutW; ow++ {
+					ws, we := adaptiveRange(ow, W, p.OutW)
+					max := math.Inf(-1)
+					argMax := 0
+					for i := hs; i < he; i++ {
+						for j := ws; j < we; j++ {
+							if v := mat.Vector[i*W+j]; v > max {
+								max = v
+								argMax = i*W + j
+							}
+						}
+					}
+					idx := oh*p.OutW + ow
+					out[n][c].Vector[idx] = max
+					p.ArgMax[((n*C+c)*p.OutH*p.OutW)+idx] = argMax
+				}
+			}
+		}
+	}
+	p.XShape = []int{N, C, H, W}
+	return out
+}
+
+func (p *AdaptiveMaxPooling) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	N, C, H, W := p.XShape[0], p.XShape[1], p.XShape[2], p.XShape[3]
+	dx := num.ZerosT4D(N, C, H, W)
+	for n, t3d := range dout {
+		for c, mat := range t3d {
+			for i, v := range mat.Vector {
+				dx[n][c].Vector[p.ArgMax[(n*C+c)*p.OutH*p.OutW+i]] += v
+			}
+		}
+	}
+	return dx
+}
+
+// GlobalAveragePooling は、チャンネルごとの平均を(N, C)の行列で返す
+// 畳み込み層の後の大きなAffineの代わりに使う
+type GlobalAveragePooling struct {
+	adaptive *AdaptiveAveragePooling
+}
+
+func NewGlobalAveragePooling() *GlobalAveragePooling {
+	return &GlobalAveragePooling{
+		adaptive: NewAdaptiveAveragePooling(1, 1),
+	}
+}
+
+func (p *GlobalAveragePooling) Forward(x interface{}) interface{} {
+	out, _ := toMatrix(p.adaptive.Forward(x))
+	return out
+}
+
+func (p *GlobalAveragePooling) Backward(dout interface{}) interface{} {
+	mat := dout.(*num.Matrix)
+	return p.adaptive.Backward(fromMatrix(mat, []int{mat.Rows, mat.Columns, 1, 1}))
+}
+
+// GlobalMaxPooling は、チャンネルごとの最大値を(N, C)の行列で返す
+type GlobalMaxPooling struct {
+	adaptive *AdaptiveMaxPooling
+}
+
+func NewGlobalMaxPooling() *GlobalMaxPooling {
+	return &GlobalMaxPooling{
+		adaptive: NewAdaptiveMaxPooling(1, 1),
+	}
+}
+
+func (p *GlobalMaxPooling) Forward(x interface{}) interface{} {
+	out, _ := toMatrix(p.adaptive.Forward(x))
+	return out
+}
+
+func (p *GlobalMaxPooling) Backward(dout interface{}) interface{} {
+	mat := dout.(*num.Matrix)
+	return p.adaptive.Backward(fromMatrix(mat, []int{mat.Rows, mat.Columns, 1, 1}))
+}
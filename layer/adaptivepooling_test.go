@@ -0,0 +1,85 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestAdaptiveAveragePooling(t *testing.T) {
+	// 割り切れる場合は通常の平均プーリングと同じ
+	t4d := SampleT4d()
+	actual := NewAdaptiveAveragePooling(2, 2).Forward(t4d).(num.Tensor4D)
+	expected := NewAveragePooling(2, 2, 2, 0).Forward(t4d).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	// 割り切れない場合は区間が重なる: 行[0,2), [1,3)、列[0,2), [1,3)
+	x := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		1, 2, 3,
+		4, 5, 6,
+		7, 8, 9,
+	}, Rows: 3, Columns: 3}}}
+	actual = NewAdaptiveAveragePooling(2, 2).Forward(x).(num.Tensor4D)
+	expected = num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		3, 4,
+		6, 7,
+	}, Rows: 2, Columns: 2}}}
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	xm, _ := num.NewRandnMatrix(2, 70)
+	dx, numerical := gradientCheck(NewAdaptiveAveragePooling(3, 2), xm, []int{2, 2, 5, 7})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+}
+
+func TestAdaptiveMaxPooling(t *testing.T) {
+	t4d := SampleT4d()
+	actual := NewAdaptiveMaxPooling(3, 3).Forward(t4d).(num.Tensor4D)
+	expected := NewPooling(2, 2, 1, 0).Forward(t4d).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	xm, _ := num.NewRandnMatrix(2, 70)
+	dx, numerical := gradientCheck(NewAdaptiveMaxPooling(2, 3), xm, []int{2, 2, 5, 7})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+}
+
+func TestGlobalPooling(t *testing.T) {
+	t4d := SampleT4d()
+	avg := NewGlobalAveragePooling().Forward(t4d).(*num.Matrix)
+	expectedAvg, _ := num.NewMatrix(1, 3, vec.Vector{67.0 / 16, 51.0 / 16, 62.0 / 16})
+	if num.NotEqual(avg, expectedAvg) {
+		fmt.Println(avg, expectedAvg)
+		t.Fail()
+	}
+	max := NewGlobalMaxPooling().Forward(t4d).(*num.Matrix)
+	expectedMax, _ := num.NewMatrix(1, 3, vec.Vector{9, 8, 9})
+	if num.NotEqual(max, expectedMax) {
+		fmt.Println(max, expectedMax)
+		t.Fail()
+	}
+
+	for _, pool := range []T4DLayer{NewGlobalAveragePooling(), NewGlobalMaxPooling()} {
+		x, _ := num.NewRandnMatrix(2, 36)
+		dx, numerical := gradientCheck(pool, x, []int{2, 4, 3, 3})
+		if !closeEnough(dx, numerical) {
+			fmt.Println(dx, numerical)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// ScaledDotProductAttention は、softmax(Q*K^T/sqrt(d))*V
+// Q, K, Vは(N, T, d)のTensor3D
+// https://arxiv.org/abs/1706.03762
+type ScaledDotProductAttention struct {
+	// (N, Tq, Tk)または(1, Tq, Tk)。0の位置には注意を向けない（nilなら全て見る）
+	Mask num.Tensor3D
+	// 中間データ（backward時に使用）
+	Q         num.Tensor3D
+	K         num.Tensor3D
+	V         num.Tensor3D
+	Attention num.Tensor3D // softmaxの出力 (N, Tq, Tk)
+}
+
+func NewScaledDotProductAttention(mask num.Tensor3D) *ScaledDotProductAttention {
+	return &ScaledDotProductAttention{
+		Mask: mask,
+	}
+}
+
+// CausalMask は、自分より後の時刻を見ないようにするマスク
+func CausalMask(t int) num.Tensor3D {
+	mask := num.Zeros(t, t)
+	for i := 0; i < t; i++ {
+		for j := 0; j <= i; j++ {
+			mask.Assign(1, i, j)
+		}
+	}
+	return num.Tensor3D{mask}
+}
+
+// softmaxRows は、行ごとのsoftmax（全ての値が負でもあふれないようにする）
+func softmaxRows(m *num.Matrix) *num.Matrix {
+	out := num.Zeros(m.Rows, m.Columns)
+	for i := 0; i < m.Rows; i++ {
+		row := m.SliceRow(i)
+		lse := logSumExp(row)
+		for j, v := range row {
+			out.Vector[i*m.Columns+j] = math.Exp(v - lse)
+		}
+	}
+	return out
+}
+
+func (a *ScaledDotProductAttention) Forward(q, k, v num.Tensor3D) num.Tensor3D {
+	scale := 1 / math.Sqrt(float64(q[0].Columns))
+	a.Attention = make(num.Tensor3D, len(q))
+	out := make(num.Tensor3D, len(q))
+	for n := range q {
+		score := num.Mul(num.Dot(q[n], k[n].T()), scale)
+		if a.Mask != nil {
+			mask := a.Mask[n%len(a.Mask)]
+			for i, m := range mask.Vector {
+				if m == 0 {
+					// -Infにすると全てマスクした行がNaNになるので、十分小さい値にする
+					score.Vector[i] = -1e9
+				}
+			}
+		}
+		a.Attention[n] = softmaxRows(score)
+		out[n] = num.Dot(a.Attention[n], v[n])
+	}
+	a.Q, a.K, a.V = q, k, v
+	return out
+}
+
+// Backward は、Q, K, Vの勾配を返す
+func (a *ScaledDotProductAttention) Backward(dout num.Tensor3D) (num.Tensor3D, num.Tensor3D, num.Tensor3D) {
+	scale := 1 / math.Sqrt(float64(a.Q[0].Columns))
+	dq := make(num.Tensor3D, len(dout))
+	dk := make(num.Tensor3D, len(dout))
+	dv := make(num.Tensor3D, len(dout))
+	for n, d := range dout {
+		attn := a.Attention[n]
+		dv[n] = num.Dot(attn.T(), d)
+		dattn := num.Dot(d, a.V[n].T())
+		// softmaxの逆伝搬: attn * (dattn - sum(dattn*attn))
+		dscore := num.Zeros(attn.Rows, attn.Columns)
+		for i := 0; i < attn.Rows; i++ {
+			dot := vec.Sum(vec.Mul(dattn.SliceRow(i), attn.SliceRow(i)))
+			for j, p := range attn.SliceRow(i) {
+				dscore.Vector[i*attn.Columns+j] = p * (dattn.Vector[i*attn.Columns+j] - dot) * scale
+			}
+		}
+		dq[n] = num.Dot(dscore, a.K[n])
+		dk[n] = num.Dot(dscore.T(), a.Q[n])
+	}
+	return dq, dk, dv
+}
+
+// MultiHeadAttention は、Headsに分けたScaledDotProductAttention（自己注意）
+// 入力・出力は(N, T, D)のTensor3Dで、重みは全て(D, D)、バイアスは(1, D)
+type MultiHeadAttention struct {
+	Heads int
+	Wq    *num.Matrix
+	Bq    *num.Matrix
+	Wk    *num.Matrix
+	Bk    *num.Matrix
+	Wv    *num.Matrix
+	Bv    *num.Matrix
+	Wo    *num.Matrix
+	Bo    *num.Matrix
+	// ScaledDotProductAttentionのMask
+	Mask num.Tensor3D
+	// 中間データ（backward時に使用）
+	X          *num.Matrix // (N*T, D)
+	Concat     *num.Matrix // 各ヘッドの出力を並べたもの (N*T, D)
+	Attentions []*ScaledDotProductAttention
+	N          int
+	// 重み・バイアスパラメータの勾配
+	DWq *num.Matrix
+	DBq *num.Matrix
+	DWk *num.Matrix
+	DBk *num.Matrix
+	DWv *num.Matrix
+	DBv *num.Matrix
+	DWo *num.Matrix
+	DBo *num.Matrix
+}
+
+func NewMultiHeadAttention(heads int, wq, bq, wk, bk, wv, bv, wo, bo *num.Matrix) *MultiHeadAttention {
+	if wq.Columns%heads != 0 {
+		panic(fmt.Sprintf("dimension %d is not divisible by heads %d", wq.Columns, heads))
+	}
+	return &MultiHeadAttention{
+		Heads: heads,
+		Wq:    wq,
+		Bq:    bq,
+		Wk:    wk,
+		Bk:    bk,
+		Wv:    wv,
+		Bv:    bv,
+		Wo:    wo,
+		Bo:    bo,
+	}
+}
+
+// head は、(N*T, D)の行列からh番目のヘッドを(N, T, D/Heads)で取り出す
+func (mh *MultiHeadAttention) head(m *num.Matrix, h int) num.Tensor3D {
+	dk := m.Columns / mh.Heads
+	return matToT3D(sliceCols(m, h*dk, (h+1)*dk), mh.N)
+}
+
+func (mh *MultiHeadAttention) Forward(ix interface{}) interface{} {
+	xs := ix.(num.Tensor3D)
+	mh.N = len(xs)
+	mh.X = t3dToMat(xs)
+	q := num.Add(num.Dot(mh.X, mh.Wq), mh.Bq)
+	k := num.Add(num.Dot(mh.X, mh.Wk), mh.Bk)
+	v := num.Add(num.Dot(mh.X, mh.Wv), mh.Bv)
+
+	mh.Attentions = make([]*ScaledDotProductAttention, mh.Heads)
+	heads := make([]*num.Matrix, mh.Heads)
+	for h := range heads {
+		mh.Attentions[h] = NewScaledDotProductAttention(mh.Mask)
+		out := mh.Attentions[h].Forward(mh.head(q, h), mh.head(k, h), mh.head(v, h))
+		heads[h] = t3dToMat(out)
+	}
+	mh.Concat = hstack(heads...)
+	return matToT3D(num.Add(num.Dot(mh.Concat, mh.Wo), mh.Bo), mh.N)
+}
+
+func (mh *MultiHeadAttention) Backward(idout interface{}) interface{} {
+	dout := t3dToMat(idout.(num.Tensor3D))
+	mh.DWo = num.Dot(mh.Concat.T(), dout)
+	mh.DBo = num.Sum(dout, 0)
+	dconcat := num.Dot(dout, mh.Wo.T())
+
+	dqs := make([]*num.Matrix, mh.Heads)
+	dks := make([]*num.Matrix, mh.Heads)
+	dvs := make([]*num.Matrix, mh.Heads)
+	for h := range dqs {
+		dq, dk, dv := mh.Attentions[h].Backward(mh.head(dconcat, h))
+		dqs[h], dks[h], dvs[h] = t3dToMat(dq), t3dToMat(dk), t3dToMat(dv)
+	}
+	dq, dk, dv := hstack(dqs...), hstack(dks...), hstack(dvs...)
+
+	mh.DWq, mh.DBq = num.Dot(mh.X.T(), dq), num.Sum(dq, 0)
+	mh.DWk, mh.DBk = num.Dot(mh.X.T(), dk), num.Sum(dk, 0)
+	mh.DWv, mh.DBv = num.Dot(mh.X.T(), dv), num.Sum(dv, 0)
+	dx := num.Add(num.Add(num.Dot(dq, mh.Wq.T()), num.Dot(dk, mh.Wk.T())), num.Dot(dv, mh.Wv.T()))
+	return matToT3D(dx, mh.N)
+}
+
+// PositionalEncoding は、(N, T, D)の入力に正弦波の位置エンコーディングを足す
+// PE(t, 2i) = sin(t/10000^(2i/D)), PE(t, 2i+1) = cos(t/10000^(2i/D))
+type PositionalEncoding struct{}
+
+func NewPositionalEncoding() *PositionalEncoding {
+	return &PositionalEncoding{}
+}
+
+func (pe *PositionalEncoding) Forward(ix interface{}) interface{} {
+	xs := ix.(num.Tensor3D)
+	T, D := xs[0].Rows, xs[0].Columns
+	out := make(num.Tensor3D, len(xs))
+	for n, x := range xs {
+		out[n] = num.Zeros(T, D)
+		for t := 0; t < T; t++ {
+			for i := 0; i < D; i++ {
+				angle := float64(t) / math.Pow(10000, float64(i/2*2)/float64(D))
+				p := math.Sin(angle)
+				if i%2 == 1 {
+					p = math.Cos(angle)
+				}
+				out[n].Vector[t*D+i] = x.Vector[t*D+i] + p
+			}
+		}
+	}
+	return out
+}
+
+func (pe *PositionalEncoding) Backward(dout interface{}) interface{} {
+	return dout
+}
+
+// TransformerEncoder は、Transformerのエンコーダ1ブロック
+// LayerNormを先に行う（Pre-LN）構成
+//
+//	h = x + Dropout(MultiHeadAttention(LayerNorm(x)))
+//	y = h + Dropout(Affine(GELU(Affine(LayerNorm(h)))))
+//
+// https://arxiv.org/abs/2002.04745
+type TransformerEncoder struct {
+	Attention *MultiHeadAttention
+	Norm1     *LayerNormalization
+	Norm2     *LayerNormalization
+	FFN1      *Affine
+	Act       *GELU
+	FFN2      *Affine
+	Dropout1  *Dropout
+	Dropout2  *Dropout
+	// trueなら学習時としてDropoutを使う
+	TrainFlg bool
+	// 中間データ（backward時に使用）
+	N int
+}
+
+// NewTransformerEncoder のw1は(D, 中間層の次元)、w2は(中間層の次元, D)
+func NewTransformerEncoder(attention *MultiHeadAttention, w1, b1, w2, b2 *num.Matrix, dropoutRatio float64) *TransformerEncoder {
+	D := w1.Rows
+	return &TransformerEncoder{
+		Attention: attention,
+		Norm1:     NewLayerNormalization(num.Add(num.Zeros(1, D), 1.0), num.Zeros(1, D)),
+		Norm2:     NewLayerNormalization(num.Add(num.Zeros(1, D), 1.0), num.Zeros(1, D)),
+		FFN1:      NewAffine(w1, b1),
+		Act:       NewGelu(),
+		FFN2:      NewAffine(w2, b2),
+		Dropout1:  NewDropout(dropoutRatio),
+		Dropout2:  NewDropout(dropoutRatio),
+	}
+}
+
+func (te *TransformerEncoder) Forward(ix interface{}) interface{} {
+	xs := ix.(num.Tensor3D)
+	te.N = len(xs)
+	x := t3dToMat(xs)
+
+	// LayerNormは時刻ごと（(N*T, D)の行ごと）に行う
+	a := te.Norm1.Forward(x).(*num.Matrix)
+	a = t3dToMat(te.Attention.Forward(matToT3D(a, te.N)).(num.Tensor3D))
+	h := num.Add(x, te.Dropout1.Forward(a, te.TrainFlg))
+
+	f := te.Norm2.Forward(h).(*num.Matrix)
+	f = te.FFN1.Forward(f, te.TrainFlg)
+	f = te.Act.Forward(f).(*num.Matrix)
+	f = te.FFN2.Forward(f, te.TrainFlg)
+	y := num.Add(h, te.Dropout2.Forward(f, te.TrainFlg))
+	return matToT3D(y, te.N)
+}
+
+func (te *TransformerEncoder) Backward(idout interface{}) interface{} {
+	dy := t3dToMat(idout.(num.Tensor3D))
+
+	df := te.Dropout2.Backward(dy)
+	df = te.FFN2.Backward(df)
+	df = te.Act.Backward(df).(*num.Matrix)
+	df = te.FFN1.Backward(df)
+	dh := num.Add(dy, te.Norm2.Backward(df).(*num.Matrix))
+
+	da := te.Dropout1.Backward(dh)
+	da = t3dToMat(te.Attention.Backward(matToT3D(da, te.N)).(num.Tensor3D))
+	dx := num.Add(dh, te.Norm1.Backward(da).(*num.Matrix))
+	return matToT3D(dx, te.N)
+}
+
+// Patches は、(N, C, H, W)の画像をSize×Sizeのパッチに分けて
+// (N, パッチ数, C*Size*Size)の系列にする（Vision Transformerの入力）
+// https://arxiv.org/abs/2010.11929
+type Patches struct {
+	Size int
+	// 中間データ（backward時に使用）
+	XShape []int
+	Window *num.Conv2DParams
+}
+
+func NewPatches(size int) *Patches {
+	return &Patches{
+		Size: size,
+	}
+}
+
+func (p *Patches) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	p.XShape = []int{len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns}
+	p.Window = &num.Conv2DParams{
+		FH:        p.Size,
+		FW:        p.Size,
+		StrideH:   p.Size,
+		StrideW:   p.Size,
+		DilationH: 1,
+		DilationW: 1,
+	}
+	return matToT3D(x.Im2ColWithParams(p.Window), len(x))
+}
+
+func (p *Patches) Backward(dout interface{}) interface{} {
+	return t3dToMat(dout.(num.Tensor3D)).Col2ImgWithParams(p.XShape, p.Window)
+}
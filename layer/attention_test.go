@@ -0,0 +1,135 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func randnT3D(n, t, d int) num.Tensor3D {
+	x, _ := num.NewRandnMatrix(n, t*d)
+	return fromMatrix(x, []int{n, t, d}).(num.Tensor3D)
+}
+
+func TestScaledDotProductAttentionGradient(t *testing.T) {
+	q, k, v := randnT3D(2, 3, 4), randnT3D(2, 5, 4), randnT3D(2, 5, 2)
+	mask := num.Zeros(3, 5)
+	for i := range mask.Vector {
+		if i%4 != 1 {
+			mask.Vector[i] = 1
+		}
+	}
+	attn := NewScaledDotProductAttention(num.Tensor3D{mask})
+	w := randnT3D(2, 3, 2)
+	loss := func() float64 {
+		out, _ := toMatrix(attn.Forward(q, k, v))
+		weight, _ := toMatrix(w)
+		return vec.Sum(vec.Mul(out.Vector, weight.Vector))
+	}
+	loss()
+	dq, dk, dv := attn.Backward(w)
+	for i, c := range []struct {
+		x, dx num.Tensor3D
+	}{{q, dq}, {k, dk}, {v, dv}} {
+		for n := range c.x {
+			numerical := numericalGradient(loss, c.x[n].Vector)
+			if !closeEnough(c.dx[n].Vector, numerical) {
+				fmt.Println(i, c.dx[n], numerical)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestCausalMask(t *testing.T) {
+	x := randnT3D(1, 4, 3)
+	attn := NewScaledDotProductAttention(CausalMask(4))
+	out := attn.Forward(x, x, x)
+	// 最初の時刻は自分自身しか見られない
+	if !closeEnough(out[0].SliceRow(0), x[0].SliceRow(0)) {
+		fmt.Println(out[0], x[0])
+		t.Fail()
+	}
+	for i := 0; i < 4; i++ {
+		for j := i + 1; j < 4; j++ {
+			if attn.Attention[0].Element(i, j) != 0 {
+				fmt.Println(attn.Attention[0])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func newMultiHeadAttention(heads, d int) *MultiHeadAttention {
+	return NewMultiHeadAttention(heads,
+		mustRandn(d, d), mustRandn(1, d),
+		mustRandn(d, d), mustRandn(1, d),
+		mustRandn(d, d), mustRandn(1, d),
+		mustRandn(d, d), mustRandn(1, d))
+}
+
+func TestMultiHeadAttentionGradient(t *testing.T) {
+	mh := newMultiHeadAttention(2, 4)
+	mh.Mask = CausalMask(3)
+	checkRecurrent(t, "MultiHeadAttention", mh,
+		[]*num.Matrix{mh.Wq, mh.Bq, mh.Wk, mh.Wv, mh.Wo, mh.Bo},
+		func() []*num.Matrix {
+			return []*num.Matrix{mh.DWq, mh.DBq, mh.DWk, mh.DWv, mh.DWo, mh.DBo}
+		})
+}
+
+func TestTransformerEncoderGradient(t *testing.T) {
+	D, F := 4, 6
+	encoder := NewTransformerEncoder(newMultiHeadAttention(2, D), mustRandn(D, F), mustRandn(1, F), mustRandn(F, D), mustRandn(1, D), 0.0)
+	checkRecurrent(t, "TransformerEncoder", encoder,
+		[]*num.Matrix{encoder.Attention.Wq, encoder.FFN1.W, encoder.FFN2.B, encoder.Norm1.Gamma},
+		func() []*num.Matrix {
+			return []*num.Matrix{encoder.Attention.DWq, encoder.FFN1.DW, encoder.FFN2.DB, encoder.Norm1.Dgamma}
+		})
+}
+
+func TestPositionalEncoding(t *testing.T) {
+	x := zerosT3D(2, 3, 4)
+	out := NewPositionalEncoding().Forward(x).(num.Tensor3D)
+	expected := vec.Vector{
+		0, 1, 0, 1,
+		math.Sin(1), math.Cos(1), math.Sin(0.01), math.Cos(0.01),
+		math.Sin(2), math.Cos(2), math.Sin(0.02), math.Cos(0.02),
+	}
+	for _, m := range out {
+		if !closeEnough(m.Vector, expected) {
+			fmt.Println(m, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestPatches(t *testing.T) {
+	x := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+		13, 14, 15, 16,
+	}, Rows: 4, Columns: 4}}}
+	out := NewPatches(2).Forward(x).(num.Tensor3D)
+	expected, _ := num.NewMatrix(4, 4, vec.Vector{
+		1, 2, 5, 6,
+		3, 4, 7, 8,
+		9, 10, 13, 14,
+		11, 12, 15, 16,
+	})
+	if len(out) != 1 || num.NotEqual(out[0], expected) {
+		fmt.Println(out, expected)
+		t.Fail()
+	}
+
+	x2, _ := num.NewRandnMatrix(2, 2*4*6)
+	analytic, numerical := gradientCheck(NewPatches(2), x2, []int{2, 2, 4, 6})
+	if !closeEnough(analytic, numerical) {
+		fmt.Println(analytic, numerical)
+		t.Fail()
+	}
+}
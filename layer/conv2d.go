@@ -0,0 +1,209 @@
+package layer
+
+import (
+	"fmt"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// Conv2DParams は、Conv2Dのハイパーパラメタ
+// ゼロ値のStride, Dilation, Groupsは1として扱う
+type Conv2DParams struct {
+	StrideH   int
+	StrideW   int
+	PadTop    int
+	PadBottom int
+	PadLeft   int
+	PadRight  int
+	DilationH int
+	DilationW int
+	Groups    int
+	// trueなら出力サイズがceil(入力/Stride)になるようにPadを決める
+	SamePadding bool
+	// ゼロ以外のパディング（ゼロ値ならゼロパディング）
+	PadMode  num.PadMode
+	PadValue float64
+}
+
+func (p *Conv2DParams) groups() int {
+	if p.Groups == 0 {
+		return 1
+	}
+	return p.Groups
+}
+
+// window は、フィルタと入力のサイズからim2colの設定を作る
+func (p *Conv2DParams) window(fh, fw, h, w int) *num.Conv2DParams {
+	win := &num.Conv2DParams{
+		FH:        fh,
+		FW:        fw,
+		StrideH:   atLeastOne(p.StrideH),
+		StrideW:   atLeastOne(p.StrideW),
+		PadTop:    p.PadTop,
+		PadBottom: p.PadBottom,
+		PadLeft:   p.PadLeft,
+		PadRight:  p.PadRight,
+		DilationH: atLeastOne(p.DilationH),
+		DilationW: atLeastOne(p.DilationW),
+	}
+	if p.SamePadding {
+		win.PadTop, win.PadBottom = samePadding(h, fh, win.StrideH, win.DilationH)
+		win.PadLeft, win.PadRight = samePadding(w, fw, win.StrideW, win.DilationW)
+	}
+	return win
+}
+
+func atLeastOne(v int) int {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+// samePadding は、TensorFlowの"SAME"と同じく余りを後ろ側に多く割り当てる
+func samePadding(size, filter, stride, dilation int) (int, int) {
+	out := (size + stride - 1) / stride
+	total := (out-1)*stride + dilation*(filter-1) + 1 - size
+	if total < 0 {
+		total = 0
+	}
+	return total / 2, total - total/2
+}
+
+// Conv2D は、dilation・グループ畳み込み・非対称パディングに対応した畳み込み層
+type Conv2D struct {
+	W num.Tensor4D // (FN, C/Groups, FH, FW)
+	B *num.Matrix  // (1, FN)
+	Conv2DParams
+	// 中間データ（backward時に使用）
+	XShape  []int         // パディング済み
+	Cols    []*num.Matrix // グループごと
+	ColWs   []*num.Matrix // グループごと
+	Window  *num.Conv2DParams
+	Padding *num.Padding
+	// 重み・バイアスパラメータの勾配
+	DW num.Tensor4D
+	DB *num.Matrix
+}
+
+func NewConv2D(w num.Tensor4D, b *num.Matrix, p *Conv2DParams) *Conv2D {
+	conv := &Conv2D{
+		W: w,
+		B: b,
+	}
+	if p != nil {
+		conv.Conv2DParams = *p
+	}
+	if len(w)%conv.groups() != 0 {
+		panic(fmt.Sprintf("filters %d is not divisible by groups %d", len(w), conv.groups()))
+	}
+	return conv
+}
+
+func (c *Conv2D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	FN, Cg, FH, FW := len(c.W), len(c.W[0]), c.W[0][0].Rows, c.W[0][0].Columns
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	groups := c.groups()
+	if C != Cg*groups {
+		panic(fmt.Sprintf("input channels %d does not match %d groups of %d", C, groups, Cg))
+	}
+	win := c.window(FH, FW, H, W)
+	c.Padding = modePadding(win.PadTop, win.PadBottom, win.PadLeft, win.PadRight, c.PadMode, c.PadValue)
+	if c.Padding != nil {
+		x = x.PadWith(c.Padding)
+		H, W = x[0][0].Rows, x[0][0].Columns
+		win.PadTop, win.PadBottom, win.PadLeft, win.PadRight = 0, 0, 0, 0
+	}
+	outH, outW := win.OutputSize(H, W)
+
+	fg := FN / groups
+	out := num.Zeros(N*outH*outW, FN)
+	c.Cols = make([]*num.Matrix, groups)
+	c.ColWs = make([]*num.Matrix, groups)
+	for g := 0; g < groups; g++ {
+		col := sliceChannels(x, g*Cg, (g+1)*Cg).Im2ColWithParams(win)
+		colW := (&num.Matrix{
+			Vector:  c.W[g*fg : (g+1)*fg].Flatten(),
+			Rows:    fg,
+			Columns: Cg * FH * FW,
+		}).T()
+		dot := num.Dot(col, colW)
+		for i := 0; i < dot.Rows; i++ {
+			copy(out.Vector[i*FN+g*fg:i*FN+(g+1)*fg], dot.SliceRow(i))
+		}
+		c.Cols[g] = col
+		c.ColWs[g] = colW
+	}
+	out = num.Add(out, c.B)
+
+	c.XShape = []int{N, C, H, W}
+	c.Window = win
+	return matToNCHW(out, N, outH, outW)
+}
+
+func (c *Conv2D) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	FN, Cg, FH, FW := len(c.W), len(c.W[0]), c.W[0][0].Rows, c.W[0][0].Columns
+	N, C, H, W := c.XShape[0], c.XShape[1], c.XShape[2], c.XShape[3]
+	groups := c.groups()
+	fg := FN / groups
+
+	doutMat := nchwToMat(dout)
+	c.DB = num.Sum(doutMat, 0)
+	c.DW = make(num.Tensor4D, 0, FN)
+	dx := make(num.Tensor4D, N)
+	for n := range dx {
+		dx[n] = make(num.Tensor3D, 0, C)
+	}
+	for g := 0; g < groups; g++ {
+		doutG := num.Zeros(doutMat.Rows, fg)
+		for i := 0; i < doutMat.Rows; i++ {
+			copy(doutG.SliceRow(i), doutMat.Vector[i*FN+g*fg:i*FN+(g+1)*fg])
+		}
+		dw := num.Dot(c.Cols[g].T(), doutG)
+		c.DW = append(c.DW, dw.T().ReshapeTo4D(fg, Cg, FH, FW)...)
+
+		dcol := num.Dot(doutG, c.ColWs[g].T())
+		dxg := dcol.Col2ImgWithParams([]int{N, Cg, H, W}, c.Window)
+		for n := range dx {
+			dx[n] = append(dx[n], dxg[n]...)
+		}
+	}
+	if c.Padding != nil {
+		dx = dx.UnpadWith(c.Padding)
+	}
+	return dx
+}
+
+// DepthwiseSeparableConv2D は、チャンネルごとの畳み込み(depthwise)と
+// 1x1の畳み込み(pointwise)を続けて行うブロック
+// https://arxiv.org/abs/1704.04861
+type DepthwiseSeparableConv2D struct {
+	Depthwise *Conv2D
+	Pointwise *Conv2D
+}
+
+// NewDepthwiseSeparableConv2D のdwは(C*K, 1, FH, FW)、pwは(FN, C*K, 1, 1)
+// pのGroupsを省略した場合はK = 1とみなしてGroups = len(dw)にする
+func NewDepthwiseSeparableConv2D(dw num.Tensor4D, db *num.Matrix, pw num.Tensor4D, pb *num.Matrix, p *Conv2DParams) *DepthwiseSeparableConv2D {
+	depthwise := Conv2DParams{}
+	if p != nil {
+		depthwise = *p
+	}
+	if depthwise.Groups == 0 {
+		depthwise.Groups = len(dw)
+	}
+	return &DepthwiseSeparableConv2D{
+		Depthwise: NewConv2D(dw, db, &depthwise),
+		Pointwise: NewConv2D(pw, pb, nil),
+	}
+}
+
+func (d *DepthwiseSeparableConv2D) Forward(x interface{}) interface{} {
+	return d.Pointwise.Forward(d.Depthwise.Forward(x))
+}
+
+func (d *DepthwiseSeparableConv2D) Backward(dout interface{}) interface{} {
+	return d.Depthwise.Backward(d.Pointwise.Backward(dout))
+}
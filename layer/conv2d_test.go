@@ -0,0 +1,127 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestConv2DMatchesConvolution(t *testing.T) {
+	w, _ := num.NewRandnT4D(4, 3, 3, 3)
+	b, _ := num.NewRandnMatrix(1, 4)
+	x, _ := num.NewRandnT4D(2, 3, 5, 5)
+
+	conv := NewConvolution(w, b, 2, 1)
+	conv2d := NewConv2D(w, b, &Conv2DParams{
+		StrideH: 2, StrideW: 2,
+		PadTop: 1, PadBottom: 1, PadLeft: 1, PadRight: 1,
+	})
+	expected := conv.Forward(x).(num.Tensor4D)
+	actual := conv2d.Forward(x).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	dout, _ := num.NewRandnT4D(2, 4, 3, 3)
+	expectedDx := conv.Backward(dout).(num.Tensor4D)
+	actualDx := conv2d.Backward(dout).(num.Tensor4D)
+	if !num.EqualT4D(actualDx, expectedDx) {
+		fmt.Println(actualDx, expectedDx)
+		t.Fail()
+	}
+	if !num.EqualT4D(conv2d.DW, conv.DW) || num.NotEqual(conv2d.DB, conv.DB) {
+		fmt.Println(conv2d.DW, conv.DW)
+		t.Fail()
+	}
+}
+
+// checkConv2D は、入力とフィルタの勾配を数値微分と比較する
+func checkConv2D(t *testing.T, conv T4DLayer, w num.Tensor4D, dw func() num.Tensor4D, n, c, h, wd int) {
+	x, _ := num.NewRandnMatrix(n, c*h*wd)
+	shape := []int{n, c, h, wd}
+	dx, numerical := gradientCheck(conv, x, shape)
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+
+	out, outShape := toMatrix(conv.Forward(fromMatrix(x, shape)))
+	loss := func() float64 {
+		y, _ := toMatrix(conv.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}
+	numericalW := vec.Vector{}
+	for _, t3d := range w {
+		for _, mat := range t3d {
+			numericalW = append(numericalW, numericalGradient(loss, mat.Vector)...)
+		}
+	}
+	conv.Forward(fromMatrix(x, shape))
+	conv.Backward(fromMatrix(num.Mul(out, 2.0), outShape))
+	if !closeEnough(dw().Flatten(), numericalW) {
+		fmt.Println(dw(), numericalW)
+		t.Fail()
+	}
+}
+
+func TestConv2DGradient(t *testing.T) {
+	cases := []struct {
+		shape  []int // 入力 (N, C, H, W)
+		filter []int // (FN, C/Groups, FH, FW)
+		params *Conv2DParams
+	}{
+		// 非正方形のフィルタ・ストライド、非対称パディング、dilation
+		{[]int{2, 2, 6, 7}, []int{3, 2, 2, 3}, &Conv2DParams{
+			StrideH: 2, StrideW: 1,
+			PadTop: 1, PadBottom: 0, PadLeft: 2, PadRight: 1,
+			DilationH: 2, DilationW: 1,
+		}},
+		// グループ畳み込み
+		{[]int{2, 4, 5, 5}, []int{6, 2, 3, 3}, &Conv2DParams{Groups: 2}},
+		// "same"パディング
+		{[]int{1, 3, 7, 6}, []int{2, 3, 3, 2}, &Conv2DParams{StrideH: 2, StrideW: 2, SamePadding: true}},
+	}
+	for _, tc := range cases {
+		w, _ := num.NewRandnT4D(tc.filter[0], tc.filter[1], tc.filter[2], tc.filter[3])
+		b, _ := num.NewRandnMatrix(1, tc.filter[0])
+		conv := NewConv2D(w, b, tc.params)
+		checkConv2D(t, conv, w, func() num.Tensor4D { return conv.DW }, tc.shape[0], tc.shape[1], tc.shape[2], tc.shape[3])
+	}
+}
+
+func TestConv2DSamePadding(t *testing.T) {
+	w, _ := num.NewRandnT4D(2, 1, 3, 3)
+	b := num.Zeros(1, 2)
+	x, _ := num.NewRandnT4D(1, 1, 7, 5)
+
+	same := NewConv2D(w, b, &Conv2DParams{SamePadding: true}).Forward(x).(num.Tensor4D)
+	if same[0][0].Rows != 7 || same[0][0].Columns != 5 {
+		fmt.Println(same[0][0].Rows, same[0][0].Columns)
+		t.Fail()
+	}
+	strided := NewConv2D(w, b, &Conv2DParams{StrideH: 2, StrideW: 2, SamePadding: true}).Forward(x).(num.Tensor4D)
+	if strided[0][0].Rows != 4 || strided[0][0].Columns != 3 {
+		fmt.Println(strided[0][0].Rows, strided[0][0].Columns)
+		t.Fail()
+	}
+}
+
+func TestDepthwiseSeparableConv2D(t *testing.T) {
+	dw, _ := num.NewRandnT4D(3, 1, 3, 3)
+	db, _ := num.NewRandnMatrix(1, 3)
+	pw, _ := num.NewRandnT4D(5, 3, 1, 1)
+	pb, _ := num.NewRandnMatrix(1, 5)
+	conv := NewDepthwiseSeparableConv2D(dw, db, pw, pb, &Conv2DParams{SamePadding: true})
+
+	x, _ := num.NewRandnT4D(2, 3, 4, 4)
+	out := conv.Forward(x).(num.Tensor4D)
+	if len(out) != 2 || len(out[0]) != 5 || out[0][0].Rows != 4 || out[0][0].Columns != 4 {
+		fmt.Println(out)
+		t.Fail()
+	}
+	checkConv2D(t, conv, dw, func() num.Tensor4D { return conv.Depthwise.DW }, 2, 3, 4, 4)
+	checkConv2D(t, conv, pw, func() num.Tensor4D { return conv.Pointwise.DW }, 2, 3, 4, 4)
+}
@@ -0,0 +1,316 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// Conv3D は、(N, C, D, H, W)の入力に対する3次元の畳み込み層（動画・CTなどの体積データ用）
+// ゼロ値のStride, Dilationは1として扱う
+type Conv3D struct {
+	W        num.Tensor5D // (FN, C, FD, FH, FW)
+	B        *num.Matrix  // (1, FN)
+	Stride   int
+	Pad      int
+	Dilation int
+	// 中間データ（backward時に使用）
+	XShape []int
+	Col    *num.Matrix
+	ColW   *num.Matrix
+	Window *num.Conv3DParams
+	// 重み・バイアスパラメータの勾配
+	DW num.Tensor5D
+	DB *num.Matrix
+}
+
+func NewConv3D(w num.Tensor5D, b *num.Matrix, stride, pad int) *Conv3D {
+	return &Conv3D{
+		W:      w,
+		B:      b,
+		Stride: stride,
+		Pad:    pad,
+	}
+}
+
+func (c *Conv3D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor5D)
+	FD, FH, FW := len(c.W[0][0]), c.W[0][0][0].Rows, c.W[0][0][0].Columns
+	stride, dilation := atLeastOne(c.Stride), atLeastOne(c.Dilation)
+	c.Window = &num.Conv3DParams{
+		FD: FD, FH: FH, FW: FW,
+		StrideD: stride, StrideH: stride, StrideW: stride,
+		PadD: c.Pad, PadH: c.Pad, PadW: c.Pad,
+		DilationD: dilation, DilationH: dilation, DilationW: dilation,
+	}
+	return c.forward(x)
+}
+
+func (c *Conv3D) Backward(dout interface{}) interface{} {
+	return c.backward(dout.(num.Tensor5D))
+}
+
+// forward は、Windowの設定で畳み込む（Conv1Dと共通）
+func (c *Conv3D) forward(x num.Tensor5D) num.Tensor5D {
+	FN := len(c.W)
+	N, C, D, H, W := len(x), len(x[0]), len(x[0][0]), x[0][0][0].Rows, x[0][0][0].Columns
+	outD, outH, outW := c.Window.OutputSize(D, H, W)
+	c.Col = x.Im2Col3D(c.Window)
+	w := c.W.Flatten()
+	c.ColW = (&num.Matrix{Vector: w, Rows: FN, Columns: len(w) / FN}).T()
+	out := num.Add(num.Dot(c.Col, c.ColW), c.B)
+	c.XShape = []int{N, C, D, H, W}
+	return matToNCDHW(out, N, outD, outH, outW)
+}
+
+func (c *Conv3D) backward(dout num.Tensor5D) num.Tensor5D {
+	FN, C, FD, FH, FW := len(c.W), len(c.W[0]), len(c.W[0][0]), c.W[0][0][0].Rows, c.W[0][0][0].Columns
+	doutMat := ncdhwToMat(dout)
+	c.DB = num.Sum(doutMat, 0)
+	dw := num.Dot(c.Col.T(), doutMat).T()
+	c.DW = make(num.Tensor5D, FN)
+	size := C * FD * FH * FW
+	for f := range c.DW {
+		w := &num.Matrix{Vector: dw.Vector[f*size : (f+1)*size], Rows: 1, Columns: size}
+		c.DW[f] = w.ReshapeTo4D(C, FD, FH, FW)
+	}
+	dcol := num.Dot(doutMat, c.ColW.T())
+	return dcol.Col2Img3D(c.XShape, c.Window)
+}
+
+// matToNCDHW は、(N*OD*OH*OW, C)の行列を(N, C, OD, OH, OW)にする
+func matToNCDHW(m *num.Matrix, n, d, h, w int) num.Tensor5D {
+	C := m.Columns
+	out := num.ZerosT5D(n, C, d, h, w)
+	for i := 0; i < m.Rows; i++ {
+		b, pos := i/(d*h*w), i%(d*h*w)
+		for c := 0; c < C; c++ {
+			out[b][c][pos/(h*w)].Vector[pos%(h*w)] = m.Vector[i*C+c]
+		}
+	}
+	return out
+}
+
+// ncdhwToMat は、matToNCDHWの逆変換
+func ncdhwToMat(t num.Tensor5D) *num.Matrix {
+	N, C, D, H, W := len(t), len(t[0]), len(t[0][0]), t[0][0][0].Rows, t[0][0][0].Columns
+	m := num.Zeros(N*D*H*W, C)
+	for n := range t {
+		for c := range t[n] {
+			for d, mat := range t[n][c] {
+				for i, v := range mat.Vector {
+					m.Vector[((n*D+d)*H*W+i)*C+c] = v
+				}
+			}
+		}
+	}
+	return m
+}
+
+// MaxPool3D は、(N, C, D, H, W)の入力のPool×Pool×Poolの窓の最大値をとる
+// パディング部分は最大値の候補にしない
+type MaxPool3D struct {
+	Pool   int
+	Stride int
+	Pad    int
+	// 中間データ（backward時に使用）
+	XShape []int
+	Window *num.Conv3DParams
+	// 出力の各要素の最大値の入力の位置（チャンネル内のd*H*W+h*W+w）
+	ArgMax []int
+}
+
+// NewMaxPool3D は、窓がパディングだけになると最大値の位置がないので、pad >= poolならpanicする
+func NewMaxPool3D(pool, stride, pad int) *MaxPool3D {
+	checkPoolPad(pool, pad)
+	return &MaxPool3D{
+		Pool:   pool,
+		Stride: stride,
+		Pad:    pad,
+	}
+}
+
+func checkPoolPad(pool, pad int) {
+	if pad < 0 || pad >= pool {
+		panic(fmt.Sprintf("padding %d must be in [0, pool %d)", pad, pool))
+	}
+}
+
+func (p *MaxPool3D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor5D)
+	stride := atLeastOne(p.Stride)
+	p.Window = &num.Conv3DParams{
+		FD: p.Pool, FH: p.Pool, FW: p.Pool,
+		StrideD: stride, StrideH: stride, StrideW: stride,
+		PadD: p.Pad, PadH: p.Pad, PadW: p.Pad,
+		DilationD: 1, DilationH: 1, DilationW: 1,
+	}
+	return p.forward(x)
+}
+
+func (p *MaxPool3D) Backward(dout interface{}) interface{} {
+	return p.backward(dout.(num.Tensor5D))
+}
+
+func (p *MaxPool3D) forward(x num.Tensor5D) num.Tensor5D {
+	N, C, D, H, W := len(x), len(x[0]), len(x[0][0]), x[0][0][0].Rows, x[0][0][0].Columns
+	outD, outH, outW := p.Window.OutputSize(D, H, W)
+	p.XShape = []int{N, C, D, H, W}
+
+	// 位置+1を並べたテンソルを展開して、窓の各要素の入力の位置を求める（パディングは0）
+	index := num.ZerosT5D(1, 1, D, H, W)
+	for d, mat := range index[0][0] {
+		for i := range mat.Vector {
+			mat.Vector[i] = float64(d*H*W + i + 1)
+		}
+	}
+	positions := index.Im2Col3D(p.Window)
+	k := positions.Columns
+
+	out := num.ZerosT5D(N, C, outD, outH, outW)
+	p.ArgMax = make([]int, 0, N*C*outD*outH*outW)
+	for n := range x {
+		for c := range x[n] {
+			for o := 0; o < positions.Rows; o++ {
+				max, arg := math.Inf(-1), -1
+				for _, pos := range positions.Vector[o*k : (o+1)*k] {
+					if pos == 0 {
+						continue
+					}
+					i := int(pos) - 1
+					if v := x[n][c][i/(H*W)].Vector[i%(H*W)]; arg < 0 || v > max {
+						max, arg = v, i
+					}
+				}
+				out[n][c][o/(outH*outW)].Vector[o%(outH*outW)] = max
+				p.ArgMax = append(p.ArgMax, arg)
+			}
+		}
+	}
+	return out
+}
+
+func (p *MaxPool3D) backward(dout num.Tensor5D) num.Tensor5D {
+	N, C, D, H, W := p.XShape[0], p.XShape[1], p.XShape[2], p.XShape[3], p.XShape[4]
+	dx := num.ZerosT5D(N, C, D, H, W)
+	j := 0
+	for n := range dout {
+		for c := range dout[n] {
+			for _, mat := range dout[n][c] {
+				for _, v := range mat.Vector {
+					i := p.ArgMax[j]
+					dx[n][c][i/(H*W)].Vector[i%(H*W)] += v
+					j++
+				}
+			}
+		}
+	}
+	return dx
+}
+
+// Conv1D は、(N, C, L)の入力に対する1次元の畳み込み層（時系列・音声の特徴量用）
+// 入力を(N, C, 1, 1, L)とみなしてConv3Dと同じim2colで計算する
+type Conv1D struct {
+	W        num.Tensor3D // (FN, C, K)
+	B        *num.Matrix  // (1, FN)
+	Stride   int
+	Pad      int
+	Dilation int
+	// 中間データ（backward時に使用）
+	Conv *Conv3D
+	// 重み・バイアスパラメータの勾配
+	DW num.Tensor3D
+	DB *num.Matrix
+}
+
+func NewConv1D(w num.Tensor3D, b *num.Matrix, stride, pad int) *Conv1D {
+	return &Conv1D{
+		W:      w,
+		B:      b,
+		Stride: stride,
+		Pad:    pad,
+	}
+}
+
+func (c *Conv1D) Forward(ix interface{}) interface{} {
+	c.Conv = &Conv3D{
+		W: nclToNCDHW(c.W),
+		B: c.B,
+		Window: &num.Conv3DParams{
+			FD: 1, FH: 1, FW: c.W[0].Columns,
+			StrideD: 1, StrideH: 1, StrideW: atLeastOne(c.Stride),
+			PadW:      c.Pad,
+			DilationD: 1, DilationH: 1, DilationW: atLeastOne(c.Dilation),
+		},
+	}
+	return ncdhwToNCL(c.Conv.forward(nclToNCDHW(ix.(num.Tensor3D))))
+}
+
+func (c *Conv1D) Backward(dout interface{}) interface{} {
+	dx := c.Conv.backward(nclToNCDHW(dout.(num.Tensor3D)))
+	c.DW = ncdhwToNCL(c.Conv.DW)
+	c.DB = c.Conv.DB
+	return ncdhwToNCL(dx)
+}
+
+// MaxPool1D は、(N, C, L)の入力の長さPoolの窓の最大値をとる
+type MaxPool1D struct {
+	Pool   int
+	Stride int
+	Pad    int
+	// 中間データ（backward時に使用）
+	Pool3D *MaxPool3D
+}
+
+// NewMaxPool1D は、NewMaxPool3Dと同じくpad >= poolならpanicする
+func NewMaxPool1D(pool, stride, pad int) *MaxPool1D {
+	checkPoolPad(pool, pad)
+	return &MaxPool1D{
+		Pool:   pool,
+		Stride: stride,
+		Pad:    pad,
+	}
+}
+
+func (p *MaxPool1D) Forward(ix interface{}) interface{} {
+	p.Pool3D = &MaxPool3D{
+		Window: &num.Conv3DParams{
+			FD: 1, FH: 1, FW: p.Pool,
+			StrideD: 1, StrideH: 1, StrideW: atLeastOne(p.Stride),
+			PadW:      p.Pad,
+			DilationD: 1, DilationH: 1, DilationW: 1,
+		},
+	}
+	return ncdhwToNCL(p.Pool3D.forward(nclToNCDHW(ix.(num.Tensor3D))))
+}
+
+func (p *MaxPool1D) Backward(dout interface{}) interface{} {
+	return ncdhwToNCL(p.Pool3D.backward(nclToNCDHW(dout.(num.Tensor3D))))
+}
+
+// nclToNCDHW は、(N, C, L)を(N, C, 1, 1, L)にする（値は共有する）
+func nclToNCDHW(t num.Tensor3D) num.Tensor5D {
+	out := make(num.Tensor5D, len(t))
+	for n, m := range t {
+		out[n] = make(num.Tensor4D, m.Rows)
+		for c := range out[n] {
+			out[n][c] = num.Tensor3D{{Vector: m.SliceRow(c), Rows: 1, Columns: m.Columns}}
+		}
+	}
+	return out
+}
+
+// ncdhwToNCL は、(N, C, 1, 1, L)を(N, C, L)にする
+func ncdhwToNCL(t num.Tensor5D) num.Tensor3D {
+	out := make(num.Tensor3D, len(t))
+	for n := range t {
+		L := t[n][0][0].Columns
+		m := num.Zeros(len(t[n]), L)
+		for c := range t[n] {
+			copy(m.SliceRow(c), t[n][c][0].Vector)
+		}
+		out[n] = m
+	}
+	return out
+}
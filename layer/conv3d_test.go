@@ -0,0 +1,271 @@
+package layer
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func randnT5D(a, b, c, h, w int) num.Tensor5D {
+	t := make(num.Tensor5D, a)
+	for i := range t {
+		t[i], _ = num.NewRandnT4D(b, c, h, w)
+	}
+	return t
+}
+
+// randnLikeT5D は、tと同じ形の乱数
+func randnLikeT5D(t num.Tensor5D) num.Tensor5D {
+	out := make(num.Tensor5D, len(t))
+	for i := range t {
+		out[i] = make(num.Tensor4D, len(t[i]))
+		for j := range t[i] {
+			out[i][j] = make(num.Tensor3D, len(t[i][j]))
+			for k, m := range t[i][j] {
+				out[i][j][k] = &num.Matrix{Vector: vec.Randn(len(m.Vector)), Rows: m.Rows, Columns: m.Columns}
+			}
+		}
+	}
+	return out
+}
+
+// checkConvND は、xとparamsの勾配を数値微分と比較する
+// 損失はsum(Forward(x) * dout)とし、doutは乱数で固定する
+// gradsはBackwardの後に呼び、xの勾配に続けてparamsの勾配を返す
+func checkConvND(t *testing.T, name string, l T4DLayer, x interface{}, params []vec.Vector, grads func(dx interface{}) []vec.Vector) {
+	flatten := func(v interface{}) vec.Vector {
+		switch t := v.(type) {
+		case num.Tensor3D:
+			return t.Flatten()
+		case num.Tensor5D:
+			return t.Flatten()
+		}
+		panic(v)
+	}
+	var dout interface{}
+	switch out := l.Forward(x).(type) {
+	case num.Tensor3D:
+		d := make(num.Tensor3D, len(out))
+		for i, m := range out {
+			d[i] = &num.Matrix{Vector: vec.Randn(len(m.Vector)), Rows: m.Rows, Columns: m.Columns}
+		}
+		dout = d
+	case num.Tensor5D:
+		dout = randnLikeT5D(out)
+	}
+	w := flatten(dout)
+	analytic := grads(l.Backward(dout))
+	loss := func() float64 { return vec.Sum(vec.Mul(flatten(l.Forward(x)), w)) }
+
+	// xは行列ごとに数値微分する
+	var xs []vec.Vector
+	switch t := x.(type) {
+	case num.Tensor3D:
+		for _, m := range t {
+			xs = append(xs, m.Vector)
+		}
+	case num.Tensor5D:
+		for _, t4d := range t {
+			for _, t3d := range t4d {
+				for _, m := range t3d {
+					xs = append(xs, m.Vector)
+				}
+			}
+		}
+	}
+	numerical := vec.Vector{}
+	for _, v := range xs {
+		numerical = append(numerical, numericalGradient(loss, v)...)
+	}
+	if !closeEnough(analytic[0], numerical) {
+		fmt.Println(name, "x", analytic[0], numerical)
+		t.Fail()
+	}
+	for i, p := range params {
+		numerical := numericalGradient(loss, p)
+		if !closeEnough(analytic[i+1], numerical) {
+			fmt.Println(name, i, analytic[i+1], numerical)
+			t.Fail()
+		}
+	}
+}
+
+// D = 1, FD = 1なら2次元の畳み込みと同じ
+func TestConv3DMatchesConvolution(t *testing.T) {
+	x, _ := num.NewRandnT4D(2, 3, 5, 5)
+	w, _ := num.NewRandnT4D(4, 3, 3, 3)
+	b := mustRandn(1, 4)
+	expected := NewConvolution(w, b, 2, 0).Forward(x).(num.Tensor4D)
+
+	x5 := make(num.Tensor5D, len(x))
+	for n := range x {
+		x5[n] = make(num.Tensor4D, len(x[n]))
+		for c, m := range x[n] {
+			x5[n][c] = num.Tensor3D{m}
+		}
+	}
+	w5 := make(num.Tensor5D, len(w))
+	for f := range w {
+		w5[f] = make(num.Tensor4D, len(w[f]))
+		for c, m := range w[f] {
+			w5[f][c] = num.Tensor3D{m}
+		}
+	}
+	actual := NewConv3D(w5, b, 2, 0).Forward(x5).(num.Tensor5D)
+	for n := range expected {
+		for c := range expected[n] {
+			if !closeEnough(actual[n][c][0].Vector, expected[n][c].Vector) {
+				fmt.Println(n, c, actual[n][c][0], expected[n][c])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestConv3DGradient(t *testing.T) {
+	w := randnT5D(3, 2, 2, 3, 2)
+	b := mustRandn(1, 3)
+	conv := NewConv3D(w, b, 2, 1)
+	conv.Dilation = 2
+	x := randnT5D(2, 2, 4, 5, 4)
+	params := []vec.Vector{}
+	for _, t4d := range w {
+		for _, t3d := range t4d {
+			for _, m := range t3d {
+				params = append(params, m.Vector)
+			}
+		}
+	}
+	params = append(params, b.Vector)
+	checkConvND(t, "Conv3D", conv, x, params, func(dx interface{}) []vec.Vector {
+		grads := []vec.Vector{dx.(num.Tensor5D).Flatten()}
+		for _, t4d := range conv.DW {
+			for _, t3d := range t4d {
+				for _, m := range t3d {
+					grads = append(grads, m.Vector)
+				}
+			}
+		}
+		return append(grads, conv.DB.Vector)
+	})
+}
+
+func TestMaxPool3D(t *testing.T) {
+	// パディングは最大値の候補にしないので、負の値だけでも正しく求まる
+	// 数値微分で最大値が入れ替わらないように、値どうしを十分離す
+	x := randnT5D(2, 2, 4, 4, 5)
+	order := rand.Perm(len(x.Flatten()))
+	k := 0
+	for _, t4d := range x {
+		for _, t3d := range t4d {
+			for _, m := range t3d {
+				for i := range m.Vector {
+					m.Vector[i] = -10 - 0.01*float64(order[k])
+					k++
+				}
+			}
+		}
+	}
+	pool := NewMaxPool3D(2, 2, 1)
+	out := pool.Forward(x).(num.Tensor5D)
+	if len(out[0][0]) != 3 || out[0][0][0].Rows != 3 || out[0][0][0].Columns != 3 {
+		fmt.Println(len(out[0][0]), out[0][0][0].Rows, out[0][0][0].Columns)
+		t.Fail()
+	}
+	// 角の窓は入力の(0, 0, 0)だけ
+	if out[1][1][0].Vector[0] != x[1][1][0].Vector[0] {
+		fmt.Println(out[1][1][0].Vector[0], x[1][1][0].Vector[0])
+		t.Fail()
+	}
+	checkConvND(t, "MaxPool3D", pool, x, nil, func(dx interface{}) []vec.Vector {
+		return []vec.Vector{dx.(num.Tensor5D).Flatten()}
+	})
+}
+
+func TestConv1D(t *testing.T) {
+	x, _ := num.NewMatrix(1, 4, vec.Vector{1, 2, 3, 4})
+	w, _ := num.NewMatrix(1, 3, vec.Vector{1, 0, -1})
+	conv := NewConv1D(num.Tensor3D{w}, num.Zeros(1, 1), 1, 1)
+	actual := conv.Forward(num.Tensor3D{x}).(num.Tensor3D)
+	expected := vec.Vector{-2, -2, -2, 3}
+	if actual[0].Rows != 1 || !closeEnough(actual[0].Vector, expected) {
+		fmt.Println(actual[0], expected)
+		t.Fail()
+	}
+}
+
+func TestConv1DGradient(t *testing.T) {
+	w, _ := num.NewRandnT3D(4, 3, 3)
+	b := mustRandn(1, 4)
+	conv := NewConv1D(w, b, 2, 2)
+	conv.Dilation = 2
+	x, _ := num.NewRandnT3D(2, 3, 9)
+	params := []vec.Vector{}
+	for _, m := range w {
+		params = append(params, m.Vector)
+	}
+	params = append(params, b.Vector)
+	checkConvND(t, "Conv1D", conv, x, params, func(dx interface{}) []vec.Vector {
+		grads := []vec.Vector{dx.(num.Tensor3D).Flatten()}
+		for _, m := range conv.DW {
+			grads = append(grads, m.Vector)
+		}
+		return append(grads, conv.DB.Vector)
+	})
+}
+
+func TestMaxPoolPad(t *testing.T) {
+	// 窓がパディングだけになる
+	for _, c := range [][2]int{{2, 2}, {1, 1}, {2, 3}, {2, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println("pool", c[0], "pad", c[1])
+					t.Fail()
+				}
+			}()
+			NewMaxPool3D(c[0], 1, c[1])
+		}()
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println("pool", c[0], "pad", c[1])
+					t.Fail()
+				}
+			}()
+			NewMaxPool1D(c[0], 1, c[1])
+		}()
+	}
+}
+
+func TestMaxPool1D(t *testing.T) {
+	x, _ := num.NewMatrix(1, 4, vec.Vector{-3, -1, -2, -5})
+	pool := NewMaxPool1D(2, 2, 1)
+	actual := pool.Forward(num.Tensor3D{x}).(num.Tensor3D)
+	expected := vec.Vector{-3, -1, -5}
+	if !closeEnough(actual[0].Vector, expected) {
+		fmt.Println(actual[0], expected)
+		t.Fail()
+	}
+	dout, _ := num.NewMatrix(1, 3, vec.Vector{1, 2, 3})
+	dx := pool.Backward(num.Tensor3D{dout}).(num.Tensor3D)
+	if !closeEnough(dx[0].Vector, vec.Vector{1, 2, 0, 3}) {
+		fmt.Println(dx[0])
+		t.Fail()
+	}
+
+	// 数値微分で最大値が入れ替わらないように、値どうしとパディングの0を十分離す
+	x3, _ := num.NewRandnT3D(2, 3, 7)
+	order := rand.Perm(2 * 3 * 7)
+	for i, m := range x3 {
+		for j := range m.Vector {
+			m.Vector[j] = 0.1*float64(order[i*len(m.Vector)+j]) - 2.05
+		}
+	}
+	checkConvND(t, "MaxPool1D", NewMaxPool1D(3, 2, 1), x3, nil, func(dx interface{}) []vec.Vector {
+		return []vec.Vector{dx.(num.Tensor3D).Flatten()}
+	})
+}
@@ -0,0 +1,100 @@
+package layer
+
+import (
+	"fmt"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// ConvTranspose2D は、転置畳み込み（逆畳み込み）層
+// 畳み込みの逆伝搬と同じ計算で、Col2Imgで特徴マップを拡大する
+// 出力サイズは (H-1)*Stride - 2*Pad + FH + OutputPad
+type ConvTranspose2D struct {
+	W         num.Tensor4D // (C, FN, FH, FW)
+	B         *num.Matrix  // (1, FN)
+	Stride    int
+	Pad       int
+	OutputPad int // 出力サイズの曖昧さを解消するため下・右に足す幅（Stride未満）
+	// 中間データ（backward時に使用）
+	XMat   *num.Matrix
+	XShape []int
+	Window *num.Conv2DParams
+	// 重み・バイアスパラメータの勾配
+	DW num.Tensor4D
+	DB *num.Matrix
+}
+
+// NewConvTranspose2D は、outputPadが0未満かStride以上ならpanicする（Stride以上では出力が対応する畳み込みの入力の大きさにならないため。PyTorch・ONNXと同じ）
+func NewConvTranspose2D(w num.Tensor4D, b *num.Matrix, stride, pad, outputPad int) *ConvTranspose2D {
+	if outputPad < 0 || outputPad >= stride {
+		panic(fmt.Sprintf("output padding %d must be in [0, stride %d)", outputPad, stride))
+	}
+	return &ConvTranspose2D{
+		W:         w,
+		B:         b,
+		Stride:    stride,
+		Pad:       pad,
+		OutputPad: outputPad,
+	}
+}
+
+func (ct *ConvTranspose2D) weightMat() *num.Matrix {
+	C, FN, FH, FW := len(ct.W), len(ct.W[0]), ct.W[0][0].Rows, ct.W[0][0].Columns
+	return &num.Matrix{
+		Vector:  ct.W.Flatten(),
+		Rows:    C,
+		Columns: FN * FH * FW,
+	}
+}
+
+func (ct *ConvTranspose2D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	FN, FH, FW := len(ct.W[0]), ct.W[0][0].Rows, ct.W[0][0].Columns
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	outH := (H-1)*ct.Stride - 2*ct.Pad + FH + ct.OutputPad
+	outW := (W-1)*ct.Stride - 2*ct.Pad + FW + ct.OutputPad
+
+	win := &num.Conv2DParams{
+		FH:        FH,
+		FW:        FW,
+		StrideH:   ct.Stride,
+		StrideW:   ct.Stride,
+		PadTop:    ct.Pad,
+		PadBottom: ct.Pad,
+		PadLeft:   ct.Pad,
+		PadRight:  ct.Pad,
+		DilationH: 1,
+		DilationW: 1,
+	}
+	xMat := nchwToMat(x)
+	col := num.Dot(xMat, ct.weightMat())
+	out := col.Col2ImgWithParams([]int{N, FN, outH, outW}, win)
+	for _, t3d := range out {
+		for f, mat := range t3d {
+			for i := range mat.Vector {
+				mat.Vector[i] += ct.B.Vector[f]
+			}
+		}
+	}
+
+	ct.XMat = xMat
+	ct.XShape = []int{N, C, H, W}
+	ct.Window = win
+	return out
+}
+
+func (ct *ConvTranspose2D) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	C, FN, FH, FW := len(ct.W), len(ct.W[0]), ct.W[0][0].Rows, ct.W[0][0].Columns
+
+	ct.DB = num.Zeros(1, FN)
+	for _, t3d := range dout {
+		for f, mat := range t3d {
+			ct.DB.Vector[f] += num.SumAll(mat)
+		}
+	}
+	dcol := dout.Im2ColWithParams(ct.Window)
+	ct.DW = num.Dot(ct.XMat.T(), dcol).ReshapeTo4D(C, FN, FH, FW)
+	dx := num.Dot(dcol, ct.weightMat().T())
+	return matToNCHW(dx, ct.XShape[0], ct.XShape[2], ct.XShape[3])
+}
@@ -0,0 +1,102 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestConvTranspose2D(t *testing.T) {
+	x := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		1, 2,
+		3, 4,
+	}, Rows: 2, Columns: 2}}}
+	w := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		1, 1,
+		1, 1,
+	}, Rows: 2, Columns: 2}}}
+	b, _ := num.NewMatrix(1, 1, vec.Vector{0.5})
+	ct := NewConvTranspose2D(w, b, 2, 0, 0)
+
+	actual := ct.Forward(x).(num.Tensor4D)
+	expected := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{
+		1.5, 1.5, 2.5, 2.5,
+		1.5, 1.5, 2.5, 2.5,
+		3.5, 3.5, 4.5, 4.5,
+		3.5, 3.5, 4.5, 4.5,
+	}, Rows: 4, Columns: 4}}}
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+}
+
+func TestConvTranspose2DOutputSize(t *testing.T) {
+	w, _ := num.NewRandnT4D(2, 3, 3, 3)
+	b := num.Zeros(1, 3)
+	x, _ := num.NewRandnT4D(1, 2, 4, 4)
+
+	// Conv2D(stride 2, pad 1)で7x7と8x8はどちらも4x4になるので、OutputPadで区別する
+	for outputPad, size := range []int{7, 8} {
+		out := NewConvTranspose2D(w, b, 2, 1, outputPad).Forward(x).(num.Tensor4D)
+		if len(out[0]) != 3 || out[0][0].Rows != size || out[0][0].Columns != size {
+			fmt.Println(outputPad, len(out[0]), out[0][0].Rows, out[0][0].Columns)
+			t.Fail()
+		}
+	}
+
+	// OutputPadがStride以上の出力は、どの畳み込みの入力の大きさにもならない
+	for _, c := range [][2]int{{2, 2}, {1, 1}, {2, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println("stride", c[0], "output pad", c[1])
+					t.Fail()
+				}
+			}()
+			NewConvTranspose2D(w, b, c[0], 1, c[1])
+		}()
+	}
+}
+
+// 転置畳み込みは同じ重みの畳み込みの随伴になる: <conv(y), x> = <y, convT(x)>
+func TestConvTranspose2DAdjoint(t *testing.T) {
+	w, _ := num.NewRandnT4D(2, 3, 3, 3)
+	x, _ := num.NewRandnT4D(2, 2, 4, 4)
+	y, _ := num.NewRandnT4D(2, 3, 8, 8)
+
+	ct := NewConvTranspose2D(w, num.Zeros(1, 3), 2, 1, 1)
+	conv := NewConv2D(w, num.Zeros(1, 2), &Conv2DParams{
+		StrideH: 2, StrideW: 2,
+		PadTop: 1, PadBottom: 1, PadLeft: 1, PadRight: 1,
+	})
+	lhs := vec.Sum(vec.Mul(conv.Forward(y).(num.Tensor4D).Flatten(), x.Flatten()))
+	rhs := vec.Sum(vec.Mul(y.Flatten(), ct.Forward(x).(num.Tensor4D).Flatten()))
+	if !closeEnough(vec.Vector{lhs}, vec.Vector{rhs}) {
+		fmt.Println(lhs, rhs)
+		t.Fail()
+	}
+}
+
+func TestConvTranspose2DGradient(t *testing.T) {
+	w, _ := num.NewRandnT4D(2, 3, 3, 2)
+	b, _ := num.NewRandnMatrix(1, 3)
+	ct := NewConvTranspose2D(w, b, 2, 1, 1)
+	checkConv2D(t, ct, w, func() num.Tensor4D { return ct.DW }, 2, 2, 3, 4)
+
+	x, _ := num.NewRandnMatrix(2, 24)
+	shape := []int{2, 2, 3, 4}
+	loss := func() float64 {
+		y, _ := toMatrix(ct.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}
+	nb := numericalGradient(loss, b.Vector)
+	out, outShape := toMatrix(ct.Forward(fromMatrix(x, shape)))
+	ct.Backward(fromMatrix(num.Mul(out, 2.0), outShape))
+	if !closeEnough(ct.DB.Vector, nb) {
+		fmt.Println(ct.DB, nb)
+		t.Fail()
+	}
+}
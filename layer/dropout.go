@@ -1,11 +1,36 @@
 package layer
 
 import (
+	"fmt"
+	"math/rand"
+
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/vec"
 )
 
+// seeded は、マスクを作る乱数（nilならmath/randの共有の乱数）
+type seeded struct {
+	Rand *rand.Rand
+}
+
+// Seed は、マスクの乱数を再現できるようにする
+func (s *seeded) Seed(seed int64) {
+	s.Rand = rand.New(rand.NewSource(seed))
+}
+
+// keep は、確率1-ratioでtrue
+func (s *seeded) keep(ratio float64) bool {
+	if s.Rand == nil {
+		return rand.Float64() >= ratio
+	}
+	return s.Rand.Float64() >= ratio
+}
+
+// Dropout は、学習時に確率Ratioで要素を0にして、残りを1/(1-Ratio)倍する（inverted dropout）
+// 推論時は何もしない
+// http://jmlr.org/papers/v15/srivastava14a.html
 type Dropout struct {
+	seeded
 	Mask  []bool
 	Ratio float64
 }
@@ -17,43 +42,34 @@ func NewDropout(ratio float64) *Dropout {
 	}
 }
 
-// def __init__(self, dropout_ratio=0.5):
-//     self.dropout_ratio = dropout_ratio
-//     self.mask = None
-//
-// def forward(self, x, train_flg=True):
-//     if train_flg:
-//         self.mask = np.random.rand(*x.shape) > self.dropout_ratio
-//         return x * self.mask
-//     else:
-//         return x * (1.0 - self.dropout_ratio)
-//
-// def backward(self, dout):
-//     return dout * self.mask
 func (d *Dropout) Forward(x *num.Matrix, trainFlg bool) *num.Matrix {
-	if trainFlg {
-		out := num.ZerosLike(x)
-		rand, _ := num.NewRandnMatrix(x.Shape())
-		d.Mask = make([]bool, len(rand.Vector))
-		for i, v := range rand.Vector {
-			if v > d.Ratio {
-				d.Mask[i] = true
-				out.Vector[i] = x.Vector[i]
-			}
+	if !trainFlg {
+		d.Mask = nil
+		return x
+	}
+	out := num.ZerosLike(x)
+	d.Mask = make([]bool, len(x.Vector))
+	scale := 1.0 / (1.0 - d.Ratio)
+	for i, v := range x.Vector {
+		if d.keep(d.Ratio) {
+			d.Mask[i] = true
+			out.Vector[i] = v * scale
 		}
-		return out
 	}
-	return num.Mul(x, 1.0-d.Ratio)
+	return out
 }
 
+// Backward は、推論時のForwardの後なら勾配をそのまま返す
 func (d *Dropout) Backward(dout *num.Matrix) *num.Matrix {
+	if d.Mask == nil {
+		return dout
+	}
 	doutv := dout.Vector
 	dv := vec.ZerosLike(doutv)
+	scale := 1.0 / (1.0 - d.Ratio)
 	for i, e := range doutv {
 		if d.Mask[i] {
-			dv[i] = e
-		} else {
-			dv[i] = 0
+			dv[i] = e * scale
 		}
 	}
 	dx := &num.Matrix{
@@ -62,5 +78,127 @@ func (d *Dropout) Backward(dout *num.Matrix) *num.Matrix {
 		Columns: dout.Columns,
 	}
 	return dx
+}
+
+// Dropout2D は、(N, C, H, W)の入力のチャンネルをまるごと確率Ratioで0にする（spatial dropout）
+// T4DLayerのForwardは学習時かどうかを受け取れないので、TransformerEncoderと同じくTrainFlgで切り替える
+// https://arxiv.org/abs/1411.4280
+type Dropout2D struct {
+	seeded
+	Ratio float64
+	// trueなら学習時（ゼロ値は推論時）
+	TrainFlg bool
+	// 中間データ（backward時に使用）
+	Mask [][]bool
+}
+
+// NewDropout2D は、全てのチャンネルを落とすと1/(1-ratio)倍できないので、ratioが[0, 1)でなければpanicする
+func NewDropout2D(ratio float64) *Dropout2D {
+	if ratio < 0 || ratio >= 1 {
+		panic(fmt.Sprintf("dropout ratio %v must be in [0, 1)", ratio))
+	}
+	return &Dropout2D{
+		Ratio: ratio,
+	}
+}
+
+func (d *Dropout2D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	if !d.TrainFlg {
+		d.Mask = nil
+		return x
+	}
+	d.Mask = make([][]bool, len(x))
+	for n := range x {
+		d.Mask[n] = make([]bool, len(x[n]))
+		for c := range x[n] {
+			d.Mask[n][c] = d.keep(d.Ratio)
+		}
+	}
+	return d.apply(x)
+}
+
+func (d *Dropout2D) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	if d.Mask == nil {
+		return dout
+	}
+	return d.apply(dout)
+}
+
+// apply は、マスクしたチャンネルを0、残りを1/(1-Ratio)倍する
+func (d *Dropout2D) apply(x num.Tensor4D) num.Tensor4D {
+	out := make(num.Tensor4D, len(x))
+	for n := range x {
+		out[n] = make(num.Tensor3D, len(x[n]))
+		for c, m := range x[n] {
+			if d.Mask[n][c] {
+				out[n][c] = num.Mul(m, 1.0/(1.0-d.Ratio))
+			} else {
+				out[n][c] = num.ZerosLike(m)
+			}
+		}
+	}
+	return out
+}
+
+// DropConnect は、学習時に重みWの要素を確率Ratioで0にするAffine
+// 残りの重みは1/(1-Ratio)倍するので、推論時はWをそのまま使う
+// http://proceedings.mlr.press/v28/wan13.html
+type DropConnect struct {
+	seeded
+	W     *num.Matrix
+	B     *num.Matrix
+	Ratio float64
+	// 中間データ（backward時に使用）
+	X        *num.Matrix
+	Mask     []bool
+	DroppedW *num.Matrix
+	// 重み・バイアスパラメータの勾配
+	DW *num.Matrix
+	DB *num.Matrix
+}
+
+func NewDropConnect(w, b *num.Matrix, ratio float64) *DropConnect {
+	return &DropConnect{
+		W:     w,
+		B:     b,
+		Ratio: ratio,
+	}
+}
+
+func (dc *DropConnect) Forward(x *num.Matrix, trainFlg bool) *num.Matrix {
+	dc.X = x
+	if !trainFlg {
+		dc.Mask = nil
+		dc.DroppedW = dc.W
+		return num.Add(num.Dot(x, dc.W), dc.B)
+	}
+	dc.Mask = make([]bool, len(dc.W.Vector))
+	for i := range dc.Mask {
+		dc.Mask[i] = dc.keep(dc.Ratio)
+	}
+	dc.DroppedW = dc.mask(dc.W)
+	return num.Add(num.Dot(x, dc.DroppedW), dc.B)
+}
+
+func (dc *DropConnect) Backward(dout *num.Matrix) *num.Matrix {
+	dx := num.Dot(dout, dc.DroppedW.T())
+	dc.DW = num.Dot(dc.X.T(), dout)
+	if dc.Mask != nil {
+		dc.DW = dc.mask(dc.DW)
+	}
+	dc.DB = num.Sum(dout, 0)
+	return dx
+}
 
+// mask は、Maskで落とした要素を0、残りを1/(1-Ratio)倍する
+func (dc *DropConnect) mask(w *num.Matrix) *num.Matrix {
+	out := num.ZerosLike(w)
+	for i, v := range w.Vector {
+		if dc.Mask[i] {
+			out.Vector[i] = v / (1.0 - dc.Ratio)
+		}
+	}
+	return out
 }
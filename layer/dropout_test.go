@@ -0,0 +1,145 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// reseededDropout2D は、Forwardのたびに同じマスクを使う（数値微分用）
+type reseededDropout2D struct {
+	*Dropout2D
+}
+
+func (r reseededDropout2D) Forward(x interface{}) interface{} {
+	r.Seed(1)
+	return r.Dropout2D.Forward(x)
+}
+
+func TestDropout(t *testing.T) {
+	x := num.Add(num.Zeros(100, 100), 1.0)
+	d := NewDropout(0.3)
+	d.Seed(1)
+	out := d.Forward(x, true)
+	// 残した要素は1/(1-0.3)倍なので、平均はほぼ1
+	mean := vec.Sum(out.Vector) / float64(len(out.Vector))
+	if math.Abs(mean-1) > 0.05 {
+		fmt.Println(mean)
+		t.Fail()
+	}
+	for i, v := range out.Vector {
+		if d.Mask[i] && math.Abs(v-1/0.7) > 1e-12 || !d.Mask[i] && v != 0 {
+			fmt.Println(i, v)
+			t.Fail()
+			break
+		}
+	}
+	dx := d.Backward(x)
+	if num.NotEqual(dx, out) {
+		t.Fail()
+	}
+
+	// 同じシードなら同じマスク
+	d.Seed(1)
+	if num.NotEqual(d.Forward(x, true), out) {
+		t.Fail()
+	}
+
+	// 推論時はそのまま
+	if num.NotEqual(d.Forward(x, false), x) || num.NotEqual(d.Backward(x), x) {
+		t.Fail()
+	}
+}
+
+func TestDropout2D(t *testing.T) {
+	x, _ := num.NewRandnT4D(4, 8, 3, 3)
+	d := NewDropout2D(0.5)
+	// 既定は推論時
+	if out := d.Forward(x).(num.Tensor4D); d.Mask != nil || !closeEnough(out.Flatten(), x.Flatten()) {
+		t.Fail()
+	}
+	d.TrainFlg = true
+	d.Seed(2)
+	out := d.Forward(x).(num.Tensor4D)
+	dropped := 0
+	for n := range out {
+		for c := range out[n] {
+			for i, v := range out[n][c].Vector {
+				expected := 0.0
+				if d.Mask[n][c] {
+					expected = x[n][c].Vector[i] * 2
+				}
+				if v != expected {
+					fmt.Println(n, c, v, expected)
+					t.Fail()
+				}
+			}
+			if !d.Mask[n][c] {
+				dropped++
+			}
+		}
+	}
+	if dropped == 0 || dropped == 32 {
+		fmt.Println(dropped)
+		t.Fail()
+	}
+
+	xm := x.ReshapeToMat(4, -1)
+	dx, numerical := gradientCheck(reseededDropout2D{d}, xm, []int{4, 8, 3, 3})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+
+	d.TrainFlg = false
+	if !closeEnough(d.Forward(x).(num.Tensor4D).Flatten(), x.Flatten()) {
+		t.Fail()
+	}
+}
+
+func TestDropout2DRatio(t *testing.T) {
+	for _, ratio := range []float64{1, 1.5, -0.1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println(ratio)
+					t.Fail()
+				}
+			}()
+			NewDropout2D(ratio)
+		}()
+	}
+}
+
+func TestDropConnectGradient(t *testing.T) {
+	w := mustRandn(4, 3)
+	b := mustRandn(1, 3)
+	x := mustRandn(2, 4)
+	dout := mustRandn(2, 3)
+	dc := NewDropConnect(w, b, 0.5)
+	loss := func() float64 {
+		dc.Seed(3)
+		return vec.Sum(vec.Mul(dc.Forward(x, true).Vector, dout.Vector))
+	}
+	loss()
+	dx := dc.Backward(dout)
+	for _, c := range []struct {
+		name     string
+		param    *num.Matrix
+		analytic *num.Matrix
+	}{{"x", x, dx}, {"W", w, dc.DW}, {"B", b, dc.DB}} {
+		numerical := numericalGradient(loss, c.param.Vector)
+		if !closeEnough(c.analytic.Vector, numerical) {
+			fmt.Println(c.name, c.analytic, numerical)
+			t.Fail()
+		}
+	}
+
+	// 推論時はAffineと同じ
+	if num.NotEqual(dc.Forward(x, false), NewAffine(w, b).Forward(x, false)) {
+		t.Fail()
+	}
+}
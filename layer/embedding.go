@@ -0,0 +1,97 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// Embedding は、整数のidを学習可能なベクトルに変換する層
+// 入力は(N, T)のid（float64で持つ）、出力は(N, T*D)
+type Embedding struct {
+	W          *num.Matrix // (語彙数, D)
+	PaddingIdx int         // このidのベクトルは0のまま学習しない（-1なら使わない）
+	// 中間データ（backward時に使用）
+	XShape []int
+	Ids    []int
+	// 重みの勾配は、使われたidの行だけを持つ
+	DWIds  []int       // 昇順
+	DWRows *num.Matrix // (len(DWIds), D)
+}
+
+func NewEmbedding(w *num.Matrix, paddingIdx int) *Embedding {
+	if paddingIdx >= w.Rows {
+		panic(fmt.Sprintf("padding id %d is out of vocabulary size %d", paddingIdx, w.Rows))
+	}
+	if paddingIdx >= 0 {
+		row := w.SliceRow(paddingIdx)
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	return &Embedding{
+		W:          w,
+		PaddingIdx: paddingIdx,
+	}
+}
+
+func (e *Embedding) Forward(x *num.Matrix, _ bool) *num.Matrix {
+	D := e.W.Columns
+	ids := make([]int, len(x.Vector))
+	out := num.Zeros(x.Rows, x.Columns*D)
+	for i, v := range x.Vector {
+		// int(v)は小数を切り捨てるので、変換する前に確かめる
+		if v != math.Trunc(v) || v < 0 || v >= float64(e.W.Rows) {
+			panic(fmt.Sprintf("id %v at index %d is out of vocabulary size %d", v, i, e.W.Rows))
+		}
+		id := int(v)
+		ids[i] = id
+		copy(out.Vector[i*D:(i+1)*D], e.W.SliceRow(id))
+	}
+	e.XShape = []int{x.Rows, x.Columns}
+	e.Ids = ids
+	return out
+}
+
+// Backward は、同じidの勾配を足し合わせてDWIds・DWRowsに入れる
+// idは微分できないので、入力の勾配は0
+func (e *Embedding) Backward(dout *num.Matrix) *num.Matrix {
+	D := e.W.Columns
+	rows := map[int]int{}
+	for _, id := range e.Ids {
+		if id != e.PaddingIdx {
+			rows[id] = 0
+		}
+	}
+	e.DWIds = make([]int, 0, len(rows))
+	for id := range rows {
+		e.DWIds = append(e.DWIds, id)
+	}
+	sort.Ints(e.DWIds)
+	for i, id := range e.DWIds {
+		rows[id] = i
+	}
+
+	e.DWRows = num.Zeros(len(e.DWIds), D)
+	for i, id := range e.Ids {
+		if id == e.PaddingIdx {
+			continue
+		}
+		row := e.DWRows.SliceRow(rows[id])
+		for j, v := range dout.Vector[i*D : (i+1)*D] {
+			row[j] += v
+		}
+	}
+	return num.Zeros(e.XShape[0], e.XShape[1])
+}
+
+// DenseDW は、重みと同じ形の勾配を返す（OptimizerでWを更新するときに使う）
+func (e *Embedding) DenseDW() *num.Matrix {
+	dw := num.Zeros(e.W.Rows, e.W.Columns)
+	for i, id := range e.DWIds {
+		copy(dw.SliceRow(id), e.DWRows.SliceRow(i))
+	}
+	return dw
+}
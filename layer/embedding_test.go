@@ -0,0 +1,102 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestEmbedding(t *testing.T) {
+	w, _ := num.NewMatrix(4, 2, vec.Vector{
+		1, 1,
+		2, 2,
+		3, 3,
+		4, 4,
+	})
+	emb := NewEmbedding(w, 0)
+	x, _ := num.NewMatrix(2, 3, vec.Vector{
+		3, 1, 3,
+		0, 2, 0,
+	})
+	actual := emb.Forward(x, true)
+	expected, _ := num.NewMatrix(2, 6, vec.Vector{
+		4, 4, 2, 2, 4, 4,
+		0, 0, 3, 3, 0, 0,
+	})
+	if num.NotEqual(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	dout, _ := num.NewMatrix(2, 6, vec.Vector{
+		1, 2, 3, 4, 5, 6,
+		7, 8, 9, 10, 11, 12,
+	})
+	emb.Backward(dout)
+	// id 3は2回使われているので足し合わせる。id 0はパディングなので勾配を持たない
+	expectedRows, _ := num.NewMatrix(3, 2, vec.Vector{
+		3, 4,
+		9, 10,
+		6, 8,
+	})
+	if fmt.Sprint(emb.DWIds) != "[1 2 3]" || num.NotEqual(emb.DWRows, expectedRows) {
+		fmt.Println(emb.DWIds, emb.DWRows)
+		t.Fail()
+	}
+	expectedDense, _ := num.NewMatrix(4, 2, vec.Vector{
+		0, 0,
+		3, 4,
+		9, 10,
+		6, 8,
+	})
+	if num.NotEqual(emb.DenseDW(), expectedDense) {
+		fmt.Println(emb.DenseDW(), expectedDense)
+		t.Fail()
+	}
+}
+
+func TestEmbeddingInvalidID(t *testing.T) {
+	emb := NewEmbedding(num.Zeros(4, 2), -1)
+	for _, id := range []float64{-1, 4, 1.5, -0.5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println(id)
+					t.Fail()
+				}
+			}()
+			x, _ := num.NewMatrix(1, 2, vec.Vector{0, id})
+			emb.Forward(x, false)
+		}()
+	}
+}
+
+func TestEmbeddingGradient(t *testing.T) {
+	w, _ := num.NewRandnMatrix(5, 3)
+	emb := NewEmbedding(w, -1)
+	affine := NewAffine(mustRandn(6, 4), num.Zeros(1, 4))
+	so := NewSfotmaxWithLoss()
+	x, _ := num.NewMatrix(3, 2, vec.Vector{
+		4, 1,
+		1, 1,
+		0, 2,
+	})
+	labels := []int{0, 3, 2}
+	loss := func() float64 {
+		return so.ForwardLabels(affine.Forward(emb.Forward(x, true), true), labels)
+	}
+	loss()
+	emb.Backward(affine.Backward(so.Backward(1.0)))
+	numerical := numericalGradient(loss, w.Vector)
+	if !closeEnough(emb.DenseDW().Vector, numerical) {
+		fmt.Println(emb.DenseDW(), numerical)
+		t.Fail()
+	}
+}
+
+func mustRandn(r, c int) *num.Matrix {
+	m, _ := num.NewRandnMatrix(r, c)
+	return m
+}
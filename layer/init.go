@@ -0,0 +1,129 @@
+package layer
+
+import (
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// 重みを持つ層を、大きさと初期化方法から作るコンストラクタ
+// バイアスは0にする。fan_in・fan_outは畳み込みではカーネルの大きさを掛けたもの
+
+// NewAffineWithInit は、(inputSize, outputSize)の重みのAffine
+func NewAffineWithInit(init initializer.Initializer, inputSize, outputSize int) *Affine {
+	return NewAffine(initializer.Matrix(init, inputSize, outputSize), num.Zeros(1, outputSize))
+}
+
+func NewAffineT4DWithInit(init initializer.Initializer, inputSize, outputSize int) *AffineT4D {
+	return NewAffineT4D(initializer.Matrix(init, inputSize, outputSize), num.Zeros(1, outputSize))
+}
+
+func NewTimeAffineWithInit(init initializer.Initializer, inputSize, outputSize int) *TimeAffine {
+	return NewTimeAffine(initializer.Matrix(init, inputSize, outputSize), num.Zeros(1, outputSize))
+}
+
+func NewDropConnectWithInit(init initializer.Initializer, inputSize, outputSize int, ratio float64) *DropConnect {
+	return NewDropConnect(initializer.Matrix(init, inputSize, outputSize), num.Zeros(1, outputSize), ratio)
+}
+
+// NewEmbeddingWithInit は、(vocabSize, dim)の重みのEmbedding
+func NewEmbeddingWithInit(init initializer.Initializer, vocabSize, dim, paddingIdx int) *Embedding {
+	return NewEmbedding(initializer.Matrix(init, vocabSize, dim), paddingIdx)
+}
+
+// NewConvolutionWithInit は、(filterNum, channels, filterH, filterW)のフィルタのConvolution
+func NewConvolutionWithInit(init initializer.Initializer, filterNum, channels, filterH, filterW, stride, pad int) *Convolution {
+	w := initializer.Tensor4D(init, filterNum, channels, filterH, filterW)
+	return NewConvolution(w, num.Zeros(1, filterNum), stride, pad)
+}
+
+// NewConv2DWithInit は、channelsの入力をpのGroupsに分けるので、フィルタは(filterNum, channels/Groups, filterH, filterW)
+func NewConv2DWithInit(init initializer.Initializer, filterNum, channels, filterH, filterW int, p *Conv2DParams) *Conv2D {
+	groups := 1
+	if p != nil && p.Groups > 0 {
+		groups = p.Groups
+	}
+	w := initializer.Tensor4D(init, filterNum, channels/groups, filterH, filterW)
+	return NewConv2D(w, num.Zeros(1, filterNum), p)
+}
+
+// NewConvTranspose2DWithInit のフィルタは(channels, filterNum, filterH, filterW)
+// fan_inは、PyTorchと同じくfilterNum*filterH*filterW
+func NewConvTranspose2DWithInit(init initializer.Initializer, channels, filterNum, filterH, filterW, stride, pad, outputPad int) *ConvTranspose2D {
+	w := initializer.Tensor4D(init, channels, filterNum, filterH, filterW)
+	return NewConvTranspose2D(w, num.Zeros(1, filterNum), stride, pad, outputPad)
+}
+
+// NewDepthwiseSeparableConv2DWithInit は、channelsの各チャンネルをmultiplier枚のフィルタで畳み込んでからfilterNumにする
+func NewDepthwiseSeparableConv2DWithInit(init initializer.Initializer, channels, multiplier, filterNum, filterH, filterW int, p *Conv2DParams) *DepthwiseSeparableConv2D {
+	depthwise := Conv2DParams{}
+	if p != nil {
+		depthwise = *p
+	}
+	depthwise.Groups = channels
+	dw := initializer.Tensor4D(init, channels*multiplier, 1, filterH, filterW)
+	pw := initializer.Tensor4D(init, filterNum, channels*multiplier, 1, 1)
+	return NewDepthwiseSeparableConv2D(dw, num.Zeros(1, channels*multiplier), pw, num.Zeros(1, filterNum), &depthwise)
+}
+
+// NewConv1DWithInit は、(filterNum, channels, kernel)のフィルタのConv1D
+func NewConv1DWithInit(init initializer.Initializer, filterNum, channels, kernel, stride, pad int) *Conv1D {
+	return NewConv1D(initializer.Tensor3D(init, filterNum, channels, kernel), num.Zeros(1, filterNum), stride, pad)
+}
+
+// NewConv3DWithInit は、(filterNum, channels, filterD, filterH, filterW)のフィルタのConv3D
+func NewConv3DWithInit(init initializer.Initializer, filterNum, channels, filterD, filterH, filterW, stride, pad int) *Conv3D {
+	w := initializer.Tensor5D(init, filterNum, channels, filterD, filterH, filterW)
+	return NewConv3D(w, num.Zeros(1, filterNum), stride, pad)
+}
+
+// recurrentWeights は、ゲートをgates個持つ再帰層の(D, gates*H)・(H, gates*H)の重みとバイアス
+func recurrentWeights(init initializer.Initializer, inputSize, hiddenSize, gates int) (*num.Matrix, *num.Matrix, *num.Matrix) {
+	wx := initializer.Matrix(init, inputSize, gates*hiddenSize)
+	wh := initializer.Matrix(init, hiddenSize, gates*hiddenSize)
+	return wx, wh, num.Zeros(1, gates*hiddenSize)
+}
+
+func NewRNNWithInit(init initializer.Initializer, inputSize, hiddenSize int) *RNN {
+	return NewRNN(recurrentWeights(init, inputSize, hiddenSize, 1))
+}
+
+func NewLSTMWithInit(init initializer.Initializer, inputSize, hiddenSize int) *LSTM {
+	return NewLSTM(recurrentWeights(init, inputSize, hiddenSize, 4))
+}
+
+func NewGRUWithInit(init initializer.Initializer, inputSize, hiddenSize int) *GRU {
+	return NewGRU(recurrentWeights(init, inputSize, hiddenSize, 3))
+}
+
+func NewTimeRNNWithInit(init initializer.Initializer, inputSize, hiddenSize int, stateful bool) *TimeRNN {
+	wx, wh, b := recurrentWeights(init, inputSize, hiddenSize, 1)
+	return NewTimeRNN(wx, wh, b, stateful)
+}
+
+func NewTimeLSTMWithInit(init initializer.Initializer, inputSize, hiddenSize int, stateful bool) *TimeLSTM {
+	wx, wh, b := recurrentWeights(init, inputSize, hiddenSize, 4)
+	return NewTimeLSTM(wx, wh, b, stateful)
+}
+
+func NewTimeGRUWithInit(init initializer.Initializer, inputSize, hiddenSize int, stateful bool) *TimeGRU {
+	wx, wh, b := recurrentWeights(init, inputSize, hiddenSize, 3)
+	return NewTimeGRU(wx, wh, b, stateful)
+}
+
+// NewMultiHeadAttentionWithInit は、Q・K・V・出力の(dim, dim)の重みのMultiHeadAttention
+func NewMultiHeadAttentionWithInit(init initializer.Initializer, heads, dim int) *MultiHeadAttention {
+	w := func() (*num.Matrix, *num.Matrix) {
+		return initializer.Matrix(init, dim, dim), num.Zeros(1, dim)
+	}
+	wq, bq := w()
+	wk, bk := w()
+	wv, bv := w()
+	wo, bo := w()
+	return NewMultiHeadAttention(heads, wq, bq, wk, bk, wv, bv, wo, bo)
+}
+
+// NewTransformerEncoderWithInit は、注意機構と(dim, hidden)・(hidden, dim)の全結合層の重みを作る
+func NewTransformerEncoderWithInit(init initializer.Initializer, heads, dim, hidden int, dropoutRatio float64) *TransformerEncoder {
+	w1, w2 := initializer.Matrix(init, dim, hidden), initializer.Matrix(init, hidden, dim)
+	return NewTransformerEncoder(NewMultiHeadAttentionWithInit(init, heads, dim), w1, num.Zeros(1, hidden), w2, num.Zeros(1, dim), dropoutRatio)
+}
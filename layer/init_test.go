@@ -0,0 +1,29 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+)
+
+func TestWithInitShapes(t *testing.T) {
+	one := initializer.NewConstant(1)
+	conv := NewConv2DWithInit(one, 6, 4, 3, 3, &Conv2DParams{Groups: 2})
+	lstm := NewLSTMWithInit(one, 5, 3)
+	emb := NewEmbeddingWithInit(one, 10, 4, 0)
+	c1 := NewConv1DWithInit(one, 2, 3, 5, 1, 0)
+	ct := NewConvTranspose2DWithInit(one, 4, 2, 3, 3, 2, 1, 1)
+	shapes := fmt.Sprint(
+		len(conv.W), len(conv.W[0]), conv.B.Columns,
+		lstm.Wx.Rows, lstm.Wx.Columns, lstm.Wh.Rows, lstm.Wh.Columns, lstm.B.Columns,
+		emb.W.Rows, emb.W.Columns, emb.W.Element(0, 0), emb.W.Element(1, 0),
+		len(c1.W), c1.W[0].Rows, c1.W[0].Columns,
+		len(ct.W), len(ct.W[0]), ct.B.Columns,
+	)
+	// グループ畳み込みのフィルタは(6, 4/2, 3, 3)、paddingIdxの行は0
+	if shapes != "6 2 6 5 12 3 12 12 10 4 0 1 2 3 5 4 2 2" {
+		fmt.Println(shapes)
+		t.Fail()
+	}
+}
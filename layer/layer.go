@@ -1,6 +1,8 @@
 package layer
 
 import (
+	"fmt"
+
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/vec"
 )
@@ -110,9 +112,21 @@ func (r *ReLU) Backward(dout *num.Matrix) *num.Matrix {
 }
 
 type SoftmaxWithLoss struct {
+	// 0より大きければ、教師データを (1-LabelSmoothing)*t + LabelSmoothing/クラス数 にする
+	LabelSmoothing float64
+	// クラスごとの重み（nilなら全て1）
+	ClassWeights vec.Vector
+	// ForwardLabelsで、HasIgnoreIndexならIgnoreIndexのラベルのサンプルを損失に含めない
+	// 負のラベル（系列のパディングの-1など）は、いつも含めない
+	IgnoreIndex    int
+	HasIgnoreIndex bool
+
 	loss float64
 	y    *num.Matrix
 	t    *num.Matrix
+	// 重み付きの教師データと正規化の係数（LabelSmoothing・ClassWeights・ForwardLabelsを使うとき）
+	target *num.Matrix
+	norm   float64
 }
 
 func NewSfotmaxWithLoss() *SoftmaxWithLoss {
@@ -120,15 +134,87 @@ func NewSfotmaxWithLoss() *SoftmaxWithLoss {
 }
 
 func (so *SoftmaxWithLoss) Forward(x, t *num.Matrix) float64 {
+	if so.LabelSmoothing > 0 || so.ClassWeights != nil {
+		return so.weightedForward(x, t)
+	}
+	so.target = nil
 	so.t = t
 	so.y = num.Softmax(x)
 	so.loss = num.CrossEntropyError(so.y, so.t)
 	return so.loss
 }
 
-func (so *SoftmaxWithLoss) Backward(_ float64) *num.Matrix {
-	batchSize, _ := so.t.Shape()
-	sub := num.Sub(so.y, so.t)
-	dx := num.Div(sub, batchSize)
+// ForwardLabels は、one-hotではなくクラス番号の教師データで損失を求める
+// 負のクラス番号・IgnoreIndexのサンプルは無視し、クラス数以上の番号や数の違いはpanicする
+func (so *SoftmaxWithLoss) ForwardLabels(x *num.Matrix, labels []int) float64 {
+	if len(labels) != x.Rows {
+		panic(fmt.Sprintf("%d labels for %d samples", len(labels), x.Rows))
+	}
+	t := num.Zeros(x.Rows, x.Columns)
+	for i, label := range labels {
+		if label < 0 || (so.HasIgnoreIndex && label == so.IgnoreIndex) {
+			continue
+		}
+		if label >= x.Columns {
+			panic(fmt.Sprintf("label %d at index %d is out of range for %d classes", label, i, x.Columns))
+		}
+		t.Assign(1.0, i, label)
+	}
+	return so.weightedForward(x, t)
+}
+
+// weightedForward は、教師データが全て0の行を無視し、
+// 残りの行の損失をクラスの重みの合計で割る
+func (so *SoftmaxWithLoss) weightedForward(x, t *num.Matrix) float64 {
+	so.t = t
+	so.y = num.Softmax(x)
+	so.target = num.Zeros(t.Rows, t.Columns)
+	so.norm = 0
+	loss := 0.0
+	classes := float64(t.Columns)
+	for i := 0; i < t.Rows; i++ {
+		tRow := t.SliceRow(i)
+		if vec.Sum(tRow) == 0 {
+			continue
+		}
+		lse := logSumExp(x.SliceRow(i))
+		for j, v := range tRow {
+			w := 1.0
+			if so.ClassWeights != nil {
+				w = so.ClassWeights[j]
+			}
+			so.norm += w * v
+			target := w * ((1-so.LabelSmoothing)*v + so.LabelSmoothing/classes)
+			so.target.Vector[i*t.Columns+j] = target
+			loss -= target * (x.Vector[i*x.Columns+j] - lse)
+		}
+	}
+	if so.norm == 0 {
+		so.loss = 0
+		return so.loss
+	}
+	so.loss = loss / so.norm
+	return so.loss
+}
+
+func (so *SoftmaxWithLoss) Backward(dout float64) *num.Matrix {
+	if so.target == nil {
+		batchSize := float64(so.t.Rows)
+		sub := num.Sub(so.y, so.t)
+		dx := num.Mul(num.Div(sub, batchSize), dout)
+		return dx
+	}
+	dx := num.Zeros(so.y.Rows, so.y.Columns)
+	if so.norm == 0 {
+		return dx
+	}
+	for i := 0; i < so.y.Rows; i++ {
+		targetRow := so.target.SliceRow(i)
+		sum := vec.Sum(targetRow)
+		for j, target := range targetRow {
+			k := i*so.y.Columns + j
+			dx.Vector[k] = (so.y.Vector[k]*sum - target) * dout / so.norm
+		}
+	}
 	return dx
 }
@@ -2,6 +2,7 @@ package layer
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
 	"github.com/naronA/zero_deeplearning/num"
@@ -122,3 +123,67 @@ func TestSoftmaxWithLoss_2(t *testing.T) {
 	}
 
 }
+
+// gradientCheck は、Backwardで求めた勾配と数値微分の勾配を比較する
+// 損失はsum(Forward(x) * w)とし、wは乱数で固定する
+// shapeがnilなら行列、そうでなければ4次元の入力として扱う
+func gradientCheck(l T4DLayer, x *num.Matrix, shape []int) (vec.Vector, vec.Vector) {
+	out, outShape := toMatrix(l.Forward(fromMatrix(x, shape)))
+	w := &num.Matrix{Vector: vec.Randn(len(out.Vector)), Rows: out.Rows, Columns: out.Columns}
+	dx, _ := toMatrix(l.Backward(fromMatrix(w, outShape)))
+	numerical := numericalGradient(func() float64 {
+		y, _ := toMatrix(l.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, w.Vector))
+	}, x.Vector)
+	return dx.Vector, numerical
+}
+
+func numericalGradient(f func() float64, x vec.Vector) vec.Vector {
+	return vec.NumericalGradient(func(vec.Vector) float64 { return f() }, x)
+}
+
+func closeEnough(x1, x2 vec.Vector) bool {
+	if len(x1) != len(x2) {
+		return false
+	}
+	for i := range x1 {
+		if math.Abs(x1[i]-x2[i]) > 1e-4*math.Max(1.0, math.Abs(x2[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestConvolutionChannels は、直接計算した畳み込みと比べる
+// 1チャンネルではIm2Colの列をまとめる前と同じ結果で、複数チャンネルでも正しく計算できる
+func TestConvolutionChannels(t *testing.T) {
+	for _, C := range []int{1, 3} {
+		w, _ := num.NewRandnT4D(2, C, 3, 3)
+		b, _ := num.NewRandnMatrix(1, 2)
+		x, _ := num.NewRandnT4D(2, C, 5, 5)
+		out := NewConvolution(w, b, 2, 1).Forward(x).(num.Tensor4D)
+		for n := range out {
+			for f := range out[n] {
+				for i := 0; i < 3; i++ {
+					for j := 0; j < 3; j++ {
+						expected := b.Vector[f]
+						for c := 0; c < C; c++ {
+							for kh := 0; kh < 3; kh++ {
+								for kw := 0; kw < 3; kw++ {
+									h, v := i*2+kh-1, j*2+kw-1
+									if h >= 0 && h < 5 && v >= 0 && v < 5 {
+										expected += x[n][c].Element(h, v) * w[f][c].Element(kh, kw)
+									}
+								}
+							}
+						}
+						if actual := out[n][f].Element(i, j); math.Abs(actual-expected) > 1e-9 {
+							fmt.Println(C, n, f, i, j, actual, expected)
+							t.FailNow()
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package layer
+
+import (
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// LossLayer は、ネットワークの最後に置く損失関数の層
+// ForwardのyはNNの出力、tは教師データ
+type LossLayer interface {
+	Forward(y, t *num.Matrix) float64
+	Backward(dout float64) *num.Matrix
+}
+
+// Reduction は、要素ごとの損失のまとめ方
+type Reduction int
+
+const (
+	REDUCEMEAN Reduction = iota // 平均
+	REDUCESUM                   // 合計
+	REDUCENONE                  // まとめない（Lossesを参照する。戻り値と勾配は合計と同じ）
+)
+
+// reducer は、損失のまとめ方と逆伝搬を各損失関数で共通化する
+type reducer struct {
+	Reduction Reduction
+	// 要素ごと（KLDivLossは行ごと）の損失
+	Losses *num.Matrix
+	// 中間データ（backward時に使用）
+	grad  *num.Matrix
+	scale float64
+}
+
+// elementwise は、要素ごとの損失と勾配をfで計算してまとめる
+func (r *reducer) elementwise(y, t *num.Matrix, f func(y, t float64) (float64, float64)) float64 {
+	losses := num.Zeros(y.Rows, y.Columns)
+	grad := num.Zeros(y.Rows, y.Columns)
+	for i, v := range y.Vector {
+		losses.Vector[i], grad.Vector[i] = f(v, t.Vector[i])
+	}
+	return r.reduce(losses, grad)
+}
+
+func (r *reducer) reduce(losses, grad *num.Matrix) float64 {
+	r.Losses = losses
+	r.grad = grad
+	r.scale = 1.0
+	if r.Reduction == REDUCEMEAN {
+		r.scale = 1.0 / float64(len(losses.Vector))
+	}
+	return vec.Sum(losses.Vector) * r.scale
+}
+
+func (r *reducer) Backward(dout float64) *num.Matrix {
+	return num.Mul(r.grad, dout*r.scale)
+}
+
+// MSELoss は、0.5*(y-t)^2（vec.MeanSquaredErrorと同じく1/2を掛ける）
+type MSELoss struct {
+	reducer
+}
+
+func NewMSELoss(reduction Reduction) *MSELoss {
+	return &MSELoss{reducer{Reduction: reduction}}
+}
+
+func (l *MSELoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		d := y - t
+		return 0.5 * d * d, d
+	})
+}
+
+// MAELoss は、|y-t|
+type MAELoss struct {
+	reducer
+}
+
+func NewMAELoss(reduction Reduction) *MAELoss {
+	return &MAELoss{reducer{Reduction: reduction}}
+}
+
+func (l *MAELoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		d := y - t
+		return math.Abs(d), sign(d)
+	})
+}
+
+// HuberLoss は、|y-t|がDelta以下なら二乗誤差、それより大きければ絶対誤差になる
+type HuberLoss struct {
+	Delta float64
+	reducer
+}
+
+func NewHuberLoss(delta float64, reduction Reduction) *HuberLoss {
+	return &HuberLoss{
+		Delta:   delta,
+		reducer: reducer{Reduction: reduction},
+	}
+}
+
+func (l *HuberLoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		d := y - t
+		if math.Abs(d) <= l.Delta {
+			return 0.5 * d * d, d
+		}
+		return l.Delta * (math.Abs(d) - 0.5*l.Delta), l.Delta * sign(d)
+	})
+}
+
+// BCEWithLogitsLoss は、sigmoidと2値の交差エントロピー誤差をまとめた層
+// yはsigmoidを通す前の値、tは0〜1
+type BCEWithLogitsLoss struct {
+	reducer
+}
+
+func NewBCEWithLogitsLoss(reduction Reduction) *BCEWithLogitsLoss {
+	return &BCEWithLogitsLoss{reducer{Reduction: reduction}}
+}
+
+func (l *BCEWithLogitsLoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		// -t*log(sigmoid(y)) - (1-t)*log(1-sigmoid(y)) をexpがあふれないように変形したもの
+		loss := math.Max(y, 0) - y*t + math.Log1p(math.Exp(-math.Abs(y)))
+		return loss, sigmoid(y) - t
+	})
+}
+
+// HingeLoss は、max(0, 1-t*y)
+// tは-1か1
+type HingeLoss struct {
+	reducer
+}
+
+func NewHingeLoss(reduction Reduction) *HingeLoss {
+	return &HingeLoss{reducer{Reduction: reduction}}
+}
+
+func (l *HingeLoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		margin := 1 - t*y
+		if margin <= 0 {
+			return 0, 0
+		}
+		return margin, -t
+	})
+}
+
+// KLDivLoss は、教師の確率分布tとsoftmax(y)のKLダイバージェンス
+// 損失は行（サンプル）ごとなので、REDUCEMEANはバッチサイズで割る
+type KLDivLoss struct {
+	reducer
+}
+
+func NewKLDivLoss(reduction Reduction) *KLDivLoss {
+	return &KLDivLoss{reducer{Reduction: reduction}}
+}
+
+func (l *KLDivLoss) Forward(y, t *num.Matrix) float64 {
+	losses := num.Zeros(y.Rows, 1)
+	grad := num.Zeros(y.Rows, y.Columns)
+	for i := 0; i < y.Rows; i++ {
+		yRow, tRow := y.SliceRow(i), t.SliceRow(i)
+		lse := logSumExp(yRow)
+		tSum := vec.Sum(tRow)
+		for j, v := range yRow {
+			if tRow[j] > 0 {
+				losses.Vector[i] += tRow[j] * (math.Log(tRow[j]) - (v - lse))
+			}
+			grad.Vector[i*y.Columns+j] = math.Exp(v-lse)*tSum - tRow[j]
+		}
+	}
+	return l.reduce(losses, grad)
+}
+
+// FocalLoss は、分類しやすいサンプルの損失を(1-pt)^Gammaで小さくした2値の交差エントロピー誤差
+// yはsigmoidを通す前の値、tは0〜1、Alphaは正例の重み
+// https://arxiv.org/abs/1708.02002
+type FocalLoss struct {
+	Alpha float64
+	Gamma float64
+	reducer
+}
+
+func NewFocalLoss(alpha, gamma float64, reduction Reduction) *FocalLoss {
+	return &FocalLoss{
+		Alpha:   alpha,
+		Gamma:   gamma,
+		reducer: reducer{Reduction: reduction},
+	}
+}
+
+func (l *FocalLoss) Forward(y, t *num.Matrix) float64 {
+	return l.elementwise(y, t, func(y, t float64) (float64, float64) {
+		p := sigmoid(y)
+		// log(p)とlog(1-p)
+		logP := -math.Log1p(math.Exp(-math.Abs(y))) - math.Max(-y, 0)
+		logQ := -math.Log1p(math.Exp(-math.Abs(y))) - math.Max(y, 0)
+		pos := l.Alpha * t
+		neg := (1 - l.Alpha) * (1 - t)
+		loss := -pos*math.Pow(1-p, l.Gamma)*logP - neg*math.Pow(p, l.Gamma)*logQ
+		grad := pos*math.Pow(1-p, l.Gamma)*(l.Gamma*p*logP-(1-p)) +
+			neg*math.Pow(p, l.Gamma)*(p-l.Gamma*(1-p)*logQ)
+		return loss, grad
+	})
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+func logSumExp(x vec.Vector) float64 {
+	max := math.Inf(-1)
+	for _, v := range x {
+		max = math.Max(max, v)
+	}
+	sum := 0.0
+	for _, v := range x {
+		sum += math.Exp(v - max)
+	}
+	return max + math.Log(sum)
+}
@@ -0,0 +1,227 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestLossGradient(t *testing.T) {
+	y, _ := num.NewRandnMatrix(4, 3)
+	regression, _ := num.NewRandnMatrix(4, 3)
+	binary, _ := num.NewMatrix(4, 3, vec.Vector{1, 0, 0, 1, 1, 0, 0.3, 0.7, 1, 0, 1, 0})
+	signs, _ := num.NewMatrix(4, 3, vec.Vector{1, -1, -1, 1, 1, -1, 1, -1, 1, -1, 1, -1})
+	dist := num.Softmax(regression)
+
+	for _, reduction := range []Reduction{REDUCEMEAN, REDUCESUM, REDUCENONE} {
+		cases := []struct {
+			name string
+			loss LossLayer
+			t    *num.Matrix
+		}{
+			{"MSE", NewMSELoss(reduction), regression},
+			{"MAE", NewMAELoss(reduction), regression},
+			{"Huber", NewHuberLoss(0.5, reduction), regression},
+			{"BCEWithLogits", NewBCEWithLogitsLoss(reduction), binary},
+			{"Hinge", NewHingeLoss(reduction), signs},
+			{"KLDiv", NewKLDivLoss(reduction), dist},
+			{"Focal", NewFocalLoss(0.25, 2.0, reduction), binary},
+		}
+		for _, c := range cases {
+			c.loss.Forward(y, c.t)
+			analytic := c.loss.Backward(1.0)
+			numerical := numericalGradient(func() float64 {
+				return c.loss.Forward(y, c.t)
+			}, y.Vector)
+			if !closeEnough(analytic.Vector, numerical) {
+				fmt.Println(c.name, reduction, analytic, numerical)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestLossReduction(t *testing.T) {
+	y, _ := num.NewRandnMatrix(4, 3)
+	target, _ := num.NewRandnMatrix(4, 3)
+
+	sum := NewMSELoss(REDUCESUM).Forward(y, target)
+	expected := vec.MeanSquaredError(y.Vector, target.Vector)
+	if math.Abs(sum-expected) > 1e-12 {
+		fmt.Println(sum, expected)
+		t.Fail()
+	}
+	mean := NewMSELoss(REDUCEMEAN).Forward(y, target)
+	if math.Abs(mean-expected/12) > 1e-12 {
+		fmt.Println(mean, expected/12)
+		t.Fail()
+	}
+	none := NewMSELoss(REDUCENONE)
+	none.Forward(y, target)
+	if none.Losses.Rows != 4 || none.Losses.Columns != 3 {
+		fmt.Println(none.Losses)
+		t.Fail()
+	}
+
+	// KLダイバージェンスは行ごとの損失になる
+	kl := NewKLDivLoss(REDUCENONE)
+	kl.Forward(y, num.Softmax(target))
+	if kl.Losses.Rows != 4 || kl.Losses.Columns != 1 {
+		fmt.Println(kl.Losses)
+		t.Fail()
+	}
+}
+
+func TestKLDivLossSameDistribution(t *testing.T) {
+	y, _ := num.NewRandnMatrix(3, 4)
+	loss := NewKLDivLoss(REDUCEMEAN).Forward(y, num.Softmax(y))
+	if math.Abs(loss) > 1e-12 {
+		fmt.Println(loss)
+		t.Fail()
+	}
+}
+
+// Gamma = 0のFocalLossは、Alphaで重み付けしたBCEWithLogitsLossになる
+func TestFocalLossWithoutFocusing(t *testing.T) {
+	y, _ := num.NewRandnMatrix(3, 4)
+	target, _ := num.NewMatrix(3, 4, vec.Vector{1, 0, 1, 0, 0, 0, 1, 1, 1, 0, 0, 1})
+	focal := NewFocalLoss(0.5, 0, REDUCESUM).Forward(y, target)
+	bce := NewBCEWithLogitsLoss(REDUCESUM).Forward(y, target)
+	if math.Abs(focal-0.5*bce) > 1e-12 {
+		fmt.Println(focal, 0.5*bce)
+		t.Fail()
+	}
+}
+
+func TestBCEWithLogitsLossOverflow(t *testing.T) {
+	y, _ := num.NewMatrix(1, 2, vec.Vector{1000, -1000})
+	target, _ := num.NewMatrix(1, 2, vec.Vector{1, 0})
+	loss := NewBCEWithLogitsLoss(REDUCESUM).Forward(y, target)
+	if loss != 0 {
+		fmt.Println(loss)
+		t.Fail()
+	}
+}
+
+func TestSoftmaxWithLossLabels(t *testing.T) {
+	x, _ := num.NewRandnMatrix(3, 4)
+	onehot, _ := num.NewMatrix(3, 4, vec.Vector{
+		0, 0, 1, 0,
+		1, 0, 0, 0,
+		0, 0, 0, 1,
+	})
+	dense := NewSfotmaxWithLoss()
+	expected := dense.Forward(x, onehot)
+	expectedDx := dense.Backward(1.0)
+
+	sparse := NewSfotmaxWithLoss()
+	actual := sparse.ForwardLabels(x, []int{2, 0, 3})
+	actualDx := sparse.Backward(1.0)
+	// 密な教師データの損失はlogの中に微小な値を足しているので、完全には一致しない
+	if !closeEnough(vec.Vector{actual}, vec.Vector{expected}) || !closeEnough(actualDx.Vector, expectedDx.Vector) {
+		fmt.Println(actual, expected, actualDx, expectedDx)
+		t.Fail()
+	}
+
+	// 無視したサンプルは損失にも勾配にも影響しない
+	ignored := NewSfotmaxWithLoss()
+	ignored.IgnoreIndex, ignored.HasIgnoreIndex = 9, true
+	x2, _ := num.NewMatrix(4, 4, append(append(vec.Vector{}, x.Vector...), 5, -3, 2, 0))
+	actual = ignored.ForwardLabels(x2, []int{2, 0, 3, 9})
+	actualDx = ignored.Backward(1.0)
+	if !closeEnough(vec.Vector{actual}, vec.Vector{expected}) || !closeEnough(actualDx.Vector, append(expectedDx.Vector, 0, 0, 0, 0)) {
+		fmt.Println(actual, expected, actualDx, expectedDx)
+		t.Fail()
+	}
+}
+
+func TestSoftmaxWithLossLabelsInvalid(t *testing.T) {
+	x, _ := num.NewRandnMatrix(3, 4)
+	cases := map[string][]int{
+		"label 4 at index 1 is out of range for 4 classes": {2, 4, 0},
+		"2 labels for 3 samples":                           {2, 0},
+	}
+	for expected, labels := range cases {
+		func() {
+			defer func() {
+				if r := recover(); r != expected {
+					fmt.Println(labels, r)
+					t.Fail()
+				}
+			}()
+			NewSfotmaxWithLoss().ForwardLabels(x, labels)
+		}()
+	}
+}
+
+func TestSoftmaxWithLossLabelSmoothing(t *testing.T) {
+	x, _ := num.NewMatrix(1, 2, vec.Vector{1, 3})
+	so := NewSfotmaxWithLoss()
+	so.LabelSmoothing = 0.2
+	actual := so.ForwardLabels(x, []int{0})
+	// 教師データは (0.9, 0.1)
+	y := num.Softmax(x)
+	expected := -0.9*math.Log(y.Vector[0]) - 0.1*math.Log(y.Vector[1])
+	if math.Abs(actual-expected) > 1e-12 {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+}
+
+func TestSoftmaxWithLossGradient(t *testing.T) {
+	x, _ := num.NewRandnMatrix(4, 3)
+	so := NewSfotmaxWithLoss()
+	so.LabelSmoothing = 0.1
+	so.ClassWeights = vec.Vector{0.2, 1.0, 3.0}
+	so.IgnoreIndex, so.HasIgnoreIndex = 1, true
+	labels := []int{0, 1, 2, 2}
+
+	so.ForwardLabels(x, labels)
+	analytic := so.Backward(1.0)
+	numerical := numericalGradient(func() float64 {
+		return so.ForwardLabels(x, labels)
+	}, x.Vector)
+	if !closeEnough(analytic.Vector, numerical) {
+		fmt.Println(analytic, numerical)
+		t.Fail()
+	}
+
+	// 重みは正規化されるので、1サンプルなら重みの大きさに依らない
+	so.LabelSmoothing = 0
+	onehot, _ := num.NewMatrix(1, 3, vec.Vector{0, 0, 1})
+	row, _ := num.NewMatrix(1, 3, x.SliceRow(0))
+	weighted := so.Forward(row, onehot)
+	so.ClassWeights = vec.Vector{1, 1, 1}
+	if math.Abs(weighted-so.Forward(row, onehot)) > 1e-12 {
+		fmt.Println(weighted)
+		t.Fail()
+	}
+}
+
+func TestSoftmaxWithLossZeroValue(t *testing.T) {
+	x, _ := num.NewMatrix(2, 3, vec.Vector{1, 2, 3, 0, -1, 2})
+	// 設定しなければ、クラス0も損失に含める
+	so := &SoftmaxWithLoss{}
+	if loss := so.ForwardLabels(x, []int{0, -1}); loss == 0 {
+		t.Fail()
+	}
+	expected := -math.Log(num.Softmax(x).Vector[0])
+	if math.Abs(so.loss-expected) > 1e-12 {
+		fmt.Println(so.loss, expected)
+		t.Fail()
+	}
+
+	// one-hotの教師データでも、勾配はdoutに比例し、1サンプルならそのまま
+	onehot, _ := num.NewMatrix(1, 3, vec.Vector{0, 0, 1})
+	x1, _ := num.NewMatrix(1, 3, vec.Vector{1, 2, 3})
+	so.Forward(x1, onehot)
+	dx := so.Backward(2.0)
+	y := num.Softmax(x1)
+	if !closeEnough(dx.Vector, num.Mul(num.Sub(y, onehot), 2.0).Vector) {
+		fmt.Println(dx, y)
+		t.Fail()
+	}
+}
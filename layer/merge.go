@@ -0,0 +1,109 @@
+package layer
+
+import (
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// MultiInputLayer は、複数の入力を受け取る層
+type MultiInputLayer interface {
+	Forward([]interface{}) interface{}
+	Backward(interface{}) []interface{}
+}
+
+// ElementwiseAdd は、同じ形の入力を足し合わせる（残差接続など）
+type ElementwiseAdd struct {
+	N int
+}
+
+func NewElementwiseAdd() *ElementwiseAdd {
+	return &ElementwiseAdd{}
+}
+
+func (ad *ElementwiseAdd) Forward(xs []interface{}) interface{} {
+	ad.N = len(xs)
+	sum := elementwise(xs[0], func(_ int, v float64) float64 { return v })
+	for _, x := range xs[1:] {
+		flat := flattenTensor(x)
+		sum = elementwise(sum, func(i int, v float64) float64 { return v + flat[i] })
+	}
+	return sum
+}
+
+func (ad *ElementwiseAdd) Backward(dout interface{}) []interface{} {
+	dxs := make([]interface{}, ad.N)
+	for i := range dxs {
+		dxs[i] = dout
+	}
+	return dxs
+}
+
+// Concatenate は、入力をチャンネル方向につなげる
+// 行列とTensor3Dは最後の軸、Tensor4Dは2番目の軸（チャンネル）でつなげる
+type Concatenate struct {
+	// 中間データ（backward時に使用）
+	Sizes []int
+}
+
+func NewConcatenate() *Concatenate {
+	return &Concatenate{}
+}
+
+func (cc *Concatenate) Forward(xs []interface{}) interface{} {
+	cc.Sizes = make([]int, len(xs))
+	switch xs[0].(type) {
+	case *num.Matrix:
+		ms := make([]*num.Matrix, len(xs))
+		for i, x := range xs {
+			ms[i] = x.(*num.Matrix)
+			cc.Sizes[i] = ms[i].Columns
+		}
+		return hstack(ms...)
+	case num.Tensor3D:
+		out := make(num.Tensor3D, len(xs[0].(num.Tensor3D)))
+		for n := range out {
+			ms := make([]*num.Matrix, len(xs))
+			for i, x := range xs {
+				ms[i] = x.(num.Tensor3D)[n]
+				cc.Sizes[i] = ms[i].Columns
+			}
+			out[n] = hstack(ms...)
+		}
+		return out
+	case num.Tensor4D:
+		out := make(num.Tensor4D, len(xs[0].(num.Tensor4D)))
+		for i, x := range xs {
+			t4d := x.(num.Tensor4D)
+			cc.Sizes[i] = len(t4d[0])
+			for n := range out {
+				out[n] = append(out[n], t4d[n]...)
+			}
+		}
+		return out
+	}
+	panic(xs[0])
+}
+
+func (cc *Concatenate) Backward(idout interface{}) []interface{} {
+	dxs := make([]interface{}, len(cc.Sizes))
+	from := 0
+	for i, size := range cc.Sizes {
+		switch dout := idout.(type) {
+		case *num.Matrix:
+			dxs[i] = sliceCols(dout, from, from+size)
+		case num.Tensor3D:
+			dx := make(num.Tensor3D, len(dout))
+			for n, m := range dout {
+				dx[n] = sliceCols(m, from, from+size)
+			}
+			dxs[i] = dx
+		case num.Tensor4D:
+			dx := make(num.Tensor4D, len(dout))
+			for n, t3d := range dout {
+				dx[n] = t3d[from : from+size]
+			}
+			dxs[i] = dx
+		}
+		from += size
+	}
+	return dxs
+}
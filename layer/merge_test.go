@@ -0,0 +1,34 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+func TestConcatenateT4D(t *testing.T) {
+	x1, _ := num.NewRandnT4D(2, 1, 3, 3)
+	x2, _ := num.NewRandnT4D(2, 2, 3, 3)
+	cc := NewConcatenate()
+	out := cc.Forward([]interface{}{x1, x2}).(num.Tensor4D)
+	if len(out[0]) != 3 || num.NotEqual(out[1][0], x1[1][0]) || num.NotEqual(out[1][2], x2[1][1]) {
+		fmt.Println(out)
+		t.Fail()
+	}
+	dxs := cc.Backward(out)
+	if !num.EqualT4D(dxs[0].(num.Tensor4D), x1) || !num.EqualT4D(dxs[1].(num.Tensor4D), x2) {
+		fmt.Println(dxs)
+		t.Fail()
+	}
+}
+
+func TestElementwiseAdd(t *testing.T) {
+	x1, _ := num.NewRandnT4D(2, 2, 3, 3)
+	x2, _ := num.NewRandnT4D(2, 2, 3, 3)
+	out := NewElementwiseAdd().Forward([]interface{}{x1, x2}).(num.Tensor4D)
+	if !num.EqualT4D(out, num.AddT4D(x1, x2)) {
+		fmt.Println(out)
+		t.Fail()
+	}
+}
@@ -0,0 +1,209 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// LayerNormalization は、サンプルごとに全特徴量で正規化する
+// https://arxiv.org/abs/1607.06450
+// Gamma, Betaは(1, D)で、4次元入力の場合はD = C*H*W
+type LayerNormalization struct {
+	Gamma  *num.Matrix // パラメタ
+	Beta   *num.Matrix // パラメタ
+	Dgamma *num.Matrix
+	Dbeta  *num.Matrix
+	// 中間データ（backward時に使用）
+	Xn    *num.Matrix
+	Std   vec.Vector
+	shape []int
+}
+
+func NewLayerNormalization(gamma, beta *num.Matrix) *LayerNormalization {
+	return &LayerNormalization{
+		Gamma: gamma,
+		Beta:  beta,
+	}
+}
+
+func (ln *LayerNormalization) Forward(x interface{}) interface{} {
+	mat, shape := toMatrix(x)
+	out, xn, std := groupNormForward(mat, 1, ln.Gamma, ln.Beta)
+	ln.Xn = xn
+	ln.Std = std
+	ln.shape = shape
+	return fromMatrix(out, shape)
+}
+
+func (ln *LayerNormalization) Backward(dout interface{}) interface{} {
+	mat, _ := toMatrix(dout)
+	dx, dgamma, dbeta := groupNormBackward(mat, ln.Xn, ln.Std, 1, ln.Gamma)
+	ln.Dgamma = dgamma
+	ln.Dbeta = dbeta
+	return fromMatrix(dx, ln.shape)
+}
+
+// GroupNormalization は、チャンネルをGroups個に分けてグループごとに正規化する
+// https://arxiv.org/abs/1803.08494
+// Gamma, Betaはチャンネルごとの(1, C)
+// 行列(N, D)の入力は(N, C, D/C)とみなす
+type GroupNormalization struct {
+	Groups int
+	Gamma  *num.Matrix // パラメタ
+	Beta   *num.Matrix // パラメタ
+	Dgamma *num.Matrix
+	Dbeta  *num.Matrix
+	// 中間データ（backward時に使用）
+	Xn    *num.Matrix
+	Std   vec.Vector
+	shape []int
+}
+
+func NewGroupNormalization(groups int, gamma, beta *num.Matrix) *GroupNormalization {
+	if gamma.Columns%groups != 0 {
+		panic(fmt.Sprintf("channels %d is not divisible by groups %d", gamma.Columns, groups))
+	}
+	return &GroupNormalization{
+		Groups: groups,
+		Gamma:  gamma,
+		Beta:   beta,
+	}
+}
+
+func (gn *GroupNormalization) Forward(x interface{}) interface{} {
+	mat, shape := toMatrix(x)
+	out, xn, std := groupNormForward(mat, gn.Groups, gn.Gamma, gn.Beta)
+	gn.Xn = xn
+	gn.Std = std
+	gn.shape = shape
+	return fromMatrix(out, shape)
+}
+
+func (gn *GroupNormalization) Backward(dout interface{}) interface{} {
+	mat, _ := toMatrix(dout)
+	dx, dgamma, dbeta := groupNormBackward(mat, gn.Xn, gn.Std, gn.Groups, gn.Gamma)
+	gn.Dgamma = dgamma
+	gn.Dbeta = dbeta
+	return fromMatrix(dx, gn.shape)
+}
+
+// InstanceNormalization は、サンプル・チャンネルごとに正規化する
+// https://arxiv.org/abs/1607.08022
+// GroupNormalizationでGroups = Cとしたものと同じ
+type InstanceNormalization struct {
+	Gamma  *num.Matrix // パラメタ
+	Beta   *num.Matrix // パラメタ
+	Dgamma *num.Matrix
+	Dbeta  *num.Matrix
+	// 中間データ（backward時に使用）
+	Xn    *num.Matrix
+	Std   vec.Vector
+	shape []int
+}
+
+func NewInstanceNormalization(gamma, beta *num.Matrix) *InstanceNormalization {
+	return &InstanceNormalization{
+		Gamma: gamma,
+		Beta:  beta,
+	}
+}
+
+func (in *InstanceNormalization) Forward(x interface{}) interface{} {
+	mat, shape := toMatrix(x)
+	out, xn, std := groupNormForward(mat, in.Gamma.Columns, in.Gamma, in.Beta)
+	in.Xn = xn
+	in.Std = std
+	in.shape = shape
+	return fromMatrix(out, shape)
+}
+
+func (in *InstanceNormalization) Backward(dout interface{}) interface{} {
+	mat, _ := toMatrix(dout)
+	dx, dgamma, dbeta := groupNormBackward(mat, in.Xn, in.Std, in.Gamma.Columns, in.Gamma)
+	in.Dgamma = dgamma
+	in.Dbeta = dbeta
+	return fromMatrix(dx, in.shape)
+}
+
+// groupNormForward は、(N, D)の各行をgroups個の区間に分けて正規化し、
+// gammaの列数をチャンネル数としてチャンネルごとにスケール・シフトする
+func groupNormForward(x *num.Matrix, groups int, gamma, beta *num.Matrix) (*num.Matrix, *num.Matrix, vec.Vector) {
+	n, d := x.Rows, x.Columns
+	channels := gamma.Columns
+	if d%channels != 0 || channels%groups != 0 {
+		panic(fmt.Sprintf("cannot normalize %d features with %d channels and %d groups", d, channels, groups))
+	}
+	spatial := d / channels
+	size := d / groups
+
+	xn := num.ZerosLike(x)
+	out := num.ZerosLike(x)
+	std := vec.Zeros(n * groups)
+	for i := 0; i < n; i++ {
+		for g := 0; g < groups; g++ {
+			begin := i*d + g*size
+			seg := x.Vector[begin : begin+size]
+			mu := vec.Sum(seg) / float64(size)
+			vari := 0.0
+			for _, v := range seg {
+				vari += (v - mu) * (v - mu)
+			}
+			vari /= float64(size)
+			s := math.Sqrt(vari + 10e-7)
+			std[i*groups+g] = s
+			for j, v := range seg {
+				xn.Vector[begin+j] = (v - mu) / s
+			}
+		}
+		for j := 0; j < d; j++ {
+			c := j / spatial
+			out.Vector[i*d+j] = gamma.Vector[c]*xn.Vector[i*d+j] + beta.Vector[c]
+		}
+	}
+	return out, xn, std
+}
+
+// groupNormBackward は、groupNormForwardの逆伝搬
+// dx = (dxn - mean(dxn) - xn * mean(dxn * xn)) / std
+func groupNormBackward(dout, xn *num.Matrix, std vec.Vector, groups int, gamma *num.Matrix) (*num.Matrix, *num.Matrix, *num.Matrix) {
+	n, d := dout.Rows, dout.Columns
+	channels := gamma.Columns
+	spatial := d / channels
+	size := d / groups
+
+	dgamma := num.Zeros(1, channels)
+	dbeta := num.Zeros(1, channels)
+	dxn := num.ZerosLike(dout)
+	for i := 0; i < n; i++ {
+		for j := 0; j < d; j++ {
+			c := j / spatial
+			e := dout.Vector[i*d+j]
+			dbeta.Vector[c] += e
+			dgamma.Vector[c] += e * xn.Vector[i*d+j]
+			dxn.Vector[i*d+j] = e * gamma.Vector[c]
+		}
+	}
+
+	dx := num.ZerosLike(dout)
+	for i := 0; i < n; i++ {
+		for g := 0; g < groups; g++ {
+			begin := i*d + g*size
+			meanDxn := 0.0
+			meanDxnXn := 0.0
+			for j := begin; j < begin+size; j++ {
+				meanDxn += dxn.Vector[j]
+				meanDxnXn += dxn.Vector[j] * xn.Vector[j]
+			}
+			meanDxn /= float64(size)
+			meanDxnXn /= float64(size)
+			s := std[i*groups+g]
+			for j := begin; j < begin+size; j++ {
+				dx.Vector[j] = (dxn.Vector[j] - meanDxn - xn.Vector[j]*meanDxnXn) / s
+			}
+		}
+	}
+	return dx, dgamma, dbeta
+}
@@ -0,0 +1,138 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func ones(n int) *num.Matrix {
+	return num.Add(num.Zeros(1, n), 1.0)
+}
+
+func TestLayerNormalization(t *testing.T) {
+	x, _ := num.NewMatrix(2, 3, vec.Vector{
+		1, 2, 3,
+		2, 4, 6,
+	})
+	ln := NewLayerNormalization(ones(3), num.Zeros(1, 3))
+	actual := ln.Forward(x).(*num.Matrix)
+	expected, _ := num.NewMatrix(2, 3, vec.Vector{
+		-1.224743952833969, 0, 1.224743952833969,
+		-1.2247446417519903, 0, 1.2247446417519903,
+	})
+	if num.NotEqual(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	// バッチサイズ1でも同じ結果になる
+	single, _ := num.NewMatrix(1, 3, vec.Vector{1, 2, 3})
+	actual = ln.Forward(single).(*num.Matrix)
+	if vec.NotEqual(actual.Vector, expected.SliceRow(0)) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+}
+
+func TestLayerNormalizationGradient(t *testing.T) {
+	gamma, _ := num.NewRandnMatrix(1, 12)
+	beta, _ := num.NewRandnMatrix(1, 12)
+	ln := NewLayerNormalization(gamma, beta)
+
+	x, _ := num.NewRandnMatrix(3, 12)
+	dx, numerical := gradientCheck(ln, x, nil)
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+
+	x4d, _ := num.NewRandnMatrix(2, 12)
+	dx, numerical = gradientCheck(ln, x4d, []int{2, 3, 2, 2})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+
+	shape := []int{2, 3, 2, 2}
+	loss := func() float64 {
+		y, _ := toMatrix(ln.Forward(fromMatrix(x4d, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}
+	ngamma := numericalGradient(loss, gamma.Vector)
+	nbeta := numericalGradient(loss, beta.Vector)
+	y, _ := toMatrix(ln.Forward(fromMatrix(x4d, shape)))
+	ln.Backward(fromMatrix(num.Mul(y, 2.0), shape))
+	if !closeEnough(ln.Dgamma.Vector, ngamma) || !closeEnough(ln.Dbeta.Vector, nbeta) {
+		fmt.Println(ln.Dgamma, ngamma, ln.Dbeta, nbeta)
+		t.Fail()
+	}
+}
+
+func TestGroupNormalizationGradient(t *testing.T) {
+	gamma, _ := num.NewRandnMatrix(1, 4)
+	beta, _ := num.NewRandnMatrix(1, 4)
+	gn := NewGroupNormalization(2, gamma, beta)
+
+	x, _ := num.NewRandnMatrix(2, 36)
+	shape := []int{2, 4, 3, 3}
+	dx, numerical := gradientCheck(gn, x, shape)
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+
+	loss := func() float64 {
+		y, _ := toMatrix(gn.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}
+	ngamma := numericalGradient(loss, gamma.Vector)
+	nbeta := numericalGradient(loss, beta.Vector)
+	y, _ := toMatrix(gn.Forward(fromMatrix(x, shape)))
+	gn.Backward(fromMatrix(num.Mul(y, 2.0), shape))
+	if !closeEnough(gn.Dgamma.Vector, ngamma) || !closeEnough(gn.Dbeta.Vector, nbeta) {
+		fmt.Println(gn.Dgamma, ngamma, gn.Dbeta, nbeta)
+		t.Fail()
+	}
+
+	// 行列(N, C*L)の入力
+	xm, _ := num.NewRandnMatrix(3, 8)
+	dx, numerical = gradientCheck(gn, xm, nil)
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+}
+
+func TestInstanceNormalization(t *testing.T) {
+	gamma, _ := num.NewRandnMatrix(1, 3)
+	beta, _ := num.NewRandnMatrix(1, 3)
+	in := NewInstanceNormalization(gamma, beta)
+	gn := NewGroupNormalization(3, gamma, beta)
+
+	x4d, _ := num.NewRandnT4D(2, 3, 4, 4)
+	actual := in.Forward(x4d).(num.Tensor4D)
+	expected := gn.Forward(x4d).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+	// チャンネルごとに平均0になる
+	for _, t3d := range in.Xn.ReshapeTo4D(2, 3, 4, 4) {
+		for _, mat := range t3d {
+			if mean := num.MeanAll(mat); mean > 1e-7 || mean < -1e-7 {
+				fmt.Println(mean)
+				t.Fail()
+			}
+		}
+	}
+
+	x, _ := num.NewRandnMatrix(2, 48)
+	dx, numerical := gradientCheck(in, x, []int{2, 3, 4, 4})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+}
@@ -0,0 +1,41 @@
+package layer
+
+import (
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// Padding2D は、(N, C, H, W)の各特徴マップをパディングする層
+// REFLECTPAD・CIRCULARPADの幅は入力サイズ未満にする
+type Padding2D struct {
+	Padding *num.Padding
+}
+
+func NewPadding2D(p *num.Padding) *Padding2D {
+	return &Padding2D{
+		Padding: p,
+	}
+}
+
+func (p *Padding2D) Forward(x interface{}) interface{} {
+	return x.(num.Tensor4D).PadWith(p.Padding)
+}
+
+func (p *Padding2D) Backward(dout interface{}) interface{} {
+	return dout.(num.Tensor4D).UnpadWith(p.Padding)
+}
+
+// modePadding は、ゼロ以外のパディングを事前に行うための設定を返す
+// ゼロパディングはim2colで行うのでnil
+func modePadding(top, bottom, left, right int, mode num.PadMode, value float64) *num.Padding {
+	if mode == num.CONSTANTPAD && value == 0 {
+		return nil
+	}
+	return &num.Padding{
+		Top:    top,
+		Bottom: bottom,
+		Left:   left,
+		Right:  right,
+		Mode:   mode,
+		Value:  value,
+	}
+}
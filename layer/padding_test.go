@@ -0,0 +1,83 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+func TestPadding2DGradient(t *testing.T) {
+	modes := []num.PadMode{num.CONSTANTPAD, num.REFLECTPAD, num.REPLICATEPAD, num.CIRCULARPAD}
+	for _, mode := range modes {
+		pad := NewPadding2D(&num.Padding{Top: 2, Bottom: 1, Left: 0, Right: 3, Mode: mode, Value: 0.5})
+		x, _ := num.NewRandnMatrix(2, 2*3*4)
+		analytic, numerical := gradientCheck(pad, x, []int{2, 2, 3, 4})
+		if !closeEnough(analytic, numerical) {
+			fmt.Println(mode, analytic, numerical)
+			t.Fail()
+		}
+	}
+}
+
+// 畳み込みのPadModeは、Padding2Dでパディングしてから畳み込むのと同じになる
+func TestConvolutionPadMode(t *testing.T) {
+	w, _ := num.NewRandnT4D(2, 3, 3, 3)
+	b, _ := num.NewRandnMatrix(1, 2)
+	x, _ := num.NewRandnT4D(2, 3, 5, 5)
+	pad := NewPadding2D(&num.Padding{Top: 1, Bottom: 1, Left: 1, Right: 1, Mode: num.REFLECTPAD})
+
+	conv := NewConvolution(w, b, 1, 1)
+	conv.PadMode = num.REFLECTPAD
+	expected := NewConvolution(w, b, 1, 0).Forward(pad.Forward(x)).(num.Tensor4D)
+	actual := conv.Forward(x).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	conv2d := NewConv2D(w, b, &Conv2DParams{SamePadding: true, PadMode: num.REFLECTPAD})
+	actual = conv2d.Forward(x).(num.Tensor4D)
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+	checkConv2D(t, conv2d, w, func() num.Tensor4D { return conv2d.DW }, 2, 3, 5, 4)
+
+	conv.Forward(x)
+	conv2d.Forward(x)
+	dout, _ := num.NewRandnT4D(2, 2, 5, 5)
+	dx := conv.Backward(dout).(num.Tensor4D)
+	dx2d := conv2d.Backward(dout).(num.Tensor4D)
+	if !num.EqualT4D(dx, dx2d) {
+		fmt.Println(dx, dx2d)
+		t.Fail()
+	}
+}
+
+func TestPoolingPadMode(t *testing.T) {
+	x, _ := num.NewRandnMatrix(2, 2*4*4)
+	shape := []int{2, 2, 4, 4}
+
+	avg := NewAveragePooling(3, 3, 1, 1)
+	avg.PadMode = num.REPLICATEPAD
+	analytic, numerical := gradientCheck(avg, x, shape)
+	if !closeEnough(analytic, numerical) {
+		fmt.Println(analytic, numerical)
+		t.Fail()
+	}
+
+	// 定数パディングで十分大きな値を埋めると、端の出力はその値になる
+	pool := NewPooling(2, 2, 2, 1)
+	pool.PadValue = 100
+	out := pool.Forward(fromMatrix(x, shape)).(num.Tensor4D)
+	if len(out[0]) != 2 || out[0][0].Rows != 3 || out[0][0].Columns != 3 || out[1][1].Element(0, 0) != 100 {
+		fmt.Println(out)
+		t.Fail()
+	}
+	analytic, numerical = gradientCheck(pool, x, shape)
+	if !closeEnough(analytic, numerical) {
+		fmt.Println(analytic, numerical)
+		t.Fail()
+	}
+}
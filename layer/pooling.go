@@ -9,9 +9,13 @@ type Pooling struct {
 	PoolW  int
 	Stride int
 	Pad    int
+	// ゼロ以外のパディング（ゼロ値ならゼロパディング）
+	PadMode  num.PadMode
+	PadValue float64
 
-	X      num.Tensor4D
-	ArgMax []int
+	X       num.Tensor4D // パディング済み
+	ArgMax  []int
+	Padding *num.Padding
 }
 
 func NewPooling(poolh, poolw, stride, pad int) *Pooling {
@@ -25,10 +29,14 @@ func NewPooling(poolh, poolw, stride, pad int) *Pooling {
 
 func (p *Pooling) Forward(ix interface{}) interface{} {
 	x := ix.(num.Tensor4D)
+	p.Padding = modePadding(p.Pad, p.Pad, p.Pad, p.Pad, p.PadMode, p.PadValue)
+	if p.Padding != nil {
+		x = x.PadWith(p.Padding)
+	}
 	N, C, H, W := x.Shape()
-	outH := 1 + (H-p.PoolH)/p.Stride
-	outW := 1 + (W-p.PoolW)/p.Stride
-	col := x.Im2Col(p.PoolH, p.PoolW, p.Stride, p.Pad)
+	outH := 1 + (H+2*p.pad()-p.PoolH)/p.Stride
+	outW := 1 + (W+2*p.pad()-p.PoolW)/p.Stride
+	col := x.Im2Col(p.PoolH, p.PoolW, p.Stride, p.pad())
 	col = col.Reshape(-1, p.PoolH*p.PoolW)
 
 	outVec := num.Max(col, 1)
@@ -57,6 +65,92 @@ func (p *Pooling) Backward(idout interface{}) interface{} {
 	dm1, dm2, dm3, _, _ := dmaxT5D.Shape()
 	dcol := dmaxT5D.ReshapeTo2D(dm1*dm2*dm3, -1)
 	a, b, c, d := p.X.Shape()
-	dx := dcol.Col2Img([]int{a, b, c, d}, p.PoolH, p.PoolW, p.Stride, p.Pad)
+	dx := dcol.Col2Img([]int{a, b, c, d}, p.PoolH, p.PoolW, p.Stride, p.pad())
+	if p.Padding != nil {
+		dx = dx.UnpadWith(p.Padding)
+	}
+	return dx
+}
+
+// pad は、im2colで行うゼロパディングの幅
+func (p *Pooling) pad() int {
+	if p.Padding != nil {
+		return 0
+	}
+	return p.Pad
+}
+
+// AveragePooling は、窓内の平均を取るプーリング
+// パディングした値も平均に含める
+type AveragePooling struct {
+	PoolH  int
+	PoolW  int
+	Stride int
+	Pad    int
+	// ゼロ以外のパディング（ゼロ値ならゼロパディング）
+	PadMode  num.PadMode
+	PadValue float64
+
+	XShape  []int // パディング済み
+	Window  *num.Conv2DParams
+	Padding *num.Padding
+}
+
+func NewAveragePooling(poolh, poolw, stride, pad int) *AveragePooling {
+	return &AveragePooling{
+		PoolH:  poolh,
+		PoolW:  poolw,
+		Stride: stride,
+		Pad:    pad,
+	}
+}
+
+func (p *AveragePooling) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	pad := p.Pad
+	p.Padding = modePadding(p.Pad, p.Pad, p.Pad, p.Pad, p.PadMode, p.PadValue)
+	if p.Padding != nil {
+		x = x.PadWith(p.Padding)
+		pad = 0
+	}
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	win := &num.Conv2DParams{
+		FH:        p.PoolH,
+		FW:        p.PoolW,
+		StrideH:   p.Stride,
+		StrideW:   p.Stride,
+		PadTop:    pad,
+		PadBottom: pad,
+		PadLeft:   pad,
+		PadRight:  pad,
+		DilationH: 1,
+		DilationW: 1,
+	}
+	outH, outW := win.OutputSize(H, W)
+	poolSize := p.PoolH * p.PoolW
+	col := x.Im2ColWithParams(win)
+	col = &num.Matrix{Vector: col.Vector, Rows: len(col.Vector) / poolSize, Columns: poolSize}
+	mean := num.Mean(col, 1)
+	out := &num.Matrix{Vector: mean.Vector, Rows: N * outH * outW, Columns: C}
+
+	p.XShape = []int{N, C, H, W}
+	p.Window = win
+	return matToNCHW(out, N, outH, outW)
+}
+
+func (p *AveragePooling) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	poolSize := p.PoolH * p.PoolW
+	doutMat := nchwToMat(dout)
+	dcol := num.Zeros(len(doutMat.Vector), poolSize)
+	for i, v := range doutMat.Vector {
+		for j := 0; j < poolSize; j++ {
+			dcol.Vector[i*poolSize+j] = v / float64(poolSize)
+		}
+	}
+	dx := dcol.Col2ImgWithParams(p.XShape, p.Window)
+	if p.Padding != nil {
+		dx = dx.UnpadWith(p.Padding)
+	}
 	return dx
 }
@@ -80,7 +80,7 @@ func TestPooling(t *testing.T) {
 			},
 		},
 	}
-	if !num.EqualT4D(actual, expected) {
+	if !num.EqualT4D(actual.(num.Tensor4D), expected) {
 		fmt.Println(actual, expected)
 		t.Fail()
 	}
@@ -120,8 +120,48 @@ func TestPooling(t *testing.T) {
 			},
 		},
 	}
-	if !num.EqualT4D(actual2, expected2) {
+	if !num.EqualT4D(actual2.(num.Tensor4D), expected2) {
 		fmt.Println(actual2, expected2)
 		t.Fail()
 	}
 }
+
+func TestPoolingNegativeAndPad(t *testing.T) {
+	x := num.Tensor4D{num.Tensor3D{&num.Matrix{Vector: vec.Vector{-3, -1, -4, -2}, Rows: 2, Columns: 2}}}
+	// 負の値だけの窓
+	out := NewPooling(2, 2, 2, 0).Forward(x).(num.Tensor4D)
+	if out[0][0].Rows != 1 || out[0][0].Columns != 1 || out[0][0].Vector[0] != -1 {
+		fmt.Println(out)
+		t.Fail()
+	}
+	// ゼロパディングで4x4にしたので、2x2の窓は2x2個で、どれもパディングの0を含む
+	out = NewPooling(2, 2, 2, 1).Forward(x).(num.Tensor4D)
+	if out[0][0].Rows != 2 || out[0][0].Columns != 2 || !vec.Equal(out[0][0].Vector, vec.Vector{0, 0, 0, 0}) {
+		fmt.Println(out)
+		t.Fail()
+	}
+}
+
+func TestAveragePooling(t *testing.T) {
+	t4d := SampleT4d()
+	pool := NewAveragePooling(2, 2, 2, 0)
+	actual := pool.Forward(t4d).(num.Tensor4D)
+	expected := num.Tensor4D{
+		num.Tensor3D{
+			&num.Matrix{Vector: vec.Vector{5.5, 2.5, 4.5, 4.25}, Rows: 2, Columns: 2},
+			&num.Matrix{Vector: vec.Vector{4.75, 3, 2.25, 2.75}, Rows: 2, Columns: 2},
+			&num.Matrix{Vector: vec.Vector{4.5, 1.25, 5.75, 4}, Rows: 2, Columns: 2},
+		},
+	}
+	if !num.EqualT4D(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	x, _ := num.NewRandnMatrix(2, 50)
+	dx, numerical := gradientCheck(NewAveragePooling(3, 3, 2, 1), x, []int{2, 2, 5, 5})
+	if !closeEnough(dx, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+}
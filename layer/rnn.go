@@ -0,0 +1,549 @@
+package layer
+
+import (
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// 時系列データは(N, T, D)のTensor3D（N個の(T, D)の行列）で表す
+//
+// Time〜の層は、T時刻分をまとめて順伝搬・逆伝搬する
+// 長い系列はT時刻ずつのブロックに分けて順に渡す（Truncated BPTT）
+// Statefulなら最後の隠れ状態Hを次のブロックに引き継ぎ、逆伝搬はブロック内で打ち切る
+
+// timeStep は、時刻tの(N, D)の行列を取り出す
+func timeStep(xs num.Tensor3D, t int) *num.Matrix {
+	N, D := len(xs), xs[0].Columns
+	m := num.Zeros(N, D)
+	for n, x := range xs {
+		copy(m.SliceRow(n), x.SliceRow(t))
+	}
+	return m
+}
+
+// setTimeStep は、時刻tに(N, D)の行列を書き込む
+func setTimeStep(xs num.Tensor3D, t int, m *num.Matrix) {
+	for n, x := range xs {
+		copy(x.SliceRow(t), m.SliceRow(n))
+	}
+}
+
+func zerosT3D(n, t, d int) num.Tensor3D {
+	xs := make(num.Tensor3D, n)
+	for i := range xs {
+		xs[i] = num.Zeros(t, d)
+	}
+	return xs
+}
+
+// sliceCols は、[from, to)列を取り出す
+func sliceCols(m *num.Matrix, from, to int) *num.Matrix {
+	s := num.Zeros(m.Rows, to-from)
+	for i := 0; i < m.Rows; i++ {
+		copy(s.SliceRow(i), m.SliceRow(i)[from:to])
+	}
+	return s
+}
+
+// hstack は、行数の同じ行列を横に並べる
+func hstack(ms ...*num.Matrix) *num.Matrix {
+	cols := 0
+	for _, m := range ms {
+		cols += m.Columns
+	}
+	s := num.Zeros(ms[0].Rows, cols)
+	for i := 0; i < s.Rows; i++ {
+		row := s.SliceRow(i)
+		offset := 0
+		for _, m := range ms {
+			offset += copy(row[offset:], m.SliceRow(i))
+		}
+	}
+	return s
+}
+
+func tanhMat(m *num.Matrix) *num.Matrix {
+	return elementwise(m, func(_ int, v float64) float64 {
+		return math.Tanh(v)
+	}).(*num.Matrix)
+}
+
+// dtanh は、y = tanh(x) のとき dout*(1-y^2)
+func dtanh(dout, y *num.Matrix) *num.Matrix {
+	return num.Mul(dout, num.Sub(1.0, num.Mul(y, y)))
+}
+
+// dsigmoid は、y = sigmoid(x) のとき dout*y*(1-y)
+func dsigmoid(dout, y *num.Matrix) *num.Matrix {
+	return num.Mul(num.Mul(dout, y), num.Sub(1.0, y))
+}
+
+// RNN は、1時刻分のRNN  h_next = tanh(h_prev*Wh + x*Wx + b)
+type RNN struct {
+	Wx *num.Matrix // (D, H)
+	Wh *num.Matrix // (H, H)
+	B  *num.Matrix // (1, H)
+	// 中間データ（backward時に使用）
+	X     *num.Matrix
+	HPrev *num.Matrix
+	HNext *num.Matrix
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewRNN(wx, wh, b *num.Matrix) *RNN {
+	return &RNN{
+		Wx: wx,
+		Wh: wh,
+		B:  b,
+	}
+}
+
+func (r *RNN) Forward(x, hPrev *num.Matrix) *num.Matrix {
+	t := num.Add(num.Add(num.Dot(hPrev, r.Wh), num.Dot(x, r.Wx)), r.B)
+	r.X = x
+	r.HPrev = hPrev
+	r.HNext = tanhMat(t)
+	return r.HNext
+}
+
+func (r *RNN) Backward(dhNext *num.Matrix) (*num.Matrix, *num.Matrix) {
+	dt := dtanh(dhNext, r.HNext)
+	r.DB = num.Sum(dt, 0)
+	r.DWh = num.Dot(r.HPrev.T(), dt)
+	r.DWx = num.Dot(r.X.T(), dt)
+	dhPrev := num.Dot(dt, r.Wh.T())
+	dx := num.Dot(dt, r.Wx.T())
+	return dx, dhPrev
+}
+
+// LSTM は、1時刻分のLSTM
+// Wx, Wh, Bは forgetゲート、新しい記憶、inputゲート、outputゲート の順に4H列並べる
+type LSTM struct {
+	Wx *num.Matrix // (D, 4H)
+	Wh *num.Matrix // (H, 4H)
+	B  *num.Matrix // (1, 4H)
+	// 中間データ（backward時に使用）
+	X     *num.Matrix
+	HPrev *num.Matrix
+	CPrev *num.Matrix
+	F     *num.Matrix
+	G     *num.Matrix
+	I     *num.Matrix
+	O     *num.Matrix
+	TanhC *num.Matrix
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewLSTM(wx, wh, b *num.Matrix) *LSTM {
+	return &LSTM{
+		Wx: wx,
+		Wh: wh,
+		B:  b,
+	}
+}
+
+func (l *LSTM) Forward(x, hPrev, cPrev *num.Matrix) (*num.Matrix, *num.Matrix) {
+	H := hPrev.Columns
+	a := num.Add(num.Add(num.Dot(x, l.Wx), num.Dot(hPrev, l.Wh)), l.B)
+	l.F = num.Sigmoid(sliceCols(a, 0, H))
+	l.G = tanhMat(sliceCols(a, H, 2*H))
+	l.I = num.Sigmoid(sliceCols(a, 2*H, 3*H))
+	l.O = num.Sigmoid(sliceCols(a, 3*H, 4*H))
+
+	cNext := num.Add(num.Mul(l.F, cPrev), num.Mul(l.G, l.I))
+	l.TanhC = tanhMat(cNext)
+	hNext := num.Mul(l.O, l.TanhC)
+
+	l.X = x
+	l.HPrev = hPrev
+	l.CPrev = cPrev
+	return hNext, cNext
+}
+
+func (l *LSTM) Backward(dhNext, dcNext *num.Matrix) (*num.Matrix, *num.Matrix, *num.Matrix) {
+	ds := num.Add(dcNext, dtanh(num.Mul(dhNext, l.O), l.TanhC))
+	dcPrev := num.Mul(ds, l.F)
+
+	df := dsigmoid(num.Mul(ds, l.CPrev), l.F)
+	dg := dtanh(num.Mul(ds, l.I), l.G)
+	di := dsigmoid(num.Mul(ds, l.G), l.I)
+	do := dsigmoid(num.Mul(dhNext, l.TanhC), l.O)
+	da := hstack(df, dg, di, do)
+
+	l.DWh = num.Dot(l.HPrev.T(), da)
+	l.DWx = num.Dot(l.X.T(), da)
+	l.DB = num.Sum(da, 0)
+	dx := num.Dot(da, l.Wx.T())
+	dhPrev := num.Dot(da, l.Wh.T())
+	return dx, dhPrev, dcPrev
+}
+
+// GRU は、1時刻分のGRU
+// Wx, Wh, Bは updateゲート、resetゲート、新しい隠れ状態 の順に3H列並べる
+// https://arxiv.org/abs/1406.1078
+type GRU struct {
+	Wx *num.Matrix // (D, 3H)
+	Wh *num.Matrix // (H, 3H)
+	B  *num.Matrix // (1, 3H)
+	// 中間データ（backward時に使用）
+	X     *num.Matrix
+	HPrev *num.Matrix
+	Z     *num.Matrix
+	R     *num.Matrix
+	HHat  *num.Matrix
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewGRU(wx, wh, b *num.Matrix) *GRU {
+	return &GRU{
+		Wx: wx,
+		Wh: wh,
+		B:  b,
+	}
+}
+
+func (g *GRU) Forward(x, hPrev *num.Matrix) *num.Matrix {
+	H := hPrev.Columns
+	ax := num.Add(num.Dot(x, g.Wx), g.B)
+	ah := num.Dot(hPrev, sliceCols(g.Wh, 0, 2*H))
+	g.Z = num.Sigmoid(num.Add(sliceCols(ax, 0, H), sliceCols(ah, 0, H)))
+	g.R = num.Sigmoid(num.Add(sliceCols(ax, H, 2*H), sliceCols(ah, H, 2*H)))
+	rh := num.Mul(g.R, hPrev)
+	g.HHat = tanhMat(num.Add(sliceCols(ax, 2*H, 3*H), num.Dot(rh, sliceCols(g.Wh, 2*H, 3*H))))
+
+	g.X = x
+	g.HPrev = hPrev
+	// h_next = (1-z)*h_prev + z*h_hat
+	return num.Add(num.Mul(num.Sub(1.0, g.Z), hPrev), num.Mul(g.Z, g.HHat))
+}
+
+func (g *GRU) Backward(dhNext *num.Matrix) (*num.Matrix, *num.Matrix) {
+	H := g.HPrev.Columns
+	whz, whr, whh := sliceCols(g.Wh, 0, H), sliceCols(g.Wh, H, 2*H), sliceCols(g.Wh, 2*H, 3*H)
+	rh := num.Mul(g.R, g.HPrev)
+
+	dt := dtanh(num.Mul(dhNext, g.Z), g.HHat)
+	drh := num.Dot(dt, whh.T())
+	dz := dsigmoid(num.Mul(dhNext, num.Sub(g.HHat, g.HPrev)), g.Z)
+	dr := dsigmoid(num.Mul(drh, g.HPrev), g.R)
+
+	dhPrev := num.Mul(dhNext, num.Sub(1.0, g.Z))
+	dhPrev = num.Add(dhPrev, num.Mul(drh, g.R))
+	dhPrev = num.Add(dhPrev, num.Dot(dz, whz.T()))
+	dhPrev = num.Add(dhPrev, num.Dot(dr, whr.T()))
+
+	da := hstack(dz, dr, dt)
+	g.DWx = num.Dot(g.X.T(), da)
+	g.DWh = hstack(num.Dot(g.HPrev.T(), dz), num.Dot(g.HPrev.T(), dr), num.Dot(rh.T(), dt))
+	g.DB = num.Sum(da, 0)
+	dx := num.Dot(da, g.Wx.T())
+	return dx, dhPrev
+}
+
+// keepState は、前のForwardの状態を初期状態に使えるか
+// バッチサイズが変わった場合は続きの系列ではないので、状態をリセットする
+func keepState(stateful bool, state *num.Matrix, n int) bool {
+	return stateful && state != nil && state.Rows == n
+}
+
+// TimeRNN は、T時刻分のRNN
+type TimeRNN struct {
+	Wx       *num.Matrix
+	Wh       *num.Matrix
+	B        *num.Matrix
+	Stateful bool
+	// 最後の時刻の隠れ状態（Statefulなら次のForwardの初期状態になる）
+	H *num.Matrix
+	// 最初の時刻の隠れ状態の勾配
+	DH *num.Matrix
+	// 中間データ（backward時に使用）
+	Layers []*RNN
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewTimeRNN(wx, wh, b *num.Matrix, stateful bool) *TimeRNN {
+	return &TimeRNN{
+		Wx:       wx,
+		Wh:       wh,
+		B:        b,
+		Stateful: stateful,
+	}
+}
+
+func (tr *TimeRNN) SetState(h *num.Matrix) {
+	tr.H = h
+}
+
+func (tr *TimeRNN) ResetState() {
+	tr.H = nil
+}
+
+func (tr *TimeRNN) Forward(ixs interface{}) interface{} {
+	xs := ixs.(num.Tensor3D)
+	N, T, H := len(xs), xs[0].Rows, tr.Wh.Rows
+	if !keepState(tr.Stateful, tr.H, N) {
+		tr.H = num.Zeros(N, H)
+	}
+	hs := zerosT3D(N, T, H)
+	tr.Layers = make([]*RNN, T)
+	for t := 0; t < T; t++ {
+		tr.Layers[t] = NewRNN(tr.Wx, tr.Wh, tr.B)
+		tr.H = tr.Layers[t].Forward(timeStep(xs, t), tr.H)
+		setTimeStep(hs, t, tr.H)
+	}
+	return hs
+}
+
+func (tr *TimeRNN) Backward(idhs interface{}) interface{} {
+	dhs := idhs.(num.Tensor3D)
+	N, T, D := len(dhs), dhs[0].Rows, tr.Wx.Rows
+	dxs := zerosT3D(N, T, D)
+	dh := num.Zeros(N, tr.Wh.Rows)
+	tr.DWx, tr.DWh, tr.DB = num.ZerosLike(tr.Wx), num.ZerosLike(tr.Wh), num.ZerosLike(tr.B)
+	for t := T - 1; t >= 0; t-- {
+		l := tr.Layers[t]
+		var dx *num.Matrix
+		dx, dh = l.Backward(num.Add(timeStep(dhs, t), dh))
+		setTimeStep(dxs, t, dx)
+		tr.DWx = num.Add(tr.DWx, l.DWx)
+		tr.DWh = num.Add(tr.DWh, l.DWh)
+		tr.DB = num.Add(tr.DB, l.DB)
+	}
+	tr.DH = dh
+	return dxs
+}
+
+// TimeLSTM は、T時刻分のLSTM
+type TimeLSTM struct {
+	Wx       *num.Matrix
+	Wh       *num.Matrix
+	B        *num.Matrix
+	Stateful bool
+	// 最後の時刻の隠れ状態と記憶セル（Statefulなら次のForwardの初期状態になる）
+	H *num.Matrix
+	C *num.Matrix
+	// 最初の時刻の隠れ状態の勾配
+	DH *num.Matrix
+	// 中間データ（backward時に使用）
+	Layers []*LSTM
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewTimeLSTM(wx, wh, b *num.Matrix, stateful bool) *TimeLSTM {
+	return &TimeLSTM{
+		Wx:       wx,
+		Wh:       wh,
+		B:        b,
+		Stateful: stateful,
+	}
+}
+
+func (tl *TimeLSTM) SetState(h, c *num.Matrix) {
+	tl.H = h
+	tl.C = c
+}
+
+func (tl *TimeLSTM) ResetState() {
+	tl.H = nil
+	tl.C = nil
+}
+
+func (tl *TimeLSTM) Forward(ixs interface{}) interface{} {
+	xs := ixs.(num.Tensor3D)
+	N, T, H := len(xs), xs[0].Rows, tl.Wh.Rows
+	if !keepState(tl.Stateful, tl.H, N) || !keepState(tl.Stateful, tl.C, N) {
+		tl.H, tl.C = num.Zeros(N, H), num.Zeros(N, H)
+	}
+	hs := zerosT3D(N, T, H)
+	tl.Layers = make([]*LSTM, T)
+	for t := 0; t < T; t++ {
+		tl.Layers[t] = NewLSTM(tl.Wx, tl.Wh, tl.B)
+		tl.H, tl.C = tl.Layers[t].Forward(timeStep(xs, t), tl.H, tl.C)
+		setTimeStep(hs, t, tl.H)
+	}
+	return hs
+}
+
+func (tl *TimeLSTM) Backward(idhs interface{}) interface{} {
+	dhs := idhs.(num.Tensor3D)
+	N, T, D, H := len(dhs), dhs[0].Rows, tl.Wx.Rows, tl.Wh.Rows
+	dxs := zerosT3D(N, T, D)
+	dh, dc := num.Zeros(N, H), num.Zeros(N, H)
+	tl.DWx, tl.DWh, tl.DB = num.ZerosLike(tl.Wx), num.ZerosLike(tl.Wh), num.ZerosLike(tl.B)
+	for t := T - 1; t >= 0; t-- {
+		l := tl.Layers[t]
+		var dx *num.Matrix
+		dx, dh, dc = l.Backward(num.Add(timeStep(dhs, t), dh), dc)
+		setTimeStep(dxs, t, dx)
+		tl.DWx = num.Add(tl.DWx, l.DWx)
+		tl.DWh = num.Add(tl.DWh, l.DWh)
+		tl.DB = num.Add(tl.DB, l.DB)
+	}
+	tl.DH = dh
+	return dxs
+}
+
+// TimeGRU は、T時刻分のGRU
+type TimeGRU struct {
+	Wx       *num.Matrix
+	Wh       *num.Matrix
+	B        *num.Matrix
+	Stateful bool
+	// 最後の時刻の隠れ状態（Statefulなら次のForwardの初期状態になる）
+	H *num.Matrix
+	// 最初の時刻の隠れ状態の勾配
+	DH *num.Matrix
+	// 中間データ（backward時に使用）
+	Layers []*GRU
+	// 重み・バイアスパラメータの勾配
+	DWx *num.Matrix
+	DWh *num.Matrix
+	DB  *num.Matrix
+}
+
+func NewTimeGRU(wx, wh, b *num.Matrix, stateful bool) *TimeGRU {
+	return &TimeGRU{
+		Wx:       wx,
+		Wh:       wh,
+		B:        b,
+		Stateful: stateful,
+	}
+}
+
+func (tg *TimeGRU) SetState(h *num.Matrix) {
+	tg.H = h
+}
+
+func (tg *TimeGRU) ResetState() {
+	tg.H = nil
+}
+
+func (tg *TimeGRU) Forward(ixs interface{}) interface{} {
+	xs := ixs.(num.Tensor3D)
+	N, T, H := len(xs), xs[0].Rows, tg.Wh.Rows
+	if !keepState(tg.Stateful, tg.H, N) {
+		tg.H = num.Zeros(N, H)
+	}
+	hs := zerosT3D(N, T, H)
+	tg.Layers = make([]*GRU, T)
+	for t := 0; t < T; t++ {
+		tg.Layers[t] = NewGRU(tg.Wx, tg.Wh, tg.B)
+		tg.H = tg.Layers[t].Forward(timeStep(xs, t), tg.H)
+		setTimeStep(hs, t, tg.H)
+	}
+	return hs
+}
+
+func (tg *TimeGRU) Backward(idhs interface{}) interface{} {
+	dhs := idhs.(num.Tensor3D)
+	N, T, D := len(dhs), dhs[0].Rows, tg.Wx.Rows
+	dxs := zerosT3D(N, T, D)
+	dh := num.Zeros(N, tg.Wh.Rows)
+	tg.DWx, tg.DWh, tg.DB = num.ZerosLike(tg.Wx), num.ZerosLike(tg.Wh), num.ZerosLike(tg.B)
+	for t := T - 1; t >= 0; t-- {
+		l := tg.Layers[t]
+		var dx *num.Matrix
+		dx, dh = l.Backward(num.Add(timeStep(dhs, t), dh))
+		setTimeStep(dxs, t, dx)
+		tg.DWx = num.Add(tg.DWx, l.DWx)
+		tg.DWh = num.Add(tg.DWh, l.DWh)
+		tg.DB = num.Add(tg.DB, l.DB)
+	}
+	tg.DH = dh
+	return dxs
+}
+
+// t3dToMat は、(N, T, D)を(N*T, D)の行列にする
+func t3dToMat(xs num.Tensor3D) *num.Matrix {
+	N, T, D := len(xs), xs[0].Rows, xs[0].Columns
+	m := num.Zeros(N*T, D)
+	for n, x := range xs {
+		copy(m.Vector[n*T*D:(n+1)*T*D], x.Vector)
+	}
+	return m
+}
+
+// matToT3D は、t3dToMatの逆変換
+func matToT3D(m *num.Matrix, n int) num.Tensor3D {
+	T := m.Rows / n
+	xs := zerosT3D(n, T, m.Columns)
+	for i, x := range xs {
+		copy(x.Vector, m.Vector[i*T*m.Columns:(i+1)*T*m.Columns])
+	}
+	return xs
+}
+
+// TimeAffine は、各時刻に同じAffineを適用する
+type TimeAffine struct {
+	W *num.Matrix
+	B *num.Matrix
+	// 中間データ（backward時に使用）
+	X *num.Matrix // (N*T, D)
+	N int
+	// 重み・バイアスパラメータの勾配
+	DW *num.Matrix
+	DB *num.Matrix
+}
+
+func NewTimeAffine(w, b *num.Matrix) *TimeAffine {
+	return &TimeAffine{
+		W: w,
+		B: b,
+	}
+}
+
+func (ta *TimeAffine) Forward(ixs interface{}) interface{} {
+	xs := ixs.(num.Tensor3D)
+	ta.X = t3dToMat(xs)
+	ta.N = len(xs)
+	return matToT3D(num.Add(num.Dot(ta.X, ta.W), ta.B), ta.N)
+}
+
+func (ta *TimeAffine) Backward(idout interface{}) interface{} {
+	dout := t3dToMat(idout.(num.Tensor3D))
+	ta.DW = num.Dot(ta.X.T(), dout)
+	ta.DB = num.Sum(dout, 0)
+	return matToT3D(num.Dot(dout, ta.W.T()), ta.N)
+}
+
+// TimeSoftmaxWithLoss は、各時刻のSoftmaxWithLossの平均
+// 教師データは(N, T)のクラス番号で、負のラベル（-1など）の時刻は損失に含めない
+type TimeSoftmaxWithLoss struct {
+	SoftmaxWithLoss
+	N int
+}
+
+func NewTimeSoftmaxWithLoss() *TimeSoftmaxWithLoss {
+	return &TimeSoftmaxWithLoss{
+		SoftmaxWithLoss: *NewSfotmaxWithLoss(),
+	}
+}
+
+func (ts *TimeSoftmaxWithLoss) Forward(xs num.Tensor3D, labels [][]int) float64 {
+	flat := make([]int, 0, len(labels)*len(labels[0]))
+	for _, l := range labels {
+		flat = append(flat, l...)
+	}
+	ts.N = len(xs)
+	return ts.ForwardLabels(t3dToMat(xs), flat)
+}
+
+func (ts *TimeSoftmaxWithLoss) Backward(dout float64) num.Tensor3D {
+	return matToT3D(ts.SoftmaxWithLoss.Backward(dout), ts.N)
+}
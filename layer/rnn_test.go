@@ -0,0 +1,155 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// checkRecurrent は、入力と重み（params）の勾配を数値微分と比較する
+func checkRecurrent(t *testing.T, name string, l T4DLayer, params []*num.Matrix, grads func() []*num.Matrix) {
+	N, T, D := 2, 3, params[0].Rows
+	x, _ := num.NewRandnMatrix(N, T*D)
+	shape := []int{N, T, D}
+	dx, numerical := gradientCheck(l, x, shape)
+	if !closeEnough(dx, numerical) {
+		fmt.Println(name, dx, numerical)
+		t.Fail()
+	}
+
+	loss := func() float64 {
+		y, _ := toMatrix(l.Forward(fromMatrix(x, shape)))
+		return vec.Sum(vec.Mul(y.Vector, y.Vector))
+	}
+	out, outShape := toMatrix(l.Forward(fromMatrix(x, shape)))
+	l.Backward(fromMatrix(num.Mul(out, 2.0), outShape))
+	analytic := grads()
+	for i, p := range params {
+		numerical := numericalGradient(loss, p.Vector)
+		if !closeEnough(analytic[i].Vector, numerical) {
+			fmt.Println(name, i, analytic[i], numerical)
+			t.Fail()
+		}
+	}
+}
+
+func TestTimeRNNGradient(t *testing.T) {
+	D, H := 3, 4
+	wx, wh, b := mustRandn(D, H), mustRandn(H, H), mustRandn(1, H)
+	rnn := NewTimeRNN(wx, wh, b, false)
+	checkRecurrent(t, "RNN", rnn, []*num.Matrix{wx, wh, b}, func() []*num.Matrix {
+		return []*num.Matrix{rnn.DWx, rnn.DWh, rnn.DB}
+	})
+}
+
+func TestTimeLSTMGradient(t *testing.T) {
+	D, H := 3, 2
+	wx, wh, b := mustRandn(D, 4*H), mustRandn(H, 4*H), mustRandn(1, 4*H)
+	lstm := NewTimeLSTM(wx, wh, b, false)
+	checkRecurrent(t, "LSTM", lstm, []*num.Matrix{wx, wh, b}, func() []*num.Matrix {
+		return []*num.Matrix{lstm.DWx, lstm.DWh, lstm.DB}
+	})
+}
+
+func TestTimeGRUGradient(t *testing.T) {
+	D, H := 3, 2
+	wx, wh, b := mustRandn(D, 3*H), mustRandn(H, 3*H), mustRandn(1, 3*H)
+	gru := NewTimeGRU(wx, wh, b, false)
+	checkRecurrent(t, "GRU", gru, []*num.Matrix{wx, wh, b}, func() []*num.Matrix {
+		return []*num.Matrix{gru.DWx, gru.DWh, gru.DB}
+	})
+}
+
+// Statefulなら、系列を2つのブロックに分けても続けて計算した場合と同じ出力になる
+func TestTimeLSTMStateful(t *testing.T) {
+	D, H := 2, 3
+	wx, wh, b := mustRandn(D, 4*H), mustRandn(H, 4*H), mustRandn(1, 4*H)
+	x, _ := num.NewRandnMatrix(2, 4*D)
+	xs := fromMatrix(x, []int{2, 4, D}).(num.Tensor3D)
+	expected := NewTimeLSTM(wx, wh, b, false).Forward(xs).(num.Tensor3D)
+
+	first := num.Tensor3D{}
+	second := num.Tensor3D{}
+	for _, m := range xs {
+		first = append(first, &num.Matrix{Vector: m.Vector[:2*D], Rows: 2, Columns: D})
+		second = append(second, &num.Matrix{Vector: m.Vector[2*D:], Rows: 2, Columns: D})
+	}
+	lstm := NewTimeLSTM(wx, wh, b, true)
+	lstm.Forward(first)
+	actual := lstm.Forward(second).(num.Tensor3D)
+	for n := range xs {
+		if !closeEnough(actual[n].Vector, expected[n].Vector[2*H:]) {
+			fmt.Println(actual[n], expected[n])
+			t.Fail()
+		}
+	}
+
+	// 状態をリセットすると、最初のブロックと同じ出力になる
+	lstm.ResetState()
+	reset := lstm.Forward(first).(num.Tensor3D)
+	for n := range xs {
+		if !closeEnough(reset[n].Vector, expected[n].Vector[:2*H]) {
+			fmt.Println(reset[n], expected[n])
+			t.Fail()
+		}
+	}
+}
+
+// バッチサイズが変わったら、Statefulでも状態をリセットする
+func TestStatefulBatchSize(t *testing.T) {
+	D, H := 2, 3
+	x, _ := num.NewRandnMatrix(2, 3*D)
+	xs := fromMatrix(x, []int{2, 3, D}).(num.Tensor3D)
+	layers := map[string]T4DLayer{
+		"RNN":  NewTimeRNN(mustRandn(D, H), mustRandn(H, H), mustRandn(1, H), true),
+		"LSTM": NewTimeLSTM(mustRandn(D, 4*H), mustRandn(H, 4*H), mustRandn(1, 4*H), true),
+		"GRU":  NewTimeGRU(mustRandn(D, 3*H), mustRandn(H, 3*H), mustRandn(1, 3*H), true),
+	}
+	for name, l := range layers {
+		l.Forward(xs[:1])
+		actual := l.Forward(xs).(num.Tensor3D)
+		l.(interface{ ResetState() }).ResetState()
+		expected := l.Forward(xs).(num.Tensor3D)
+		for n := range xs {
+			if !closeEnough(actual[n].Vector, expected[n].Vector) {
+				fmt.Println(name, actual[n], expected[n])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestTimeSoftmaxWithLoss(t *testing.T) {
+	D, V := 3, 4
+	affine := NewTimeAffine(mustRandn(D, V), mustRandn(1, V))
+	loss := NewTimeSoftmaxWithLoss()
+	x, _ := num.NewRandnMatrix(2, 3*D)
+	// -1の時刻は損失に含めない
+	labels := [][]int{{0, 3, -1}, {2, 2, 1}}
+
+	f := func() float64 {
+		xs := fromMatrix(x, []int{2, 3, D})
+		return loss.Forward(affine.Forward(xs).(num.Tensor3D), labels)
+	}
+	f()
+	dxs := affine.Backward(loss.Backward(1.0)).(num.Tensor3D)
+	dx, _ := toMatrix(dxs)
+	numerical := numericalGradient(f, x.Vector)
+	if !closeEnough(dx.Vector, numerical) {
+		fmt.Println(dx, numerical)
+		t.Fail()
+	}
+	numericalW := numericalGradient(f, affine.W.Vector)
+	f()
+	affine.Backward(loss.Backward(1.0))
+	if !closeEnough(affine.DW.Vector, numericalW) {
+		fmt.Println(affine.DW, numericalW)
+		t.Fail()
+	}
+	if dx.Vector[2*D] != 0 || dx.Vector[3*D-1] != 0 {
+		fmt.Println(dx)
+		t.Fail()
+	}
+}
@@ -15,10 +15,14 @@ type Convolution struct {
 	B      *num.Matrix  // 3次元
 	Stride int
 	Pad    int
+	// ゼロ以外のパディング（ゼロ値ならゼロパディング）
+	PadMode  num.PadMode
+	PadValue float64
 	// 中間データ（backward時に使用）
-	X    num.Tensor4D
-	Col  *num.Matrix
-	ColW *num.Matrix
+	X       num.Tensor4D // パディング済み
+	Col     *num.Matrix
+	ColW    *num.Matrix
+	Padding *num.Padding
 	// 重み・バイアスパラメータの勾配
 	DW num.Tensor4D
 	DB *num.Matrix
@@ -35,12 +39,18 @@ func NewConvolution(w num.Tensor4D, b *num.Matrix, stride, pad int) *Convolution
 
 func (c *Convolution) Forward(ix interface{}) interface{} {
 	x := ix.(num.Tensor4D)
-	FN, _, FH, FW := c.W.Shape()
+	c.Padding = modePadding(c.Pad, c.Pad, c.Pad, c.Pad, c.PadMode, c.PadValue)
+	pad := c.pad()
+	if c.Padding != nil {
+		x = x.PadWith(c.Padding)
+	}
+	FN, C, FH, FW := c.W.Shape()
 	N, _, H, W := x.Shape()
-	outH := 1 + (H+2*c.Pad-FH)/c.Stride
-	outW := 1 + (W+2*c.Pad-FW)/c.Stride
+	outH := 1 + (H+2*pad-FH)/c.Stride
+	outW := 1 + (W+2*pad-FW)/c.Stride
 
-	col := x.Im2Col(FH, FW, c.Stride, c.Pad)
+	// Im2Colは(N*outH*outW*C, FH*FW)を返すので、チャンネルを列にまとめる
+	col := x.Im2Col(FH, FW, c.Stride, pad).Reshape(-1, C*FH*FW)
 	colW := c.W.ReshapeToMat(FN, -1).T()
 
 	out := num.Add(num.Dot(col, colW), c.B)
@@ -62,10 +72,21 @@ func (c *Convolution) Backward(idout interface{}) interface{} {
 	dcol := num.Dot(doutMat, c.ColW.T())
 	i, j, k, l := c.X.Shape()
 	shape := []int{i, j, k, l}
-	dx := dcol.Col2Img(shape, FH, FW, c.Stride, c.Pad)
+	dx := dcol.Col2Img(shape, FH, FW, c.Stride, c.pad())
+	if c.Padding != nil {
+		dx = dx.UnpadWith(c.Padding)
+	}
 	return dx
 }
 
+// pad は、im2colで行うゼロパディングの幅
+func (c *Convolution) pad() int {
+	if c.Padding != nil {
+		return 0
+	}
+	return c.Pad
+}
+
 type AffineT4D struct {
 	W           *num.Matrix
 	B           *num.Matrix
@@ -237,3 +258,70 @@ func (so *SoftmaxWithLossT4D) Backward() interface{} {
 	dx := num.DivT4D(sub, batchSize)
 	return dx
 }
+
+// toMatrix は、Tensor4Dを(N, C*H*W)、Tensor3Dを(N, T*D)の行列に変換する
+// 元の形状も返すので、fromMatrixで元に戻せる（行列の場合はnil）
+func toMatrix(x interface{}) (*num.Matrix, []int) {
+	switch v := x.(type) {
+	case *num.Matrix:
+		return v, nil
+	case num.Tensor3D:
+		n, t, d := len(v), v[0].Rows, v[0].Columns
+		m := num.Zeros(n, t*d)
+		for i, mat := range v {
+			copy(m.SliceRow(i), mat.Vector)
+		}
+		return m, []int{n, t, d}
+	case num.Tensor4D:
+		n, c, h, w := len(v), len(v[0]), v[0][0].Rows, v[0][0].Columns
+		return v.ReshapeToMat(n, c*h*w), []int{n, c, h, w}
+	}
+	panic(x)
+}
+
+func fromMatrix(m *num.Matrix, shape []int) interface{} {
+	switch len(shape) {
+	case 0:
+		return m
+	case 3:
+		return matToT3D(&num.Matrix{Vector: m.Vector, Rows: shape[0] * shape[1], Columns: shape[2]}, shape[0])
+	}
+	return m.ReshapeTo4D(shape[0], shape[1], shape[2], shape[3])
+}
+
+// nchwToMat は、(N, C, H, W)を(N*H*W, C)の行列に並べ替える
+func nchwToMat(x num.Tensor4D) *num.Matrix {
+	N, C, H, W := len(x), len(x[0]), x[0][0].Rows, x[0][0].Columns
+	mat := num.Zeros(N*H*W, C)
+	for n, t3d := range x {
+		for c, m := range t3d {
+			for i, v := range m.Vector {
+				mat.Vector[(n*H*W+i)*C+c] = v
+			}
+		}
+	}
+	return mat
+}
+
+// matToNCHW は、nchwToMatの逆変換
+func matToNCHW(mat *num.Matrix, n, h, w int) num.Tensor4D {
+	C := mat.Columns
+	t4d := num.ZerosT4D(n, C, h, w)
+	for i, t3d := range t4d {
+		for c, m := range t3d {
+			for j := range m.Vector {
+				m.Vector[j] = mat.Vector[(i*h*w+j)*C+c]
+			}
+		}
+	}
+	return t4d
+}
+
+// sliceChannels は、チャンネル[from, to)だけを取り出す（コピーしない）
+func sliceChannels(x num.Tensor4D, from, to int) num.Tensor4D {
+	sliced := make(num.Tensor4D, len(x))
+	for i, t3d := range x {
+		sliced[i] = t3d[from:to]
+	}
+	return sliced
+}
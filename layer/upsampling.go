@@ -0,0 +1,103 @@
+package layer
+
+import (
+	"math"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+type UpsampleMode int
+
+const (
+	NEARESTUPSAMPLE UpsampleMode = iota
+	BILINEARUPSAMPLE
+)
+
+// Upsampling2D は、(N, C, H, W)の特徴マップを(N, C, floor(H*ScaleH), floor(W*ScaleW))に拡大する
+// 倍率は整数でなくてもよく、出力の画素に対応する入力の位置は 1/倍率 倍で決める
+// （PyTorchのinterpolateでscale_factorを指定した場合と同じ。出力サイズを切り捨てるので 入力サイズ/出力サイズ とは違う）
+// AlignCornersがtrueなら入力と出力の四隅の画素の中心を合わせる（BILINEARUPSAMPLEのみ）
+type Upsampling2D struct {
+	ScaleH       float64
+	ScaleW       float64
+	Mode         UpsampleMode
+	AlignCorners bool
+	// 中間データ（backward時に使用）
+	// 出力 = RowWeights・入力・ColWeights^T
+	RowWeights *num.Matrix
+	ColWeights *num.Matrix
+}
+
+func NewUpsampling2D(scaleH, scaleW float64, mode UpsampleMode, alignCorners bool) *Upsampling2D {
+	return &Upsampling2D{
+		ScaleH:       scaleH,
+		ScaleW:       scaleW,
+		Mode:         mode,
+		AlignCorners: alignCorners,
+	}
+}
+
+func (u *Upsampling2D) Forward(ix interface{}) interface{} {
+	x := ix.(num.Tensor4D)
+	_, _, H, W := x.Shape()
+	outH := int(math.Floor(float64(H) * u.ScaleH))
+	outW := int(math.Floor(float64(W) * u.ScaleW))
+	u.RowWeights = u.interpolation(H, outH, u.ScaleH)
+	u.ColWeights = u.interpolation(W, outW, u.ScaleW)
+	colT := u.ColWeights.T()
+	out := make(num.Tensor4D, len(x))
+	for n := range x {
+		out[n] = make(num.Tensor3D, len(x[n]))
+		for c, m := range x[n] {
+			out[n][c] = num.Dot(num.Dot(u.RowWeights, m), colT)
+		}
+	}
+	return out
+}
+
+func (u *Upsampling2D) Backward(idout interface{}) interface{} {
+	dout := idout.(num.Tensor4D)
+	rowT := u.RowWeights.T()
+	dx := make(num.Tensor4D, len(dout))
+	for n := range dout {
+		dx[n] = make(num.Tensor3D, len(dout[n]))
+		for c, m := range dout[n] {
+			dx[n][c] = num.Dot(num.Dot(rowT, m), u.ColWeights)
+		}
+	}
+	return dx
+}
+
+// interpolation は、長さinの軸を倍率factorで長さoutに補間する(out, in)の重み
+func (u *Upsampling2D) interpolation(in, out int, factor float64) *num.Matrix {
+	weights := num.Zeros(out, in)
+	scale := 1 / factor
+	for i := 0; i < out; i++ {
+		if u.Mode == NEARESTUPSAMPLE {
+			src := int(math.Min(math.Floor(float64(i)*scale), float64(in-1)))
+			weights.Vector[i*in+src] = 1
+			continue
+		}
+		var src float64
+		if u.AlignCorners {
+			if out > 1 {
+				src = float64(i) * float64(in-1) / float64(out-1)
+			}
+		} else {
+			// 画素の中心を合わせて、範囲外は端の画素にする
+			src = math.Max((float64(i)+0.5)*scale-0.5, 0)
+		}
+		i0 := int(math.Floor(src))
+		if i0 > in-1 {
+			i0 = in - 1
+		}
+		i1 := i0 + 1
+		if i1 > in-1 {
+			i1 = in - 1
+		}
+		l := src - float64(i0)
+		weights.Vector[i*in+i0] += 1 - l
+		weights.Vector[i*in+i1] += l
+	}
+	return weights
+}
@@ -0,0 +1,106 @@
+package layer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func upsample(u *Upsampling2D, h, w int, v vec.Vector) vec.Vector {
+	m, _ := num.NewMatrix(h, w, v)
+	return u.Forward(num.Tensor4D{num.Tensor3D{m}}).(num.Tensor4D)[0][0].Vector
+}
+
+// 期待値はPyTorchのtorch.nn.functional.interpolateと同じ
+func TestUpsampling2D(t *testing.T) {
+	x := vec.Vector{
+		0, 1,
+		2, 3,
+	}
+	cases := []struct {
+		name     string
+		u        *Upsampling2D
+		expected vec.Vector
+	}{
+		{"nearest", NewUpsampling2D(2, 2, NEARESTUPSAMPLE, false), vec.Vector{
+			0, 0, 1, 1,
+			0, 0, 1, 1,
+			2, 2, 3, 3,
+			2, 2, 3, 3,
+		}},
+		{"nearest 1.5", NewUpsampling2D(1.5, 1.5, NEARESTUPSAMPLE, false), vec.Vector{
+			0, 0, 1,
+			0, 0, 1,
+			2, 2, 3,
+		}},
+		// 四隅を合わせるので、出力の端は入力の端と同じ値
+		{"bilinear align_corners", NewUpsampling2D(1.5, 1.5, BILINEARUPSAMPLE, true), vec.Vector{
+			0, 0.5, 1,
+			1, 1.5, 2,
+			2, 2.5, 3,
+		}},
+		// 画素の中心を合わせるので、端の画素は入力の端の値で延長される
+		{"bilinear", NewUpsampling2D(2, 2, BILINEARUPSAMPLE, false), vec.Vector{
+			0, 0.25, 0.75, 1,
+			0.5, 0.75, 1.25, 1.5,
+			1.5, 1.75, 2.25, 2.5,
+			2, 2.25, 2.75, 3,
+		}},
+		{"bilinear align_corners 2", NewUpsampling2D(2, 2, BILINEARUPSAMPLE, true), vec.Vector{
+			0, 1.0 / 3, 2.0 / 3, 1,
+			2.0 / 3, 1, 4.0 / 3, 5.0 / 3,
+			4.0 / 3, 5.0 / 3, 2, 7.0 / 3,
+			2, 7.0 / 3, 8.0 / 3, 3,
+		}},
+	}
+	for _, c := range cases {
+		actual := upsample(c.u, 2, 2, x)
+		if !closeEnough(actual, c.expected) {
+			fmt.Println(c.name, actual, c.expected)
+			t.Fail()
+		}
+	}
+}
+
+// 出力サイズを切り捨てるので、入力の位置は 入力サイズ/出力サイズ ではなく 1/倍率 で決まる
+// 期待値はPyTorchのinterpolate(scale_factor=(1, 倍率))と同じ
+func TestUpsampling2DFractionalScale(t *testing.T) {
+	cases := []struct {
+		name     string
+		u        *Upsampling2D
+		x        vec.Vector
+		expected vec.Vector
+	}{
+		// 5/6ではなく1/1.3なので、最後の画素は3になる
+		{"nearest", NewUpsampling2D(1, 1.3, NEARESTUPSAMPLE, false), vec.Vector{0, 1, 2, 3, 4}, vec.Vector{0, 0, 1, 2, 3, 3}},
+		// 入力の位置は (i+0.5)/1.7-0.5
+		{"bilinear", NewUpsampling2D(1, 1.7, BILINEARUPSAMPLE, false), vec.Vector{0, 1, 2}, vec.Vector{0, 13.0 / 34, 33.0 / 34, 53.0 / 34, 2}},
+	}
+	for _, c := range cases {
+		actual := upsample(c.u, 1, len(c.x), c.x)
+		if !closeEnough(actual, c.expected) {
+			fmt.Println(c.name, actual, c.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestUpsampling2DGradient(t *testing.T) {
+	shape := []int{2, 3, 3, 4}
+	x := mustRandn(2, 3*3*4)
+	for _, u := range []*Upsampling2D{
+		NewUpsampling2D(2, 2, NEARESTUPSAMPLE, false),
+		NewUpsampling2D(1.5, 2.5, NEARESTUPSAMPLE, false),
+		NewUpsampling2D(2, 2, BILINEARUPSAMPLE, false),
+		NewUpsampling2D(1.7, 2.5, BILINEARUPSAMPLE, false),
+		NewUpsampling2D(1.7, 2.5, BILINEARUPSAMPLE, true),
+	} {
+		dx, numerical := gradientCheck(u, x, shape)
+		if !closeEnough(dx, numerical) {
+			fmt.Println(u.ScaleH, u.ScaleW, u.Mode, u.AlignCorners, dx, numerical)
+			t.Fail()
+		}
+	}
+}
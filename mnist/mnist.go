@@ -7,6 +7,7 @@ import (
 	"image/color"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/naronA/zero_deeplearning/vec"
 )
@@ -27,23 +28,27 @@ type DataSet struct {
 }
 
 func LoadMnist() (*DataSet, *DataSet) {
+	return LoadMnistDir("./mnist")
+}
 
-	trainImagesFile, err := os.Open("./mnist/train-images-idx3-ubyte.gz")
+// LoadMnistDir は、dirの*-ubyte.gzを読む（ファイルがなければnil）
+func LoadMnistDir(dir string) (*DataSet, *DataSet) {
+	trainImagesFile, err := os.Open(filepath.Join(dir, "train-images-idx3-ubyte.gz"))
 	if err != nil {
 		return nil, nil
 	}
 	defer trainImagesFile.Close()
-	trainLabelsFile, err := os.Open("./mnist/train-labels-idx1-ubyte.gz")
+	trainLabelsFile, err := os.Open(filepath.Join(dir, "train-labels-idx1-ubyte.gz"))
 	if err != nil {
 		return nil, nil
 	}
 	defer trainLabelsFile.Close()
-	testImagesFile, err := os.Open("./mnist/t10k-images-idx3-ubyte.gz")
+	testImagesFile, err := os.Open(filepath.Join(dir, "t10k-images-idx3-ubyte.gz"))
 	if err != nil {
 		return nil, nil
 	}
 	defer testImagesFile.Close()
-	testLabelsFile, err := os.Open("./mnist/t10k-labels-idx1-ubyte.gz")
+	testLabelsFile, err := os.Open(filepath.Join(dir, "t10k-labels-idx1-ubyte.gz"))
 	if err != nil {
 		return nil, nil
 	}
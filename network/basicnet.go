@@ -1,7 +1,12 @@
 package network
 
 import (
+	"fmt"
+	"io"
+
+	"github.com/naronA/zero_deeplearning/npy"
 	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/pickle"
 	"github.com/naronA/zero_deeplearning/vec"
 )
 
@@ -41,6 +46,44 @@ func NewBasicNetwork() *BasicNetwork {
 	}
 }
 
+// LoadSampleWeight は、Ch3.6.2のsample_weight.pklの学習済みの重みを読み込む
+// W1〜W3, b1〜b3のnumpy.ndarrayの辞書（バイアスは1次元）
+func LoadSampleWeight(r io.Reader) (*BasicNetwork, error) {
+	v, err := pickle.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sample weight is %T, not dict", v)
+	}
+	network := map[string]*num.Matrix{}
+	for _, k := range []string{"W1", "W2", "W3", "b1", "b2", "b3"} {
+		a, ok := d[k].(*npy.Array)
+		if !ok {
+			return nil, fmt.Errorf("sample weight has no array %q", k)
+		}
+		t, err := a.Tensor()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		m, ok := t.(*num.Matrix)
+		if !ok {
+			return nil, fmt.Errorf("%s has shape %v", k, a.Shape)
+		}
+		network[k] = m
+	}
+	for i := 1; i <= 3; i++ {
+		W, b := network[fmt.Sprintf("W%d", i)], network[fmt.Sprintf("b%d", i)]
+		if W.Columns != b.Columns || (i > 1 && network[fmt.Sprintf("W%d", i-1)].Columns != W.Rows) {
+			return nil, fmt.Errorf("W%d has inconsistent shape %dx%d", i, W.Rows, W.Columns)
+		}
+	}
+	return &BasicNetwork{
+		Network: network,
+	}, nil
+}
+
 func (net *BasicNetwork) Forward(x *num.Matrix) vec.Vector {
 	W1 := net.Network["W1"]
 	W2 := net.Network["W2"]
@@ -62,3 +105,22 @@ func (net *BasicNetwork) Forward(x *num.Matrix) vec.Vector {
 	y := vec.IdentityFunction(a3.Vector)
 	return y
 }
+
+// Predict は、Ch3.6.2のpredict（出力層はソフトマックス関数）
+func (net *BasicNetwork) Predict(x *num.Matrix) *num.Matrix {
+	y := net.Forward(x)
+	return num.Softmax(&num.Matrix{Vector: y, Rows: x.Rows, Columns: len(y) / x.Rows})
+}
+
+// Accuracy は、tをone-hotのラベルとした正解率
+func (net *BasicNetwork) Accuracy(x, t *num.Matrix) float64 {
+	yMax := num.ArgMax(net.Predict(x), 1)
+	tMax := num.ArgMax(t, 1)
+	sum := 0.0
+	for i, v := range yMax {
+		if v == tMax[i] {
+			sum += 1.0
+		}
+	}
+	return sum / float64(x.Rows)
+}
@@ -1,9 +1,14 @@
 package network
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/naronA/zero_deeplearning/mnist"
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/vec"
 )
@@ -21,3 +26,96 @@ func TestBasicNetwork(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// samplePickle は、numpy.ndarray（float64）の辞書をpickle.dump(protocol=3)と同じ形で書く
+// バイアスは1次元の配列にする
+func samplePickle(params map[string]*num.Matrix) []byte {
+	buf := &bytes.Buffer{}
+	str := func(s string) {
+		buf.WriteByte('X')
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	buf.Write([]byte{0x80, 3, '}', '('})
+	for k, m := range params {
+		str(k)
+		buf.WriteString("cnumpy.core.multiarray\n_reconstruct\ncnumpy\nndarray\nK\x00\x85C\x01b\x87R(K\x01(")
+		if strings.HasPrefix(k, "b") {
+			buf.Write([]byte{'K', byte(m.Columns)})
+		} else {
+			buf.Write([]byte{'K', byte(m.Rows), 'K', byte(m.Columns)})
+		}
+		buf.WriteString("tcnumpy\ndtype\n")
+		str("f8")
+		buf.WriteString("K\x00K\x01\x87R(K\x03")
+		str("<")
+		buf.WriteString("NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tb\x89B")
+		binary.Write(buf, binary.LittleEndian, uint32(8*len(m.Vector)))
+		binary.Write(buf, binary.LittleEndian, []float64(m.Vector))
+		buf.WriteString("tb")
+	}
+	buf.WriteString("u.")
+	return buf.Bytes()
+}
+
+func TestLoadSampleWeight(t *testing.T) {
+	expected := NewBasicNetwork()
+	network, err := LoadSampleWeight(bytes.NewReader(samplePickle(expected.Network)))
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	x, _ := num.NewMatrix(2, 2, vec.Vector{
+		1.0, 0.5,
+		-0.3, 0.8,
+	})
+	if vec.NotEqual(network.Forward(x), expected.Forward(x)) {
+		fmt.Println(network.Forward(x), expected.Forward(x))
+		t.Fail()
+	}
+	label, _ := num.NewMatrix(2, 2, vec.Vector{
+		0, 1,
+		1, 0,
+	})
+	if acc := network.Accuracy(x, label); acc != 0.5 {
+		fmt.Println(acc)
+		t.Fail()
+	}
+
+	delete(expected.Network, "b2")
+	if _, err := LoadSampleWeight(bytes.NewReader(samplePickle(expected.Network))); err == nil {
+		t.Fail()
+	}
+}
+
+// TestSampleWeightMNIST は、本物のsample_weight.pklでMNISTのテストデータの正解率が0.9352になるか確かめる
+// testdata/sample_weight.pkl（Ch3のもの）と../mnist/*.gzがなければ飛ばす
+func TestSampleWeightMNIST(t *testing.T) {
+	f, err := os.Open("testdata/sample_weight.pkl")
+	if err != nil {
+		t.Skip("testdata/sample_weight.pkl is not available")
+	}
+	defer f.Close()
+	_, test := mnist.LoadMnistDir("../mnist")
+	if test == nil {
+		t.Skip("MNIST is not available")
+	}
+	network, err := LoadSampleWeight(f)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	image := vec.Vector{}
+	label := vec.Vector{}
+	for i := range test.Images {
+		// 0.0〜1.0に正規化する
+		image = append(image, vec.Div(test.Images[i], 255.0)...)
+		label = append(label, test.Labels[i]...)
+	}
+	x, _ := num.NewMatrix(len(test.Images), mnist.Width*mnist.Height, image)
+	l, _ := num.NewMatrix(len(test.Labels), 10, label)
+	if acc := network.Accuracy(x, l); acc < 0.935 || acc > 0.936 {
+		fmt.Println(acc)
+		t.Fail()
+	}
+}
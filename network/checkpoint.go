@@ -0,0 +1,610 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+// CheckpointVersion は、Saveが書くチェックポイントの形式のバージョン
+const CheckpointVersion = 1
+
+// checkpointMagic は、チェックポイントの先頭の8バイト
+const checkpointMagic = "ZDLCKPT\x00"
+
+// Checkpoint は、チェックポイントの内容
+//
+// ファイルの形式（整数はビッグエンディアン）
+//
+//	"ZDLCKPT\x00" | バージョン(uint32) | 本体の長さ(uint64) | 本体のSHA-256(32バイト) | 本体(gob)
+type Checkpoint struct {
+	Version int
+	Model   string // ネットワークの型名
+	Params  map[string]Tensor
+	// BatchNormalizationの移動平均・移動分散（"層の名前.RunningMean"など）
+	State     map[string]Tensor
+	Config    *ModelConfig
+	Optimizer *OptimizerState
+}
+
+// Tensor は、任意の階数のパラメタの形と値
+type Tensor struct {
+	Shape []int
+	Data  []float64
+}
+
+// OptimizerState は、学習を再開するための最適化手法の状態
+// 学習率などのハイパーパラメタは含まない
+type OptimizerState struct {
+	Type  string
+	Iter  int
+	Slots map[string]map[string]Tensor // "M"・"V"などのパラメタごとの値
+}
+
+// WriteCheckpoint は、cをwに書く
+func WriteCheckpoint(w io.Writer, c *Checkpoint) error {
+	body := &bytes.Buffer{}
+	if err := gob.NewEncoder(body).Encode(c); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body.Bytes())
+	header := &bytes.Buffer{}
+	header.WriteString(checkpointMagic)
+	binary.Write(header, binary.BigEndian, uint32(c.Version))
+	binary.Write(header, binary.BigEndian, uint64(body.Len()))
+	header.Write(sum[:])
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// ReadCheckpoint は、rからチェックポイントを読む
+// 形式が違う・新しいバージョン・壊れている・ヘッダと本体のバージョンが違う場合はエラーを返す
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != checkpointMagic {
+		return nil, errors.New("not a checkpoint")
+	}
+	var version uint32
+	var length uint64
+	sum := make([]byte, sha256.Size)
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version > CheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, sum); err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	if n, err := io.CopyN(body, r, int64(length)); err != nil {
+		return nil, fmt.Errorf("checkpoint is truncated (%d of %d bytes)", n, length)
+	}
+	if actual := sha256.Sum256(body.Bytes()); !bytes.Equal(actual[:], sum) {
+		return nil, errors.New("checkpoint checksum mismatch")
+	}
+	c := &Checkpoint{}
+	if err := gob.NewDecoder(body).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Version != int(version) {
+		return nil, fmt.Errorf("checkpoint header version %d does not match body version %d", version, c.Version)
+	}
+	return c, nil
+}
+
+// checkpointTarget は、ネットワークのうちチェックポイントに保存するもの
+type checkpointTarget struct {
+	model string
+	// パラメタ（読み込むときは同じ形の値をそのまま上書きする）
+	params map[string]interface{}
+	// BatchNormalizationを探す層
+	layers map[string]interface{}
+	// 層の順番（BatchNormalizationの大きさを直前の全結合層から求める）
+	sequence  []string
+	optimizer interface{}
+	config    *ModelConfig
+}
+
+func (t *checkpointTarget) save(w io.Writer) error {
+	c := &Checkpoint{
+		Version: CheckpointVersion,
+		Model:   t.model,
+		Params:  map[string]Tensor{},
+		State:   map[string]Tensor{},
+		Config:  t.config,
+	}
+	for k, p := range t.params {
+		c.Params[k] = toTensor(p)
+	}
+	for name, l := range t.layers {
+		if bn, ok := l.(*layer.BatchNormalization); ok && bn.RunningMean != nil {
+			c.State[name+".RunningMean"] = toTensor(bn.RunningMean)
+			c.State[name+".RunningVar"] = toTensor(bn.RunningVar)
+		}
+	}
+	if t.optimizer != nil {
+		c.Optimizer = optimizerState(t.optimizer)
+	}
+	return WriteCheckpoint(w, c)
+}
+
+func (t *checkpointTarget) load(r io.Reader) error {
+	c, err := ReadCheckpoint(r)
+	if err != nil {
+		return err
+	}
+	return t.restore(c)
+}
+
+func (t *checkpointTarget) restore(c *Checkpoint) error {
+	if c.Model != t.model {
+		return fmt.Errorf("checkpoint is for %s, not %s", c.Model, t.model)
+	}
+	// 全部確かめてから書き換える
+	for k := range c.Params {
+		if _, ok := t.params[k]; !ok {
+			return fmt.Errorf("%s has no parameter %q", t.model, k)
+		}
+	}
+	for k, p := range t.params {
+		saved, ok := c.Params[k]
+		if !ok {
+			return fmt.Errorf("checkpoint has no parameter %q", k)
+		}
+		shape, _ := shapeOf(p)
+		if err := checkTensor(fmt.Sprintf("parameter %q", k), saved, shape); err != nil {
+			return err
+		}
+	}
+	if err := t.checkState(c.State); err != nil {
+		return err
+	}
+	if c.Optimizer != nil && t.optimizer != nil {
+		if err := t.checkOptimizer(c.Optimizer); err != nil {
+			return err
+		}
+	}
+
+	for k, p := range t.params {
+		data := c.Params[k].Data
+		for _, m := range matrices(p) {
+			n := copy(m.Vector, data)
+			data = data[n:]
+		}
+	}
+	for name, l := range t.layers {
+		bn, ok := l.(*layer.BatchNormalization)
+		if !ok {
+			continue
+		}
+		if mean, ok := c.State[name+".RunningMean"]; ok {
+			bn.RunningMean = fromTensor(mean).(*num.Matrix)
+			bn.RunningVar = fromTensor(c.State[name+".RunningVar"]).(*num.Matrix)
+		}
+	}
+	if c.Optimizer != nil && t.optimizer != nil {
+		restoreOptimizer(t.optimizer, c.Optimizer)
+	}
+	return nil
+}
+
+// checkTensor は、保存したテンソルの形がshapeで、値の数が形に合っているか確かめる
+func checkTensor(name string, saved Tensor, shape []int) error {
+	if !reflect.DeepEqual(shape, saved.Shape) {
+		return fmt.Errorf("%s has shape %v, checkpoint has %v", name, shape, saved.Shape)
+	}
+	if len(saved.Data) != prod(saved.Shape) {
+		return fmt.Errorf("%s has %d values for shape %v", name, len(saved.Data), saved.Shape)
+	}
+	return nil
+}
+
+// checkState は、BatchNormalizationの移動平均・移動分散がそろっていて、層の大きさに合うか確かめる
+func (t *checkpointTarget) checkState(state map[string]Tensor) error {
+	for k := range state {
+		name := strings.TrimSuffix(strings.TrimSuffix(k, ".RunningMean"), ".RunningVar")
+		if _, ok := t.layers[name].(*layer.BatchNormalization); !ok || name == k {
+			return fmt.Errorf("%s has no state %q", t.model, k)
+		}
+	}
+	for name, l := range t.layers {
+		bn, ok := l.(*layer.BatchNormalization)
+		if !ok {
+			continue
+		}
+		mean, hasMean := state[name+".RunningMean"]
+		_, hasVar := state[name+".RunningVar"]
+		if hasMean != hasVar {
+			return fmt.Errorf("checkpoint has only one of the running statistics of %q", name)
+		}
+		if !hasMean {
+			continue
+		}
+		width := t.bnWidth(name, bn)
+		if width < 0 && len(mean.Shape) == 2 {
+			width = mean.Shape[1]
+		}
+		for _, k := range []string{name + ".RunningMean", name + ".RunningVar"} {
+			if err := checkTensor(fmt.Sprintf("state %q", k), state[k], []int{1, width}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bnWidth は、BatchNormalizationの移動平均の列数（分からなければ-1）
+// まだ順伝搬していなければ、直前の全結合層の出力の数にする
+func (t *checkpointTarget) bnWidth(name string, bn *layer.BatchNormalization) int {
+	if bn.RunningMean != nil {
+		return bn.RunningMean.Columns
+	}
+	width := -1
+	for _, k := range t.sequence {
+		if k == name {
+			return width
+		}
+		switch l := t.layers[k].(type) {
+		case *layer.Affine:
+			width = l.W.Columns
+		case *layer.DropConnect:
+			width = l.W.Columns
+		}
+	}
+	return -1
+}
+
+// checkOptimizer は、最適化手法の種類と、状態の各値がパラメタと同じ形か確かめる
+func (t *checkpointTarget) checkOptimizer(s *OptimizerState) error {
+	if typ := typeName(t.optimizer); s.Type != typ {
+		return fmt.Errorf("checkpoint optimizer is %s, not %s", s.Type, typ)
+	}
+	slots := optimizerState(t.optimizer).Slots
+	for slot, tensors := range s.Slots {
+		if _, ok := slots[slot]; !ok {
+			return fmt.Errorf("%s has no state %q", s.Type, slot)
+		}
+		for k, saved := range tensors {
+			p, ok := t.params[k]
+			if !ok {
+				return fmt.Errorf("optimizer state %s has unknown parameter %q", slot, k)
+			}
+			shape, _ := shapeOf(p)
+			if err := checkTensor(fmt.Sprintf("optimizer state %s[%q]", slot, k), saved, shape); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func typeName(x interface{}) string {
+	return reflect.Indirect(reflect.ValueOf(x)).Type().Name()
+}
+
+func toTensor(x interface{}) Tensor {
+	shape, err := shapeOf(x)
+	if err != nil {
+		panic(err)
+	}
+	data := make([]float64, 0, prod(shape))
+	for _, m := range matrices(x) {
+		data = append(data, m.Vector...)
+	}
+	return Tensor{Shape: shape, Data: data}
+}
+
+// fromTensor は、階数に応じて*num.Matrix・num.Tensor3D・num.Tensor4D・num.Tensor5Dにする
+func fromTensor(t Tensor) interface{} {
+	x := zerosOf(t.Shape)
+	data := t.Data
+	for _, m := range matrices(x) {
+		n := copy(m.Vector, data)
+		data = data[n:]
+	}
+	return x
+}
+
+// matrices は、テンソルを構成する行列（Flattenの順）
+func matrices(x interface{}) []*num.Matrix {
+	switch v := x.(type) {
+	case *num.Matrix:
+		return []*num.Matrix{v}
+	case num.Tensor3D:
+		return v
+	case num.Tensor4D:
+		ms := []*num.Matrix{}
+		for _, t3d := range v {
+			ms = append(ms, t3d...)
+		}
+		return ms
+	case num.Tensor5D:
+		ms := []*num.Matrix{}
+		for _, t4d := range v {
+			ms = append(ms, matrices(t4d)...)
+		}
+		return ms
+	}
+	panic(fmt.Sprintf("unsupported tensor %T", x))
+}
+
+func optimizerState(opt interface{}) *OptimizerState {
+	s := &OptimizerState{Type: typeName(opt), Slots: map[string]map[string]Tensor{}}
+	matrixSlot := func(m map[string]*num.Matrix) map[string]Tensor {
+		slot := map[string]Tensor{}
+		for k, v := range m {
+			slot[k] = toTensor(v)
+		}
+		return slot
+	}
+	anySlot := func(m map[string]interface{}) map[string]Tensor {
+		slot := map[string]Tensor{}
+		for k, v := range m {
+			slot[k] = toTensor(v)
+		}
+		return slot
+	}
+	switch o := opt.(type) {
+	case *optimizer.Momentum:
+		s.Slots["V"] = matrixSlot(o.V)
+	case *optimizer.AdaGrad:
+		s.Slots["H"] = matrixSlot(o.H)
+	case *optimizer.Adam:
+		s.Iter = o.Iter
+		s.Slots["M"] = matrixSlot(o.M)
+		s.Slots["V"] = matrixSlot(o.V)
+	case *optimizer.AdamAny:
+		s.Iter = o.Iter
+		s.Slots["M"] = anySlot(o.M)
+		s.Slots["V"] = anySlot(o.V)
+	}
+	return s
+}
+
+// restoreOptimizer は、保存したときにまだ一度も更新していなかったスロットはnilに戻す
+func restoreOptimizer(opt interface{}, s *OptimizerState) {
+	matrixSlot := func(name string) map[string]*num.Matrix {
+		if len(s.Slots[name]) == 0 {
+			return nil
+		}
+		m := map[string]*num.Matrix{}
+		for k, t := range s.Slots[name] {
+			m[k] = fromTensor(t).(*num.Matrix)
+		}
+		return m
+	}
+	anySlot := func(name string) map[string]interface{} {
+		if len(s.Slots[name]) == 0 {
+			return nil
+		}
+		m := map[string]interface{}{}
+		for k, t := range s.Slots[name] {
+			m[k] = fromTensor(t)
+		}
+		return m
+	}
+	switch o := opt.(type) {
+	case *optimizer.Momentum:
+		o.V = matrixSlot("V")
+	case *optimizer.AdaGrad:
+		o.H = matrixSlot("H")
+	case *optimizer.Adam:
+		o.Iter = s.Iter
+		o.M, o.V = matrixSlot("M"), matrixSlot("V")
+	case *optimizer.AdamAny:
+		o.Iter = s.Iter
+		o.M, o.V = anySlot("M"), anySlot("V")
+	}
+}
+
+func matrixParams(params map[string]*num.Matrix) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, p := range params {
+		m[k] = p
+	}
+	return m
+}
+
+// graphParams は、Graphの各ノードの層のパラメタ（"ノードの名前.フィールド名"）
+func graphParams(prefix string, g *Graph, params map[string]interface{}) {
+	for name, node := range g.Nodes {
+		layerParams(prefix+name, node.Layer, params)
+	}
+}
+
+// layerParams は、層のパラメタを"name.フィールド名"でparamsに加える
+func layerParams(name string, l interface{}, params map[string]interface{}) {
+	add := func(field string, p interface{}) {
+		params[name+"."+field] = p
+	}
+	switch v := l.(type) {
+	case *layer.Affine:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.AffineT4D:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.DropConnect:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.TimeAffine:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.Convolution:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.Conv2D:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.ConvTranspose2D:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.Conv3D:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.Conv1D:
+		add("W", v.W)
+		add("B", v.B)
+	case *layer.DepthwiseSeparableConv2D:
+		layerParams(name+".Depthwise", v.Depthwise, params)
+		layerParams(name+".Pointwise", v.Pointwise, params)
+	case *layer.PReLU:
+		add("Alpha", v.Alpha)
+	case *layer.Embedding:
+		add("W", v.W)
+	case *layer.LayerNormalization:
+		add("Gamma", v.Gamma)
+		add("Beta", v.Beta)
+	case *layer.GroupNormalization:
+		add("Gamma", v.Gamma)
+		add("Beta", v.Beta)
+	case *layer.InstanceNormalization:
+		add("Gamma", v.Gamma)
+		add("Beta", v.Beta)
+	case *layer.TimeRNN:
+		add("Wx", v.Wx)
+		add("Wh", v.Wh)
+		add("B", v.B)
+	case *layer.TimeLSTM:
+		add("Wx", v.Wx)
+		add("Wh", v.Wh)
+		add("B", v.B)
+	case *layer.TimeGRU:
+		add("Wx", v.Wx)
+		add("Wh", v.Wh)
+		add("B", v.B)
+	case *layer.MultiHeadAttention:
+		add("Wq", v.Wq)
+		add("Bq", v.Bq)
+		add("Wk", v.Wk)
+		add("Bk", v.Bk)
+		add("Wv", v.Wv)
+		add("Bv", v.Bv)
+		add("Wo", v.Wo)
+		add("Bo", v.Bo)
+	case *layer.TransformerEncoder:
+		layerParams(name+".Attention", v.Attention, params)
+		layerParams(name+".Norm1", v.Norm1, params)
+		layerParams(name+".Norm2", v.Norm2, params)
+		layerParams(name+".FFN1", v.FFN1, params)
+		layerParams(name+".FFN2", v.FFN2, params)
+	case *Graph:
+		graphParams(name+".", v, params)
+	}
+}
+
+func (net *TwoLayerNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "TwoLayerNet", params: matrixParams(net.Params), layers: layerMap(net.Layers), sequence: net.Sequence, optimizer: net.Optimizer}
+}
+
+func (net *ThreeLayerNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "ThreeLayerNet", params: matrixParams(net.Params), layers: layerMap(net.Layers), sequence: net.Sequence, optimizer: net.Optimizer}
+}
+
+func (net *FourLayerNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "FourLayerNet", params: matrixParams(net.Params), layers: layerMap(net.Layers), sequence: net.Sequence, optimizer: net.Optimizer}
+}
+
+func (net *MultiLayerNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "MultiLayerNet", params: matrixParams(net.Params), layers: layerMap(net.Layers), sequence: net.Sequence, optimizer: net.Optimizer}
+}
+
+func (net *Sequential) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "Sequential", params: matrixParams(net.Params), layers: layerMap(net.Layers), sequence: net.Sequence, optimizer: net.Optimizer, config: net.Config}
+}
+
+func (net *SimpleConvNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "SimpleConvNet", params: net.Params, optimizer: net.Optimizer}
+}
+
+func (net *SlowTwoLayerNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "SlowTwoLayerNet", params: matrixParams(net.Params)}
+}
+
+func (net *BasicNetwork) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "BasicNetwork", params: matrixParams(net.Network)}
+}
+
+func (net *SimpleNet) checkpoint() *checkpointTarget {
+	return &checkpointTarget{model: "SimpleNet", params: map[string]interface{}{"W": net.W}}
+}
+
+func (g *Graph) checkpoint() *checkpointTarget {
+	params := map[string]interface{}{}
+	graphParams("", g, params)
+	layers := map[string]interface{}{}
+	for name, node := range g.Nodes {
+		layers[name] = node.Layer
+	}
+	return &checkpointTarget{model: "Graph", params: params, layers: layers}
+}
+
+// Save は、パラメタ・BatchNormalizationの統計量・最適化手法の状態を書き出す
+func (net *TwoLayerNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+
+// Load は、Saveで書き出したものを読み込む（ネットワークの構成は同じにしておく）
+func (net *TwoLayerNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *ThreeLayerNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *ThreeLayerNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *FourLayerNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *FourLayerNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *MultiLayerNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *MultiLayerNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+// Save は、ModelConfig.Buildで作った場合は設定も書き出す
+func (net *Sequential) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *Sequential) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *SimpleConvNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *SimpleConvNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *SlowTwoLayerNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *SlowTwoLayerNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *BasicNetwork) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *BasicNetwork) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (net *SimpleNet) Save(w io.Writer) error { return net.checkpoint().save(w) }
+func (net *SimpleNet) Load(r io.Reader) error { return net.checkpoint().load(r) }
+
+func (g *Graph) Save(w io.Writer) error { return g.checkpoint().save(w) }
+func (g *Graph) Load(r io.Reader) error { return g.checkpoint().load(r) }
+
+// LoadSequential は、設定を含むチェックポイントからSequentialを作る
+func LoadSequential(r io.Reader, opt optimizer.Optimizer) (*Sequential, error) {
+	c, err := ReadCheckpoint(r)
+	if err != nil {
+		return nil, err
+	}
+	if c.Config == nil {
+		return nil, errors.New("checkpoint has no model config")
+	}
+	net, err := c.Config.Build(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := net.checkpoint().restore(c); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
@@ -0,0 +1,215 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+func oneHot(labels []int, classes int) *num.Matrix {
+	t := num.Zeros(len(labels), classes)
+	for i, l := range labels {
+		t.Vector[i*classes+l] = 1
+	}
+	return t
+}
+
+func TestSequentialCheckpoint(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewAdam(0.01))
+	x, _ := num.NewRandnMatrix(4, 4)
+	label := oneHot([]int{0, 1, 2, 1}, 3)
+	for i := 0; i < 3; i++ {
+		net.UpdateParams(net.Gradient(x, label))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := net.Save(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	adam := optimizer.NewAdam(0.01)
+	loaded, err := LoadSequential(buf, adam)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	// 推論時はBatchNormの移動平均・移動分散を使う
+	if !num.Equal(net.Predict(x, false), loaded.Predict(x, false)) {
+		fmt.Println(net.Predict(x, false), loaded.Predict(x, false))
+		t.Fail()
+	}
+	if adam.Iter != 3 || !num.Equal(adam.M["W2"], net.Optimizer.(*optimizer.Adam).M["W2"]) {
+		fmt.Println(adam.Iter, adam.M["W2"])
+		t.Fail()
+	}
+	// 学習を続けても同じになる（Dropoutのマスクはそろえる）
+	net.Layers["Dropout1"].(*layer.Dropout).Seed(1)
+	loaded.Layers["Dropout1"].(*layer.Dropout).Seed(1)
+	net.UpdateParams(net.Gradient(x, label))
+	loaded.UpdateParams(loaded.Gradient(x, label))
+	if !num.Equal(net.Params["W1"], loaded.Params["W1"]) {
+		fmt.Println(net.Params["W1"], loaded.Params["W1"])
+		t.Fail()
+	}
+}
+
+func TestSimpleConvNetCheckpoint(t *testing.T) {
+	newNet := func() *SimpleConvNet {
+		return NewSimpleConvNet(optimizer.NewAdamAny(0.01),
+			&InputDim{Channel: 1, Height: 6, Weidth: 6},
+			&ConvParams{FilterNum: 2, FilterSize: 3, Pad: 1, Stride: 1},
+			5, 3, 0.01)
+	}
+	net := newNet()
+	x, _ := num.NewRandnT4D(2, 1, 6, 6)
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 2}, 3)))
+
+	buf := &bytes.Buffer{}
+	if err := net.Save(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	loaded := newNet()
+	if err := loaded.Load(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if !num.Equal(net.Predict(x).(*num.Matrix), loaded.Predict(x).(*num.Matrix)) {
+		fmt.Println(net.Predict(x), loaded.Predict(x))
+		t.Fail()
+	}
+	if loaded.Optimizer.(*optimizer.AdamAny).Iter != 1 {
+		t.Fail()
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	net := NewTwoLayerNet(optimizer.NewSGD(0.1), 3, 4, 2, 0)
+	buf := &bytes.Buffer{}
+	net.Save(buf)
+	saved := buf.Bytes()
+
+	corrupt := func(f func(b []byte) []byte) error {
+		b := f(append([]byte{}, saved...))
+		return NewTwoLayerNet(optimizer.NewSGD(0.1), 3, 4, 2, 0).Load(bytes.NewReader(b))
+	}
+	cases := map[string]struct {
+		f   func(b []byte) []byte
+		err string
+	}{
+		"flipped":   {func(b []byte) []byte { b[len(b)-10] ^= 0xff; return b }, "checksum"},
+		"truncated": {func(b []byte) []byte { return b[:len(b)-1] }, "truncated"},
+		"version":   {func(b []byte) []byte { b[11] = CheckpointVersion + 1; return b }, "version"},
+		"magic":     {func(b []byte) []byte { b[0] = 'X'; return b }, "not a checkpoint"},
+	}
+	for name, c := range cases {
+		if err := corrupt(c.f); err == nil || !strings.Contains(err.Error(), c.err) {
+			fmt.Println(name, err)
+			t.Fail()
+		}
+	}
+
+	if err := NewTwoLayerNet(optimizer.NewSGD(0.1), 3, 5, 2, 0).Load(bytes.NewReader(saved)); err == nil {
+		fmt.Println("shape mismatch is not detected")
+		t.Fail()
+	}
+	if err := NewThreeLayerNet(optimizer.NewSGD(0.1), 3, 4, 2, 0).Load(bytes.NewReader(saved)); err == nil {
+		fmt.Println("model mismatch is not detected")
+		t.Fail()
+	}
+
+	// 読み込む先にないパラメタ
+	c, _ := ReadCheckpoint(bytes.NewReader(saved))
+	c.Params["W3"] = c.Params["W2"]
+	buf.Reset()
+	WriteCheckpoint(buf, c)
+	if err := NewTwoLayerNet(optimizer.NewSGD(0.1), 3, 4, 2, 0).Load(buf); err == nil || !strings.Contains(err.Error(), `"W3"`) {
+		fmt.Println("unknown parameter:", err)
+		t.Fail()
+	}
+
+	// ヘッダのバージョンだけを書き換えたもの
+	c.Version = 0
+	buf.Reset()
+	WriteCheckpoint(buf, c)
+	b := buf.Bytes()
+	b[11] = CheckpointVersion
+	if _, err := ReadCheckpoint(bytes.NewReader(b)); err == nil || !strings.Contains(err.Error(), "does not match") {
+		fmt.Println("version mismatch:", err)
+		t.Fail()
+	}
+}
+
+func TestGraphCheckpoint(t *testing.T) {
+	newBlock := func() *Graph {
+		w1, _ := num.NewRandnT4D(2, 2, 3, 3)
+		w2, _ := num.NewRandnT4D(2, 2, 3, 3)
+		b1, _ := num.NewRandnMatrix(1, 2)
+		b2, _ := num.NewRandnMatrix(1, 2)
+		return NewResidualBlock(w1, b1, w2, b2)
+	}
+	g := newBlock()
+	buf := &bytes.Buffer{}
+	if err := g.Save(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	loaded := newBlock()
+	if err := loaded.Load(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	x, _ := num.NewRandnT4D(1, 2, 4, 4)
+	if !num.EqualT4D(g.Forward(x).(num.Tensor4D), loaded.Forward(x).(num.Tensor4D)) {
+		t.Fail()
+	}
+}
+
+// TestCheckpointCorruptState は、BatchNormalizationの統計量・最適化手法の状態が壊れたチェックポイント
+func TestCheckpointCorruptState(t *testing.T) {
+	net := NewTwoLayerNet(optimizer.NewAdam(0.01), 3, 4, 2, 0)
+	x, _ := num.NewRandnMatrix(4, 3)
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 1, 0}, 2)))
+	buf := &bytes.Buffer{}
+	net.Save(buf)
+	saved := buf.Bytes()
+
+	cases := map[string]struct {
+		f   func(c *Checkpoint)
+		err string
+	}{
+		"missing var": {func(c *Checkpoint) { delete(c.State, "BatchNorm1.RunningVar") }, "only one of"},
+		"mean shape": {func(c *Checkpoint) {
+			c.State["BatchNorm1.RunningMean"] = Tensor{Shape: []int{1, 5}, Data: make([]float64, 5)}
+		}, "has shape"},
+		"3d var": {func(c *Checkpoint) {
+			c.State["BatchNorm1.RunningVar"] = Tensor{Shape: []int{1, 1, 4}, Data: make([]float64, 4)}
+		}, "has shape"},
+		"unknown state": {func(c *Checkpoint) { c.State["Relu1.RunningMean"] = c.State["BatchNorm1.RunningMean"] }, `"Relu1.RunningMean"`},
+		"short data":    {func(c *Checkpoint) { p := c.Params["W1"]; p.Data = p.Data[1:]; c.Params["W1"] = p }, "values"},
+		"slot shape":    {func(c *Checkpoint) { c.Optimizer.Slots["M"]["W1"] = c.Optimizer.Slots["M"]["W2"] }, "has shape"},
+		"slot param":    {func(c *Checkpoint) { c.Optimizer.Slots["V"]["W3"] = c.Optimizer.Slots["V"]["W2"] }, `"W3"`},
+		"slot name":     {func(c *Checkpoint) { c.Optimizer.Slots["H"] = c.Optimizer.Slots["V"] }, `"H"`},
+	}
+	for name, cs := range cases {
+		c, _ := ReadCheckpoint(bytes.NewReader(saved))
+		cs.f(c)
+		b := &bytes.Buffer{}
+		WriteCheckpoint(b, c)
+		// まだ順伝搬していないネットワークは、BatchNormalizationの大きさを直前の全結合層から求める
+		if err := NewTwoLayerNet(optimizer.NewAdam(0.01), 3, 4, 2, 0).Load(b); err == nil || !strings.Contains(err.Error(), cs.err) {
+			fmt.Println(name, err)
+			t.Fail()
+		}
+	}
+	if err := NewTwoLayerNet(optimizer.NewAdam(0.01), 3, 4, 2, 0).Load(bytes.NewReader(saved)); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+	"gopkg.in/yaml.v3"
+)
+
+// ModelConfig は、Sequentialの設定ファイルの内容
+//
+//	input_size: 784
+//	weight_decay_lambda: 0.1
+//	loss: softmax_cross_entropy
+//	layers:
+//	  - {type: affine, units: 100, init: he_normal}
+//	  - {type: batchnorm}
+//	  - {type: relu}
+//	  - {type: dropout, ratio: 0.5}
+//	  - {type: affine, units: 10}
+type ModelConfig struct {
+	InputSize         int           `json:"input_size" yaml:"input_size"`
+	Layers            []LayerConfig `json:"layers" yaml:"layers"`
+	Loss              string        `json:"loss,omitempty" yaml:"loss,omitempty"`
+	WeightDecayLambda float64       `json:"weight_decay_lambda,omitempty" yaml:"weight_decay_lambda,omitempty"`
+}
+
+// LayerConfig は、1つの層の種類とハイパーパラメタ
+// 使わないハイパーパラメタは省略する
+type LayerConfig struct {
+	Type string `json:"type" yaml:"type"`
+	// affine, dropconnect, embedding（ベクトルの次元）
+	Units int    `json:"units,omitempty" yaml:"units,omitempty"`
+	Init  string `json:"init,omitempty" yaml:"init,omitempty"` // 省略時はhe_normal（embeddingはnormal）
+	// embedding（語彙数と、ベクトルを0のまま学習しないid）
+	Vocab      int  `json:"vocab,omitempty" yaml:"vocab,omitempty"`
+	PaddingIdx *int `json:"padding_idx,omitempty" yaml:"padding_idx,omitempty"`
+	// dropout, dropconnect
+	Ratio float64 `json:"ratio,omitempty" yaml:"ratio,omitempty"`
+	// leaky_relu（省略時は0.01）, elu（省略時は1）
+	Alpha float64 `json:"alpha,omitempty" yaml:"alpha,omitempty"`
+	// batchnorm（省略時は1）
+	Gamma *float64 `json:"gamma,omitempty" yaml:"gamma,omitempty"`
+	// batchnorm（省略時は0）, swish（省略時は1）
+	Beta float64 `json:"beta,omitempty" yaml:"beta,omitempty"`
+}
+
+// ReadConfig は、YAMLかJSONの設定を読む（JSONはYAMLとして読める）
+// 知らないキーはエラーにする
+func ReadConfig(r io.Reader) (*ModelConfig, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	cfg := &ModelConfig{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// layerNames は、設定の種類ごとの層の名前（後ろに通し番号をつける）
+var layerNames = map[string]string{
+	"affine":      "Affine",
+	"dropconnect": "DropConnect",
+	"batchnorm":   "BatchNorm",
+	"relu":        "Relu",
+	"sigmoid":     "Sigmoid",
+	"tanh":        "Tanh",
+	"leaky_relu":  "LeakyRelu",
+	"elu":         "Elu",
+	"gelu":        "Gelu",
+	"swish":       "Swish",
+	"softplus":    "Softplus",
+	"dropout":     "Dropout",
+	"embedding":   "Embedding",
+}
+
+// Build は、設定からSequentialを作る
+func (cfg *ModelConfig) Build(opt optimizer.Optimizer) (*Sequential, error) {
+	if err := checkWeightDecay(opt, cfg.WeightDecayLambda); err != nil {
+		return nil, err
+	}
+	net := NewSequential(opt, cfg.WeightDecayLambda)
+	net.Config = cfg
+	loss, err := lossLayer(cfg.Loss)
+	if err != nil {
+		return nil, err
+	}
+	net.SetLoss(loss)
+
+	size := cfg.InputSize
+	counts := map[string]int{}
+	for i, lc := range cfg.Layers {
+		base, ok := layerNames[lc.Type]
+		if !ok {
+			return nil, fmt.Errorf("layers[%d]: unknown layer type %q", i, lc.Type)
+		}
+		counts[base]++
+		name := fmt.Sprintf("%s%d", base, counts[base])
+
+		var l interface{}
+		switch lc.Type {
+		case "affine", "dropconnect":
+			if lc.Units <= 0 {
+				return nil, fmt.Errorf("layers[%d]: %s needs units", i, lc.Type)
+			}
+			ini, err := initializer.ByName(orDefaultName(lc.Init, "he_normal"))
+			if err != nil {
+				return nil, fmt.Errorf("layers[%d]: %v", i, err)
+			}
+			w := initializer.Matrix(ini, size, lc.Units)
+			b := num.Zeros(1, lc.Units)
+			if lc.Type == "affine" {
+				l = layer.NewAffine(w, b)
+			} else {
+				l = layer.NewDropConnect(w, b, lc.Ratio)
+			}
+			size = lc.Units
+		case "embedding":
+			// 入力は(N, T)のid、出力は(N, T*units)
+			if lc.Units <= 0 || lc.Vocab <= 0 {
+				return nil, fmt.Errorf("layers[%d]: embedding needs units and vocab", i)
+			}
+			ini, err := initializer.ByName(orDefaultName(lc.Init, "normal"))
+			if err != nil {
+				return nil, fmt.Errorf("layers[%d]: %v", i, err)
+			}
+			paddingIdx := -1
+			if lc.PaddingIdx != nil {
+				paddingIdx = *lc.PaddingIdx
+				if paddingIdx < 0 || paddingIdx >= lc.Vocab {
+					return nil, fmt.Errorf("layers[%d]: padding_idx %d is out of vocab %d", i, paddingIdx, lc.Vocab)
+				}
+			}
+			l = layer.NewEmbedding(initializer.Matrix(ini, lc.Vocab, lc.Units), paddingIdx)
+			size *= lc.Units
+		case "batchnorm":
+			gamma := 1.0
+			if lc.Gamma != nil {
+				gamma = *lc.Gamma
+			}
+			l = layer.NewBatchNorimalization(gamma, lc.Beta)
+		case "relu":
+			l = layer.NewRelu()
+		case "sigmoid":
+			l = layer.NewSigmoid()
+		case "tanh":
+			l = layer.NewTanh()
+		case "leaky_relu":
+			l = layer.NewLeakyRelu(orDefault(lc.Alpha, 0.01))
+		case "elu":
+			l = layer.NewElu(orDefault(lc.Alpha, 1))
+		case "gelu":
+			l = layer.NewGelu()
+		case "swish":
+			l = layer.NewSwish(orDefault(lc.Beta, 1))
+		case "softplus":
+			l = layer.NewSoftplus()
+		case "dropout":
+			l = layer.NewDropout(lc.Ratio)
+		}
+		net.Add(name, l)
+	}
+	return net, nil
+}
+
+// orDefault は、省略された（ゼロ値の）ハイパーパラメタを既定値にする
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// orDefaultName は、省略された初期化方法などの名前を既定値にする
+func orDefaultName(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func lossLayer(name string) (layer.LossLayer, error) {
+	switch name {
+	case "", "softmax_cross_entropy":
+		return layer.NewSfotmaxWithLoss(), nil
+	case "mse":
+		return layer.NewMSELoss(layer.REDUCEMEAN), nil
+	case "mae":
+		return layer.NewMAELoss(layer.REDUCEMEAN), nil
+	case "bce_with_logits":
+		return layer.NewBCEWithLogitsLoss(layer.REDUCEMEAN), nil
+	case "hinge":
+		return layer.NewHingeLoss(layer.REDUCEMEAN), nil
+	}
+	return nil, fmt.Errorf("unknown loss %q", name)
+}
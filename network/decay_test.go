@@ -0,0 +1,65 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+func TestOptimizerWeightDecay(t *testing.T) {
+	opt := optimizer.NewSGD(0.1)
+	opt.WeightDecay = 0.5
+	opt.AddGroup(optimizer.ParamGroup{Pattern: "b*", WeightDecay: optimizer.Float(0)})
+	net := NewTwoLayerNet(opt, 3, 4, 2, 0)
+	// 0のバイアスは減衰しても変わらないので1にする
+	for _, k := range []string{"b1", "b2"} {
+		for i := range net.Params[k].Vector {
+			net.Params[k].Vector[i] = 1
+		}
+	}
+	x, _ := num.NewRandnMatrix(4, 3)
+	grads := net.Gradient(x, oneHot([]int{0, 1, 1, 0}, 2))
+	before := map[string]*num.Matrix{}
+	for k, p := range net.Params {
+		before[k] = num.Mul(1.0, p)
+	}
+	net.UpdateParams(grads)
+
+	// 重みだけ W - lr*(dW + WeightDecay*W)、バイアスは b - lr*db
+	for k, p := range before {
+		expected := num.Sub(p, num.Mul(0.1, grads[k]))
+		if strings.HasPrefix(k, "W") {
+			expected = num.Sub(expected, num.Mul(0.1*0.5, p))
+		}
+		if !closeEnough(net.Params[k].Vector, expected.Vector) {
+			fmt.Println(k, net.Params[k], expected)
+			t.Fail()
+		}
+	}
+
+	// ネットワークとオプティマイザの両方の重み減衰は二重になるのでエラー
+	func() {
+		defer func() {
+			if recover() == nil {
+				fmt.Println("NewTwoLayerNet accepts both weight decays")
+				t.Fail()
+			}
+		}()
+		NewTwoLayerNet(opt, 3, 4, 2, 0.1)
+	}()
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	if _, err := cfg.Build(opt); err == nil || !strings.Contains(err.Error(), "weight decay") {
+		fmt.Println(err)
+		t.Fail()
+	}
+	// グループだけで重み減衰する場合も同じ
+	grouped := optimizer.NewAdam(0.01)
+	grouped.AddGroup(optimizer.ParamGroup{Pattern: "W*", WeightDecay: optimizer.Float(0.01)})
+	if _, err := cfg.Build(grouped); err == nil {
+		fmt.Println("Build accepts both weight decays")
+		t.Fail()
+	}
+}
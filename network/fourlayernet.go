@@ -2,8 +2,8 @@ package network
 
 import (
 	"fmt"
-	"math"
 
+	"github.com/naronA/zero_deeplearning/initializer"
 	"github.com/naronA/zero_deeplearning/layer"
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/optimizer"
@@ -13,8 +13,9 @@ type FourLayerNet struct {
 	Params            map[string]*num.Matrix
 	Layers            map[string]layer.Layer
 	Sequence          []string
-	LastLayer         *layer.SoftmaxWithLoss
+	LastLayer         layer.LossLayer
 	Optimizer         optimizer.Optimizer
+	Trainable         // 凍結したパラメタはUpdateParamsで更新しない
 	HiddenLayerNum    int
 	WeightDecayLambda float64
 }
@@ -25,34 +26,22 @@ func NewFourLayerNet(
 	inputSize int,
 	hiddenSize int,
 	outputSize int,
-	weightDeceyLambda float64) *FourLayerNet {
-	params := map[string]*num.Matrix{}
-	layers := map[string]layer.Layer{}
-
-	W1, err := num.NewRandnMatrix(inputSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W2, err := num.NewRandnMatrix(hiddenSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W3, err := num.NewRandnMatrix(hiddenSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W4, err := num.NewRandnMatrix(hiddenSize, outputSize)
-	if err != nil {
+	weightDeceyLambda float64,
+	inits ...initializer.Initializer) *FourLayerNet {
+	if err := checkWeightDecay(opt, weightDeceyLambda); err != nil {
 		panic(err)
 	}
+	checkInits(inits, 4)
+	params := map[string]*num.Matrix{}
+	layers := map[string]layer.Layer{}
 
-	params["W1"] = num.Div(W1, math.Sqrt(2.0*float64(inputSize))) // weightInitStd
+	params["W1"] = newWeight(inits, 0, inputSize, hiddenSize)
 	params["b1"] = num.Zeros(1, hiddenSize)
-	params["W2"] = num.Div(W2, math.Sqrt(2.0*float64(hiddenSize)))
+	params["W2"] = newWeight(inits, 1, hiddenSize, hiddenSize)
 	params["b2"] = num.Zeros(1, hiddenSize)
-	params["W3"] = num.Div(W3, math.Sqrt(2.0*float64(hiddenSize)))
+	params["W3"] = newWeight(inits, 2, hiddenSize, hiddenSize)
 	params["b3"] = num.Zeros(1, hiddenSize)
-	params["W4"] = num.Div(W4, math.Sqrt(2.0*float64(hiddenSize)))
+	params["W4"] = newWeight(inits, 3, hiddenSize, outputSize)
 	params["b4"] = num.Zeros(1, outputSize)
 
 	layers["Affine1"] = layer.NewAffine(params["W1"], params["b1"])
@@ -155,7 +144,7 @@ func (net *FourLayerNet) Gradient(x, t *num.Matrix) map[string]*num.Matrix {
 }
 
 func (net *FourLayerNet) UpdateParams(grads map[string]*num.Matrix) {
-	net.Params = net.Optimizer.Update(net.Params, grads)
+	net.Params = net.update(net.Optimizer, net.Params, grads)
 
 	for i := 1; i < net.HiddenLayerNum+2; i++ {
 		l := fmt.Sprintf("Affine%d", i)
@@ -0,0 +1,273 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+// Trainable は、パラメタ（"W1"など）ごとに学習するかどうか（既定では全部学習する）
+// 凍結したパラメタは勾配をオプティマイザに渡さないので、値もオプティマイザの状態も変わらない
+type Trainable struct {
+	Frozen map[string]bool
+}
+
+// SetTrainable は、パラメタを学習するかどうかを設定する
+func (t *Trainable) SetTrainable(trainable bool, names ...string) {
+	if t.Frozen == nil {
+		t.Frozen = map[string]bool{}
+	}
+	for _, name := range names {
+		if trainable {
+			delete(t.Frozen, name)
+		} else {
+			t.Frozen[name] = true
+		}
+	}
+}
+
+func (t *Trainable) IsTrainable(name string) bool {
+	return !t.Frozen[name]
+}
+
+// update は、凍結していないパラメタだけを更新する
+// オプティマイザは勾配のあるパラメタだけを返すので、残りはそのまま残す
+func (t *Trainable) update(opt optimizer.Optimizer, params, grads map[string]*num.Matrix) map[string]*num.Matrix {
+	trainable := map[string]*num.Matrix{}
+	for k, g := range grads {
+		if t.IsTrainable(k) {
+			trainable[k] = g
+		}
+	}
+	updated := opt.Update(params, trainable)
+	for k, v := range params {
+		if _, ok := updated[k]; !ok {
+			updated[k] = v
+		}
+	}
+	return updated
+}
+
+func (t *Trainable) updateAny(opt optimizer.AnyOptimizer, params, grads map[string]interface{}) map[string]interface{} {
+	trainable := map[string]interface{}{}
+	for k, g := range grads {
+		if t.IsTrainable(k) {
+			trainable[k] = g
+		}
+	}
+	updated := opt.Update(params, trainable)
+	for k, v := range params {
+		if _, ok := updated[k]; !ok {
+			updated[k] = v
+		}
+	}
+	return updated
+}
+
+// setLayersTrainable は、層の名前をパラメタの名前にして設定する
+// 重みのない層（ReLUなど）は何もしない
+func (t *Trainable) setLayersTrainable(trainable bool, paramsOf func(string) ([]string, bool), names []string) error {
+	for _, name := range names {
+		if _, ok := paramsOf(name); !ok {
+			return fmt.Errorf("unknown layer %q", name)
+		}
+	}
+	for _, name := range names {
+		params, _ := paramsOf(name)
+		t.SetTrainable(trainable, params...)
+	}
+	return nil
+}
+
+// frozenSize は、層の名前から、その層の凍結したパラメタの要素数を返す関数（Summary用）
+func (t *Trainable) frozenSize(paramsOf func(string) ([]string, bool), params map[string]interface{}) func(string) int {
+	return func(name string) int {
+		n := 0
+		names, _ := paramsOf(name)
+		for _, k := range names {
+			if p, ok := params[k]; ok && !t.IsTrainable(k) {
+				shape, _ := shapeOf(p)
+				n += prod(shape)
+			}
+		}
+		return n
+	}
+}
+
+// affineParams は、TwoLayerNetなどの"Affinek"の層のパラメタ"Wk"・"bk"
+func affineParams(layers map[string]layer.Layer) func(string) ([]string, bool) {
+	return func(name string) ([]string, bool) {
+		if _, ok := layers[name]; !ok {
+			return nil, false
+		}
+		k := 0
+		if _, err := fmt.Sscanf(name, "Affine%d", &k); err != nil {
+			return nil, true
+		}
+		return []string{fmt.Sprintf("W%d", k), fmt.Sprintf("b%d", k)}, true
+	}
+}
+
+func (net *Sequential) layerParams(name string) ([]string, bool) {
+	if _, ok := net.Layers[name]; !ok {
+		return nil, false
+	}
+	for i, w := range net.weighted {
+		if w == name {
+			return []string{fmt.Sprintf("W%d", i+1), fmt.Sprintf("b%d", i+1)}, true
+		}
+	}
+	for i, e := range net.embeddings {
+		if e == name {
+			return []string{fmt.Sprintf("E%d", i+1)}, true
+		}
+	}
+	return nil, true
+}
+
+func (net *SimpleConvNet) layerParams(name string) ([]string, bool) {
+	if _, ok := net.T4DLayers[name]; !ok {
+		return nil, false
+	}
+	return map[string][]string{
+		"Conv1":   {"W1", "b1"},
+		"Affine1": {"W2", "b2"},
+		"Affine2": {"W3", "b3"},
+	}[name], true
+}
+
+// FreezeLayers は、層のパラメタを凍結する（ファインチューニングで畳み込み層などを固定する）
+func (net *TwoLayerNet) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, affineParams(net.Layers), names)
+}
+
+// UnfreezeLayers は、層のパラメタを再び学習する
+func (net *TwoLayerNet) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, affineParams(net.Layers), names)
+}
+
+func (net *ThreeLayerNet) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, affineParams(net.Layers), names)
+}
+
+func (net *ThreeLayerNet) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, affineParams(net.Layers), names)
+}
+
+func (net *FourLayerNet) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, affineParams(net.Layers), names)
+}
+
+func (net *FourLayerNet) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, affineParams(net.Layers), names)
+}
+
+func (net *MultiLayerNet) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, affineParams(net.Layers), names)
+}
+
+func (net *MultiLayerNet) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, affineParams(net.Layers), names)
+}
+
+func (net *Sequential) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, net.layerParams, names)
+}
+
+func (net *Sequential) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, net.layerParams, names)
+}
+
+func (net *SimpleConvNet) FreezeLayers(names ...string) error {
+	return net.setLayersTrainable(false, net.layerParams, names)
+}
+
+func (net *SimpleConvNet) UnfreezeLayers(names ...string) error {
+	return net.setLayersTrainable(true, net.layerParams, names)
+}
+
+// ReplaceHead は、出力層（Affine2）をoutputSizeクラスの新しい重みにする
+// 新しい重みは学習するパラメタにし、古い重みのオプティマイザの状態は捨てる
+func (net *SimpleConvNet) ReplaceHead(outputSize int, init initializer.Initializer) {
+	affine := net.T4DLayers["Affine2"].(*layer.AffineT4D)
+	affine.W = initializer.Matrix(init, affine.W.Rows, outputSize)
+	affine.B = num.Zeros(1, outputSize)
+	net.Params["W3"], net.Params["b3"] = affine.W, affine.B
+	net.SetTrainable(true, "W3", "b3")
+	resetOptimizerState(net.Optimizer, map[string]interface{}{"W3": affine.W, "b3": affine.B})
+}
+
+// ReplaceHead は、最後のAffine・DropConnectをoutputSizeユニットの新しい重みにする
+// Configがあれば、そのユニット数も変える（LoadSequentialで読めるように）
+func (net *Sequential) ReplaceHead(outputSize int, init initializer.Initializer) error {
+	k := len(net.weighted)
+	if k == 0 {
+		return fmt.Errorf("no affine or dropconnect layer")
+	}
+	w := initializer.Matrix(init, net.Params[fmt.Sprintf("W%d", k)].Rows, outputSize)
+	b := num.Zeros(1, outputSize)
+	switch v := net.Layers[net.weighted[k-1]].(type) {
+	case *layer.Affine:
+		v.W, v.B = w, b
+	case *layer.DropConnect:
+		v.W, v.B = w, b
+	}
+	wk, bk := fmt.Sprintf("W%d", k), fmt.Sprintf("b%d", k)
+	net.Params[wk], net.Params[bk] = w, b
+	net.SetTrainable(true, wk, bk)
+	resetOptimizerState(net.Optimizer, map[string]interface{}{wk: w, bk: b})
+
+	if net.Config != nil {
+		// 呼び出し側の設定は変えない
+		cfg := *net.Config
+		cfg.Layers = append([]LayerConfig{}, cfg.Layers...)
+		for i := len(cfg.Layers) - 1; i >= 0; i-- {
+			if cfg.Layers[i].Type == "affine" || cfg.Layers[i].Type == "dropconnect" {
+				cfg.Layers[i].Units = outputSize
+				break
+			}
+		}
+		net.Config = &cfg
+	}
+	return nil
+}
+
+// resetOptimizerState は、paramsのオプティマイザの状態を0に戻す（形が変わった重みのため）
+// まだ状態を持っていなければ、最初のUpdateで作られる
+func resetOptimizerState(opt interface{}, params map[string]interface{}) {
+	matrix := func(slot map[string]*num.Matrix) {
+		if slot == nil {
+			return
+		}
+		for k, v := range params {
+			slot[k] = num.ZerosLike(v.(*num.Matrix))
+		}
+	}
+	switch o := opt.(type) {
+	case *optimizer.Momentum:
+		matrix(o.V)
+	case *optimizer.AdaGrad:
+		matrix(o.H)
+	case *optimizer.Adam:
+		matrix(o.M)
+		matrix(o.V)
+	case *optimizer.AdamAny:
+		if o.M == nil {
+			return
+		}
+		for k, v := range params {
+			o.M[k] = zerosLikeAny(v)
+			o.V[k] = zerosLikeAny(v)
+		}
+	}
+}
+
+func zerosLikeAny(x interface{}) interface{} {
+	if t4d, ok := x.(num.Tensor4D); ok {
+		return num.ZerosLikeT4D(t4d)
+	}
+	return num.ZerosLike(x.(*num.Matrix))
+}
@@ -0,0 +1,142 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+// equalParam は、*num.Matrixかnum.Tensor4Dのパラメタが等しいか
+func equalParam(p1, p2 interface{}) bool {
+	m1, m2 := matrices(p1), matrices(p2)
+	if len(m1) != len(m2) {
+		return false
+	}
+	for i := range m1 {
+		if !num.Equal(m1[i], m2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 学習済みのモデルを読み、出力層を変えて畳み込み層などを固定したまま学習する
+func TestSimpleConvNetFineTune(t *testing.T) {
+	newNet := func() *SimpleConvNet {
+		return NewSimpleConvNet(optimizer.NewAdamAny(0.01),
+			&InputDim{Channel: 1, Height: 6, Weidth: 6},
+			&ConvParams{FilterNum: 2, FilterSize: 3, Pad: 1, Stride: 1},
+			5, 3, 0.01)
+	}
+	pretrained := newNet()
+	x, _ := num.NewRandnT4D(4, 1, 6, 6)
+	pretrained.UpdateParams(pretrained.Gradient(x, oneHot([]int{0, 2, 1, 0}, 3)))
+	buf := &bytes.Buffer{}
+	pretrained.Save(buf)
+
+	net := newNet()
+	if err := net.Load(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	net.ReplaceHead(4, initializer.NewHeNormal())
+	if err := net.FreezeLayers("Conv1", "Relu1", "Affine1"); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	w3, b3 := net.Params["W3"].(*num.Matrix), net.Params["b3"].(*num.Matrix)
+	for i := 0; i < 3; i++ {
+		net.UpdateParams(net.Gradient(x, oneHot([]int{3, 3, 1, 0}, 4)))
+	}
+	for _, k := range []string{"W1", "b1", "W2", "b2"} {
+		if !equalParam(net.Params[k], pretrained.Params[k]) {
+			fmt.Println(k, "was updated")
+			t.Fail()
+		}
+	}
+	// 隠れ層のReLUが全て0だと重みの勾配は0になるので、バイアスで確かめる（ラベルは偏らせてある）
+	if y := net.Predict(x).(*num.Matrix); y.Columns != 4 || net.Params["W3"].(*num.Matrix).Rows != w3.Rows ||
+		num.Equal(net.Params["b3"].(*num.Matrix), b3) {
+		fmt.Println(y.Columns)
+		t.Fail()
+	}
+
+	net.UnfreezeLayers("Conv1")
+	net.UpdateParams(net.Gradient(x, oneHot([]int{3, 3, 1, 0}, 4)))
+	if equalParam(net.Params["W1"], pretrained.Params["W1"]) || !equalParam(net.Params["W2"], pretrained.Params["W2"]) {
+		t.Fail()
+	}
+	if err := net.FreezeLayers("Conv2"); err == nil || !strings.Contains(err.Error(), `"Conv2"`) {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestSequentialTrainable(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewAdam(0.01))
+	x, _ := num.NewRandnMatrix(4, 4)
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 2, 1}, 3)))
+
+	net.FreezeLayers("Affine1", "Tanh1")
+	net.SetTrainable(false, "b2")
+	before := map[string]*num.Matrix{}
+	for k, v := range net.Params {
+		before[k] = v
+	}
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 2, 1}, 3)))
+	for k, frozen := range map[string]bool{"W1": true, "b1": true, "W2": false, "b2": true} {
+		if num.Equal(net.Params[k], before[k]) != frozen || net.IsTrainable(k) == frozen {
+			fmt.Println(k, frozen)
+			t.Fail()
+		}
+	}
+
+	if err := net.ReplaceHead(2, initializer.NewXavierNormal()); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 1, 0}, 2)))
+	if !net.IsTrainable("b2") || net.Predict(x, false).Columns != 2 || net.Config.Layers[4].Units != 2 || cfg.Layers[4].Units != 3 {
+		fmt.Println(net.Config.Layers[4], cfg.Layers[4])
+		t.Fail()
+	}
+	// 出力層を変えたモデルも設定から作り直せる
+	buf := &bytes.Buffer{}
+	net.Save(buf)
+	loaded, err := LoadSequential(buf, optimizer.NewAdam(0.01))
+	if err != nil || !num.Equal(loaded.Predict(x, false), net.Predict(x, false)) {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestFrozenSummary(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewSGD(0.1))
+	net.FreezeLayers("Affine1")
+	net.SetTrainable(false, "b2")
+	s, err := net.Summary([]int{8, 4})
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	// 凍結したパラメタは、BatchNormalizationの統計量と同じく学習しないパラメタに数える
+	if s.TrainableParams != 5*3 || s.NonTrainableParams != 4*5+5+3+2*5 ||
+		s.Layers[0].TrainableParams != 0 || s.Layers[0].NonTrainableParams != 4*5+5 {
+		fmt.Println(s)
+		t.Fail()
+	}
+
+	two := NewTwoLayerNet(optimizer.NewSGD(0.1), 3, 4, 2, 0)
+	two.FreezeLayers("Affine2")
+	if s, _ := two.Summary([]int{1, 3}); s.TrainableParams != 3*4+4 || s.NonTrainableParams != 4*2+2+2*4 {
+		fmt.Println(s)
+		t.Fail()
+	}
+}
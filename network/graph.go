@@ -0,0 +1,200 @@
+package network
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// GraphNode は、Graphの1つの層と、その入力になるノード（またはGraphの入力）の名前
+// Layerはlayer.T4DLayer（入力1つ）かlayer.MultiInputLayer（入力複数）
+type GraphNode struct {
+	Name   string
+	Layer  interface{}
+	Inputs []string
+}
+
+// Graph は、層を有向非巡回グラフにつないだモデル
+// 順伝搬はトポロジカル順、逆伝搬はその逆順に行う
+// 1つのノードの出力を複数のノードで使った場合、勾配は足し合わせる
+type Graph struct {
+	Inputs []string // Graphの入力の名前
+	Output string   // 出力にするノードの名前
+	Nodes  map[string]*GraphNode
+	// ノードを追加した順（トポロジカル順が一意に決まらないときの順番）
+	names []string
+	order []string
+}
+
+func NewGraph(inputs []string, output string) *Graph {
+	return &Graph{
+		Inputs: inputs,
+		Output: output,
+		Nodes:  map[string]*GraphNode{},
+	}
+}
+
+// AddNode は、inputsを入力とするノードを追加する
+func (g *Graph) AddNode(name string, l interface{}, inputs ...string) *Graph {
+	if _, ok := g.Nodes[name]; ok || g.isInput(name) {
+		panic(fmt.Sprintf("node %q already exists", name))
+	}
+	switch l.(type) {
+	case layer.T4DLayer:
+		if len(inputs) != 1 {
+			panic(fmt.Sprintf("node %q takes 1 input, got %d", name, len(inputs)))
+		}
+	case layer.MultiInputLayer:
+	default:
+		panic(fmt.Sprintf("node %q has unsupported layer %T", name, l))
+	}
+	// 同じ層を2つのノードで使うと、Forwardの中間データ・勾配が上書きされる
+	if v := reflect.ValueOf(l); v.Kind() == reflect.Ptr {
+		for _, other := range g.names {
+			if g.Nodes[other].Layer == l {
+				panic(fmt.Sprintf("node %q uses the same layer as node %q", name, other))
+			}
+		}
+	}
+	g.Nodes[name] = &GraphNode{
+		Name:   name,
+		Layer:  l,
+		Inputs: inputs,
+	}
+	g.names = append(g.names, name)
+	g.order = nil
+	return g
+}
+
+func (g *Graph) isInput(name string) bool {
+	for _, in := range g.Inputs {
+		if in == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Order は、ノードのトポロジカル順
+func (g *Graph) Order() []string {
+	if g.order != nil {
+		return g.order
+	}
+	if _, ok := g.Nodes[g.Output]; !ok && !g.isInput(g.Output) {
+		panic(fmt.Sprintf("output %q is not a node", g.Output))
+	}
+	// Kahnのアルゴリズム
+	indegree := map[string]int{}
+	users := map[string][]string{}
+	for _, name := range g.names {
+		for _, in := range g.Nodes[name].Inputs {
+			if _, ok := g.Nodes[in]; !ok && !g.isInput(in) {
+				panic(fmt.Sprintf("node %q has unknown input %q", name, in))
+			}
+			if _, ok := g.Nodes[in]; ok {
+				indegree[name]++
+				users[in] = append(users[in], name)
+			}
+		}
+	}
+	queue := []string{}
+	for _, name := range g.names {
+		if indegree[name] == 0 {
+			queue = append(queue, name)
+		}
+	}
+	order := make([]string, 0, len(g.names))
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		order = append(order, name)
+		for _, user := range users[name] {
+			indegree[user]--
+			if indegree[user] == 0 {
+				queue = append(queue, user)
+			}
+		}
+	}
+	if len(order) != len(g.names) {
+		panic("graph has a cycle")
+	}
+	g.order = order
+	return order
+}
+
+// Forward は、入力が1つならxをそのまま、複数ならInputsの順の[]interface{}で受け取る
+func (g *Graph) Forward(x interface{}) interface{} {
+	values := map[string]interface{}{}
+	if len(g.Inputs) == 1 {
+		values[g.Inputs[0]] = x
+	} else {
+		for i, in := range x.([]interface{}) {
+			values[g.Inputs[i]] = in
+		}
+	}
+	for _, name := range g.Order() {
+		node := g.Nodes[name]
+		switch l := node.Layer.(type) {
+		case layer.T4DLayer:
+			values[name] = l.Forward(values[node.Inputs[0]])
+		case layer.MultiInputLayer:
+			xs := make([]interface{}, len(node.Inputs))
+			for i, in := range node.Inputs {
+				xs[i] = values[in]
+			}
+			values[name] = l.Forward(xs)
+		}
+	}
+	return values[g.Output]
+}
+
+// Backward は、入力が1つならその勾配を、複数ならInputsの順の[]interface{}を返す
+func (g *Graph) Backward(dout interface{}) interface{} {
+	grads := map[string]interface{}{g.Output: dout}
+	accumulate := func(name string, grad interface{}) {
+		if prev, ok := grads[name]; ok {
+			grad = layer.NewElementwiseAdd().Forward([]interface{}{prev, grad})
+		}
+		grads[name] = grad
+	}
+	order := g.Order()
+	for i := len(order) - 1; i >= 0; i-- {
+		node := g.Nodes[order[i]]
+		grad, ok := grads[node.Name]
+		if !ok {
+			// 出力に使われていないノード
+			continue
+		}
+		switch l := node.Layer.(type) {
+		case layer.T4DLayer:
+			accumulate(node.Inputs[0], l.Backward(grad))
+		case layer.MultiInputLayer:
+			for j, dx := range l.Backward(grad) {
+				accumulate(node.Inputs[j], dx)
+			}
+		}
+	}
+	if len(g.Inputs) == 1 {
+		return grads[g.Inputs[0]]
+	}
+	dxs := make([]interface{}, len(g.Inputs))
+	for i, in := range g.Inputs {
+		dxs[i] = grads[in]
+	}
+	return dxs
+}
+
+// NewResidualBlock は、ResNetの残差ブロック ReLU(x + Conv(ReLU(Conv(x))))
+// 畳み込みは"same"パディングなので、w2の出力チャンネル数は入力と同じにする
+// https://arxiv.org/abs/1512.03385
+func NewResidualBlock(w1 num.Tensor4D, b1 *num.Matrix, w2 num.Tensor4D, b2 *num.Matrix) *Graph {
+	same := &layer.Conv2DParams{SamePadding: true}
+	return NewGraph([]string{"x"}, "Relu2").
+		AddNode("Conv1", layer.NewConv2D(w1, b1, same), "x").
+		AddNode("Relu1", layer.NewReluT4D(), "Conv1").
+		AddNode("Conv2", layer.NewConv2D(w2, b2, same), "Relu1").
+		AddNode("Add", layer.NewElementwiseAdd(), "Conv2", "x").
+		AddNode("Relu2", layer.NewReluT4D(), "Add")
+}
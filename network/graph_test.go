@@ -0,0 +1,161 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func closeEnough(x1, x2 vec.Vector) bool {
+	if len(x1) != len(x2) {
+		return false
+	}
+	for i := range x1 {
+		if math.Abs(x1[i]-x2[i]) > 1e-4*math.Max(1.0, math.Abs(x2[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// weightedSum は、出力とwの内積（勾配の確認に使う損失）
+func weightedSum(out interface{}, w vec.Vector) float64 {
+	switch o := out.(type) {
+	case *num.Matrix:
+		return vec.Sum(vec.Mul(o.Vector, w))
+	case num.Tensor4D:
+		return vec.Sum(vec.Mul(o.Flatten(), w))
+	}
+	panic(out)
+}
+
+// nearKink は、nodesの出力に0に近い値があるか
+func nearKink(g *Graph, x interface{}, nodes ...string) bool {
+	output := g.Output
+	defer func() { g.Output = output }()
+	for _, name := range nodes {
+		g.Output = name
+		for _, v := range g.Forward(x).(num.Tensor4D).Flatten() {
+			if math.Abs(v) < 1e-3 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestResidualBlockGradient(t *testing.T) {
+	w1, _ := num.NewRandnT4D(3, 2, 3, 3)
+	w2, _ := num.NewRandnT4D(2, 3, 3, 3)
+	b1, _ := num.NewRandnMatrix(1, 3)
+	b2, _ := num.NewRandnMatrix(1, 2)
+	block := NewResidualBlock(w1, b1, w2, b2)
+
+	// ReLUの入力が0に近いと数値微分がずれるので、そうならない入力を選ぶ
+	x, _ := num.NewRandnT4D(2, 2, 4, 4)
+	for nearKink(block, x, "Conv1", "Add") {
+		x, _ = num.NewRandnT4D(2, 2, 4, 4)
+	}
+	out := block.Forward(x).(num.Tensor4D)
+	if len(out) != 2 || len(out[0]) != 2 || out[0][0].Rows != 4 || out[0][0].Columns != 4 {
+		fmt.Println(out)
+		t.Fail()
+	}
+	w := vec.Randn(len(out.Flatten()))
+	wT4D := (&num.Matrix{Vector: w, Rows: 1, Columns: len(w)}).ReshapeTo4D(2, 2, 4, 4)
+	dx := block.Backward(wT4D).(num.Tensor4D)
+
+	loss := func() float64 { return weightedSum(block.Forward(x), w) }
+	for n := range x {
+		for c := range x[n] {
+			numerical := vec.NumericalGradient(func(vec.Vector) float64 { return loss() }, x[n][c].Vector)
+			if !closeEnough(dx[n][c].Vector, numerical) {
+				fmt.Println(dx[n][c], numerical)
+				t.Fail()
+			}
+		}
+	}
+	block.Forward(x)
+	block.Backward(wT4D)
+	conv1 := block.Nodes["Conv1"].Layer.(*layer.Conv2D)
+	numerical := vec.NumericalGradient(func(vec.Vector) float64 { return loss() }, conv1.B.Vector)
+	if !closeEnough(conv1.DB.Vector, numerical) {
+		fmt.Println(conv1.DB, numerical)
+		t.Fail()
+	}
+}
+
+// 分岐して合流するグラフ（ノードの追加順はトポロジカル順でなくてもよい）
+//
+//	a ─ Affine1 ─┬─ Tanh ───────┐
+//	             └──────────── Concat ─ Affine2
+//	b ─────────────────────────┘
+func TestGraphMultiInput(t *testing.T) {
+	w1, _ := num.NewRandnMatrix(3, 2)
+	w2, _ := num.NewRandnMatrix(5, 2)
+	g := NewGraph([]string{"a", "b"}, "Affine2").
+		AddNode("Affine2", layer.NewAffineT4D(w2, num.Zeros(1, 2)), "Concat").
+		AddNode("Concat", layer.NewConcatenate(), "Tanh", "Affine1", "b").
+		AddNode("Tanh", layer.NewTanh(), "Affine1").
+		AddNode("Affine1", layer.NewAffineT4D(w1, num.Zeros(1, 2)), "a")
+	if fmt.Sprint(g.Order()) != "[Affine1 Tanh Concat Affine2]" {
+		fmt.Println(g.Order())
+		t.Fail()
+	}
+
+	a, _ := num.NewRandnMatrix(4, 3)
+	b, _ := num.NewRandnMatrix(4, 1)
+	out := g.Forward([]interface{}{a, b}).(*num.Matrix)
+	w := vec.Randn(len(out.Vector))
+	dxs := g.Backward(&num.Matrix{Vector: w, Rows: out.Rows, Columns: out.Columns}).([]interface{})
+
+	loss := func(vec.Vector) float64 { return weightedSum(g.Forward([]interface{}{a, b}), w) }
+	for i, x := range []*num.Matrix{a, b} {
+		numerical := vec.NumericalGradient(loss, x.Vector)
+		if !closeEnough(dxs[i].(*num.Matrix).Vector, numerical) {
+			fmt.Println(i, dxs[i], numerical)
+			t.Fail()
+		}
+	}
+}
+
+func TestGraphCycle(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	NewGraph([]string{"x"}, "B").
+		AddNode("A", layer.NewTanh(), "B").
+		AddNode("B", layer.NewTanh(), "A").
+		Order()
+}
+
+func TestGraphInvalid(t *testing.T) {
+	tanh := layer.NewTanh()
+	cases := map[string]func(){
+		// 出力のノードがない
+		`output "C" is not a node`: func() {
+			NewGraph([]string{"x"}, "C").AddNode("A", layer.NewTanh(), "x").Order()
+		},
+		// 同じ層のインスタンスを2つのノードで使う
+		`node "B" uses the same layer as node "A"`: func() {
+			NewGraph([]string{"x"}, "B").AddNode("A", tanh, "x").AddNode("B", tanh, "A")
+		},
+	}
+	for expected, f := range cases {
+		func() {
+			defer func() {
+				if r := recover(); r != expected {
+					fmt.Println(r)
+					t.Fail()
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,48 @@
+package network
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// checkInits は、初期化方法が省略・1つ（全層共通）・層ごとのどれかであることを確かめる
+func checkInits(inits []initializer.Initializer, layers int) {
+	if len(inits) > 1 && len(inits) != layers {
+		panic(fmt.Sprintf("%d initializers for %d layers: give one or one per layer", len(inits), layers))
+	}
+}
+
+// layerInit は、i番目の層の初期化方法（省略した場合はdef）
+func layerInit(inits []initializer.Initializer, i int, def initializer.Initializer) initializer.Initializer {
+	switch len(inits) {
+	case 0:
+		return def
+	case 1:
+		return inits[0]
+	}
+	return inits[i]
+}
+
+// newWeight は、i番目の層の(rows, cols)の重みを作る
+// initsが1つなら全層で使い、省略した場合は標準正規分布をsqrt(2*rows)で割る
+func newWeight(inits []initializer.Initializer, i, rows, cols int) *num.Matrix {
+	if len(inits) > 0 {
+		return initializer.Matrix(layerInit(inits, i, nil), rows, cols)
+	}
+	w, err := num.NewRandnMatrix(rows, cols)
+	if err != nil {
+		panic(err)
+	}
+	return num.Div(w, math.Sqrt(2.0*float64(rows)))
+}
+
+// checkWeightDecay は、ネットワークとオプティマイザの両方で重み減衰をすると二重にかかるのでエラーにする
+func checkWeightDecay(opt interface{}, weightDecayLambda float64) error {
+	if o, ok := opt.(interface{ HasWeightDecay() bool }); ok && weightDecayLambda != 0 && o.HasWeightDecay() {
+		return fmt.Errorf("weight decay is set on both the network (lambda=%v) and the optimizer", weightDecayLambda)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestNetworkInitializer(t *testing.T) {
+	net := NewTwoLayerNet(optimizer.NewSGD(0.1), 4, 3, 2, 0, initializer.NewConstant(0.5))
+	for _, k := range []string{"W1", "W2"} {
+		for _, v := range net.Params[k].Vector {
+			if v != 0.5 {
+				fmt.Println(k, net.Params[k])
+				t.FailNow()
+			}
+		}
+	}
+	if net.Layers["Affine1"].(*layer.Affine).W != net.Params["W1"] {
+		t.Fail()
+	}
+
+	// 畳み込みのfan_inはC*FH*FW
+	initializer.Seed(1)
+	conv := NewSimpleConvNet(optimizer.NewAdamAny(0.01),
+		&InputDim{Channel: 8, Height: 6, Weidth: 6},
+		&ConvParams{FilterNum: 64, FilterSize: 3, Pad: 1, Stride: 1},
+		5, 3, 0.01, initializer.NewHeNormal())
+	w := conv.Params["W1"].(num.Tensor4D).Flatten()
+	expected := math.Sqrt(2.0 / (8 * 3 * 3))
+	if actual := math.Sqrt(vec.Sum(vec.Mul(w, w)) / float64(len(w))); math.Abs(actual-expected) > 0.05*expected {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+	if conv.T4DLayers["Conv1"].(*layer.Convolution).W[0][0] != conv.Params["W1"].(num.Tensor4D)[0][0] {
+		t.Fail()
+	}
+
+	// 層ごとに別の初期化方法を使える
+	net = NewTwoLayerNet(optimizer.NewSGD(0.1), 4, 3, 2, 0, initializer.NewConstant(0.5), initializer.NewConstant(2))
+	if net.Params["W1"].Vector[0] != 0.5 || net.Params["W2"].Vector[0] != 2 {
+		fmt.Println(net.Params["W1"], net.Params["W2"])
+		t.Fail()
+	}
+}
+
+func TestNetworkInitializerCount(t *testing.T) {
+	// 1つでも層の数でもない
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fail()
+		}
+	}()
+	NewThreeLayerNet(optimizer.NewSGD(0.1), 4, 3, 2, 0, initializer.NewConstant(0.5), initializer.NewConstant(2))
+}
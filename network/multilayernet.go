@@ -2,8 +2,8 @@ package network
 
 import (
 	"fmt"
-	"math"
 
+	"github.com/naronA/zero_deeplearning/initializer"
 	"github.com/naronA/zero_deeplearning/layer"
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/optimizer"
@@ -13,8 +13,9 @@ type MultiLayerNet struct {
 	Params            map[string]*num.Matrix
 	Layers            map[string]layer.Layer
 	Sequence          []string
-	LastLayer         *layer.SoftmaxWithLoss
+	LastLayer         layer.LossLayer
 	Optimizer         optimizer.Optimizer
+	Trainable         // 凍結したパラメタはUpdateParamsで更新しない
 	HiddenLayerNum    int
 	WeightDecayLambda float64
 }
@@ -25,32 +26,25 @@ func NewMultiLayer(
 	inputSize int,
 	hiddenSize int,
 	outputSize int,
-	weightDeceyLambda float64) *MultiLayerNet {
+	weightDeceyLambda float64,
+	inits ...initializer.Initializer) *MultiLayerNet {
+	if err := checkWeightDecay(opt, weightDeceyLambda); err != nil {
+		panic(err)
+	}
+	checkInits(inits, 3)
 	params := map[string]*num.Matrix{}
 	layers := map[string]layer.Layer{}
 
-	W1, err := num.NewRandnMatrix(inputSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W2, err := num.NewRandnMatrix(hiddenSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W3, err := num.NewRandnMatrix(hiddenSize, outputSize)
-	if err != nil {
-		panic(err)
-	}
 	// W4, err := num.NewRandnMatrix(hiddenSize, outputSize)
 	// if err != nil {
 	// 	panic(err)
 	// }
 
-	params["W1"] = num.Div(W1, math.Sqrt(2.0*float64(inputSize))) // weightInitStd
+	params["W1"] = newWeight(inits, 0, inputSize, hiddenSize)
 	params["b1"] = num.Zeros(1, hiddenSize)
-	params["W2"] = num.Div(W2, math.Sqrt(2.0*float64(hiddenSize)))
+	params["W2"] = newWeight(inits, 1, hiddenSize, hiddenSize)
 	params["b2"] = num.Zeros(1, hiddenSize)
-	params["W3"] = num.Div(W3, math.Sqrt(2.0*float64(hiddenSize)))
+	params["W3"] = newWeight(inits, 2, hiddenSize, outputSize)
 	params["b3"] = num.Zeros(1, outputSize)
 	// params["W4"] = num.Div(W4, num.Sqrt(2.0*float64(hiddenSize)))
 	// params["b4"] = num.Zeros(1, outputSize)
@@ -167,7 +161,7 @@ func (net *MultiLayerNet) Gradient(x, t *num.Matrix) map[string]*num.Matrix {
 }
 
 func (net *MultiLayerNet) UpdateParams(grads map[string]*num.Matrix) {
-	net.Params = net.Optimizer.Update(net.Params, grads)
+	net.Params = net.update(net.Optimizer, net.Params, grads)
 
 	for i := 1; i < net.HiddenLayerNum+2; i++ {
 		l := fmt.Sprintf("Affine%d", i)
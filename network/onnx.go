@@ -0,0 +1,729 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/onnx"
+)
+
+// ExportONNX は、推論用のモデルをONNX形式で書く
+// 入力は"input"（形は(N, 入力の大きさ)）、出力は"output"
+// SoftmaxWithLossで学習したモデルは、最後にSoftmaxを加えて確率を出力する
+func (net *Sequential) ExportONNX(w io.Writer) error {
+	nodes := make([]*GraphNode, len(net.Sequence))
+	prev := "input"
+	for i, name := range net.Sequence {
+		var l interface{} = net.Layers[name]
+		if m, ok := l.(*matrixLayer); ok {
+			l = m.T4DLayer
+		}
+		nodes[i] = &GraphNode{Name: name, Layer: l, Inputs: []string{prev}}
+		prev = name
+	}
+	inputs := []*onnx.ValueInfo{{Name: "input", ElemType: onnx.FLOAT}}
+	if size := net.inputSize(); size > 0 {
+		inputs[0].Dims = []onnx.Dim{{Param: "N"}, {Value: int64(size)}}
+	}
+	_, softmax := net.LastLayer.(*layer.SoftmaxWithLoss)
+	return exportONNX(w, "Sequential", nodes, inputs, prev, softmax)
+}
+
+// inputSize は、入力の大きさ（分からなければ0）
+func (net *Sequential) inputSize() int {
+	if net.Config != nil {
+		return net.Config.InputSize
+	}
+	// Embeddingは入力の大きさを重みから決められない
+	if len(net.weighted) > 0 && len(net.embeddings) == 0 {
+		w, _ := weightsOf(net.Layers[net.weighted[0]])
+		return w.Rows
+	}
+	return 0
+}
+
+// ExportONNX は、推論用のモデルをONNX形式で書く
+// inputShapesはInputsの順の入力の形で、最初の軸はバッチサイズ"N"にする（省略時は形を書かない）
+func (g *Graph) ExportONNX(w io.Writer, inputShapes ...[]int) error {
+	if len(inputShapes) != 0 && len(inputShapes) != len(g.Inputs) {
+		return fmt.Errorf("graph has %d inputs, got %d shapes", len(g.Inputs), len(inputShapes))
+	}
+	nodes := make([]*GraphNode, len(g.Order()))
+	for i, name := range g.Order() {
+		nodes[i] = g.Nodes[name]
+	}
+	inputs := make([]*onnx.ValueInfo, len(g.Inputs))
+	for i, name := range g.Inputs {
+		inputs[i] = &onnx.ValueInfo{Name: name, ElemType: onnx.FLOAT}
+		if len(inputShapes) != 0 {
+			inputs[i].Dims = []onnx.Dim{{Param: "N"}}
+			for _, d := range inputShapes[i][1:] {
+				inputs[i].Dims = append(inputs[i].Dims, onnx.Dim{Value: int64(d)})
+			}
+		}
+	}
+	return exportONNX(w, "Graph", nodes, inputs, g.Output, false)
+}
+
+// exportONNX は、ノードの出力をノードの名前の値にしてONNXのグラフにする
+func exportONNX(w io.Writer, name string, nodes []*GraphNode, inputs []*onnx.ValueInfo, output string, softmax bool) error {
+	g := &onnx.Graph{Name: name, Inputs: inputs}
+	unsupported := []string{}
+	for _, n := range nodes {
+		if err := onnxNode(g, n); err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s (%v)", n.Name, err))
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("cannot export to ONNX: %s", strings.Join(unsupported, ", "))
+	}
+	last := &onnx.Node{Name: "Output", OpType: "Identity", Inputs: []string{output}, Outputs: []string{"output"}}
+	if softmax {
+		last = &onnx.Node{Name: "Softmax", OpType: "Softmax", Inputs: []string{output}, Outputs: []string{"output"},
+			Attributes: []*onnx.Attribute{onnx.IntAttr("axis", 1)}}
+	}
+	g.Nodes = append(g.Nodes, last)
+	g.Outputs = []*onnx.ValueInfo{{Name: "output", ElemType: onnx.FLOAT}}
+	return onnx.Write(w, &onnx.Model{
+		IRVersion:    onnx.IRVersion,
+		OpsetImports: []*onnx.OpsetID{{Version: onnx.OpsetVersion}},
+		ProducerName: "zero_deeplearning",
+		Graph:        g,
+	})
+}
+
+// onnxNode は、層をONNXのノードと重み（initializer）にする
+func onnxNode(g *onnx.Graph, n *GraphNode) error {
+	node := &onnx.Node{Name: n.Name, Inputs: n.Inputs, Outputs: []string{n.Name}}
+	// param は、重みをinitializerに加えてノードの入力にする
+	param := func(field string, dims []int, data []float64) {
+		t := &onnx.Tensor{Name: n.Name + "." + field, DataType: onnx.FLOAT, Data: data}
+		for _, d := range dims {
+			t.Dims = append(t.Dims, int64(d))
+		}
+		g.Initializers = append(g.Initializers, t)
+		node.Inputs = append(node.Inputs, t.Name)
+	}
+	gemm := func(w, b *num.Matrix) {
+		node.OpType = "Gemm"
+		param("W", []int{w.Rows, w.Columns}, w.Vector)
+		param("B", []int{b.Columns}, b.Vector)
+	}
+	conv := func(w num.Tensor4D, b *num.Matrix) {
+		node.OpType = "Conv"
+		fn, c, fh, fw := len(w), len(w[0]), w[0][0].Rows, w[0][0].Columns
+		param("W", []int{fn, c, fh, fw}, w.Flatten())
+		param("B", []int{fn}, b.Vector)
+		node.Attributes = append(node.Attributes, onnx.IntsAttr("kernel_shape", int64(fh), int64(fw)))
+	}
+	pool := func(op string, ph, pw, stride, pad int, mode num.PadMode, value float64) error {
+		if err := zeroPadding(mode, value); err != nil {
+			return err
+		}
+		node.OpType = op
+		p := int64(pad)
+		node.Attributes = []*onnx.Attribute{
+			onnx.IntsAttr("kernel_shape", int64(ph), int64(pw)),
+			onnx.IntsAttr("strides", int64(stride), int64(stride)),
+			onnx.IntsAttr("pads", p, p, p, p),
+		}
+		return nil
+	}
+
+	switch l := n.Layer.(type) {
+	case *layer.Affine:
+		gemm(l.W, l.B)
+	case *layer.DropConnect:
+		gemm(l.W, l.B)
+	case *layer.AffineT4D:
+		// (N, C, H, W)は(N, C*H*W)にしてからかける
+		flatten := n.Name + ".Flatten"
+		g.Nodes = append(g.Nodes, &onnx.Node{Name: flatten, OpType: "Flatten", Inputs: n.Inputs, Outputs: []string{flatten},
+			Attributes: []*onnx.Attribute{onnx.IntAttr("axis", 1)}})
+		node.Inputs = []string{flatten}
+		gemm(l.W, l.B)
+	case *layer.ReLU, *layer.ReLUT4D:
+		node.OpType = "Relu"
+	case *layer.Sigmoid:
+		node.OpType = "Sigmoid"
+	case *layer.Tanh:
+		node.OpType = "Tanh"
+	case *layer.LeakyReLU:
+		node.OpType = "LeakyRelu"
+		node.Attributes = []*onnx.Attribute{onnx.FloatAttr("alpha", float32(l.Alpha))}
+	case *layer.ELU:
+		node.OpType = "Elu"
+		node.Attributes = []*onnx.Attribute{onnx.FloatAttr("alpha", float32(l.Alpha))}
+	case *layer.Softplus:
+		node.OpType = "Softplus"
+	case *layer.Dropout, *layer.Dropout2D:
+		// 推論時は何もしない
+		node.OpType = "Dropout"
+	case *layer.BatchNormalization:
+		if l.RunningMean == nil {
+			return fmt.Errorf("BatchNormalization has no running statistics")
+		}
+		// この実装は(x-mean)/(sqrt(var)+10e-7)なので、epsilon=0・var=(sqrt(var)+10e-7)^2にする
+		c := l.RunningMean.Columns
+		scale, bias, variance := make([]float64, c), make([]float64, c), make([]float64, c)
+		for i, v := range l.RunningVar.Vector {
+			scale[i], bias[i] = l.Gamma, l.Beta
+			variance[i] = math.Pow(math.Sqrt(v)+10e-7, 2)
+		}
+		node.OpType = "BatchNormalization"
+		param("Scale", []int{c}, scale)
+		param("Bias", []int{c}, bias)
+		param("RunningMean", []int{c}, l.RunningMean.Vector)
+		param("RunningVar", []int{c}, variance)
+		node.Attributes = []*onnx.Attribute{onnx.FloatAttr("epsilon", 0)}
+	case *layer.Convolution:
+		if err := zeroPadding(l.PadMode, l.PadValue); err != nil {
+			return err
+		}
+		conv(l.W, l.B)
+		s, p := int64(l.Stride), int64(l.Pad)
+		node.Attributes = append(node.Attributes, onnx.IntsAttr("strides", s, s), onnx.IntsAttr("pads", p, p, p, p))
+	case *layer.Conv2D:
+		if err := zeroPadding(l.PadMode, l.PadValue); err != nil {
+			return err
+		}
+		conv(l.W, l.B)
+		// ゼロ値のStride, Dilation, Groupsは1
+		one := func(v int) int64 {
+			if v < 1 {
+				return 1
+			}
+			return int64(v)
+		}
+		node.Attributes = append(node.Attributes,
+			onnx.IntsAttr("strides", one(l.StrideH), one(l.StrideW)),
+			onnx.IntsAttr("dilations", one(l.DilationH), one(l.DilationW)),
+			onnx.IntAttr("group", one(l.Groups)))
+		if l.SamePadding {
+			// 余りを後ろ側に多く割り当てる
+			node.Attributes = append(node.Attributes, onnx.StringAttr("auto_pad", "SAME_UPPER"))
+		} else {
+			node.Attributes = append(node.Attributes, onnx.IntsAttr("pads",
+				int64(l.PadTop), int64(l.PadLeft), int64(l.PadBottom), int64(l.PadRight)))
+		}
+	case *layer.Pooling:
+		// ONNXのMaxPoolは-infでパディングするが、この実装は0でパディングするので、負の値で結果が変わる
+		if l.Pad > 0 {
+			return fmt.Errorf("MaxPool with pad=%d", l.Pad)
+		}
+		if err := pool("MaxPool", l.PoolH, l.PoolW, l.Stride, l.Pad, l.PadMode, l.PadValue); err != nil {
+			return err
+		}
+	case *layer.AveragePooling:
+		if err := pool("AveragePool", l.PoolH, l.PoolW, l.Stride, l.Pad, l.PadMode, l.PadValue); err != nil {
+			return err
+		}
+		// パディングの0も平均に含める
+		node.Attributes = append(node.Attributes, onnx.IntAttr("count_include_pad", 1))
+	case *layer.ElementwiseAdd:
+		node.OpType = "Sum"
+		if len(n.Inputs) == 2 {
+			node.OpType = "Add"
+		}
+	case *layer.Concatenate:
+		node.OpType = "Concat"
+		node.Attributes = []*onnx.Attribute{onnx.IntAttr("axis", 1)}
+	default:
+		return fmt.Errorf("%T", n.Layer)
+	}
+	g.Nodes = append(g.Nodes, node)
+	return nil
+}
+
+// zeroPadding は、ONNXのConv・Poolのパディングは0（MaxPoolは-inf）だけなので、それ以外はエラーにする
+func zeroPadding(mode num.PadMode, value float64) error {
+	if mode != num.CONSTANTPAD || value != 0 {
+		return fmt.Errorf("padding mode %d with value %v", mode, value)
+	}
+	return nil
+}
+
+// ImportONNX は、ONNXのモデルを推論用のGraphにする
+// ノードの名前は、ONNXのノードの出力の名前にする
+// 対応していない演算子は、まとめてエラーにする
+func ImportONNX(r io.Reader) (*Graph, error) {
+	m, err := onnx.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Graph.Outputs) != 1 {
+		return nil, fmt.Errorf("model has %d outputs, want 1", len(m.Graph.Outputs))
+	}
+	inits := map[string]*onnx.Tensor{}
+	for _, t := range m.Graph.Initializers {
+		inits[t.Name] = t
+	}
+	// 古いモデルはinitializerも入力に並べる
+	inputs := []string{}
+	for _, in := range m.Graph.Inputs {
+		if _, ok := inits[in.Name]; !ok {
+			inputs = append(inputs, in.Name)
+		}
+	}
+	g := NewGraph(inputs, m.Graph.Outputs[0].Name)
+	unsupported := []string{}
+	for _, n := range m.Graph.Nodes {
+		if n.Domain != "" && n.Domain != "ai.onnx" {
+			unsupported = append(unsupported, fmt.Sprintf("%s.%s (%s)", n.Domain, n.OpType, n.Name))
+			continue
+		}
+		l, ins, err := importNode(n, inits, m.Opset(""))
+		if err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s (%s: %v)", n.OpType, n.Name, err))
+			continue
+		}
+		g.AddNode(n.Outputs[0], l, ins...)
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("cannot import ONNX model: %s", strings.Join(unsupported, ", "))
+	}
+	return g, nil
+}
+
+// onnxLayer は、ノードに対応する層と、initializer以外の入力
+// importNode は、onnxLayerで層を作る
+// 壊れたノードで層のコンストラクタがpanicしても、対応していないノードとしてエラーにする
+func importNode(n *onnx.Node, inits map[string]*onnx.Tensor, opset int64) (l interface{}, ins []string, err error) {
+	if len(n.Inputs) == 0 || len(n.Outputs) == 0 {
+		return nil, nil, fmt.Errorf("%d inputs and %d outputs", len(n.Inputs), len(n.Outputs))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			l, ins, err = nil, nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return onnxLayer(n, inits, opset)
+}
+
+func onnxLayer(n *onnx.Node, inits map[string]*onnx.Tensor, opset int64) (interface{}, []string, error) {
+	ints := func(name string, def ...int64) []int64 {
+		if a := n.Attr(name); a != nil {
+			return a.Ints
+		}
+		return def
+	}
+	integer := func(name string, def int64) int64 {
+		if a := n.Attr(name); a != nil {
+			return a.I
+		}
+		return def
+	}
+	float := func(name string, def float64) float64 {
+		if a := n.Attr(name); a != nil {
+			return float64(a.F)
+		}
+		return def
+	}
+	// pair は、2つの値の属性（strides・dilationsなど）
+	pair := func(name string, def int64) ([]int64, error) {
+		v := ints(name, def, def)
+		if len(v) != 2 {
+			return nil, fmt.Errorf("%s=%v", name, v)
+		}
+		return v, nil
+	}
+	// param は、i番目の入力のinitializer（省略されていればnil）
+	param := func(i int) (*onnx.Tensor, error) {
+		if i >= len(n.Inputs) || n.Inputs[i] == "" {
+			return nil, nil
+		}
+		t, ok := inits[n.Inputs[i]]
+		if !ok {
+			return nil, fmt.Errorf("input %q is not an initializer", n.Inputs[i])
+		}
+		return t, checkONNXTensor(t)
+	}
+	// required は、省略できないinitializer
+	required := func(i int, name string) (*onnx.Tensor, error) {
+		t, err := param(i)
+		if err == nil && t == nil {
+			err = fmt.Errorf("no %s", name)
+		}
+		return t, err
+	}
+	data := n.Inputs[:1]
+
+	switch n.OpType {
+	case "Gemm", "MatMul":
+		if integer("transA", 0) != 0 {
+			return nil, nil, errors.New("transA=1")
+		}
+		wt, err := required(1, "weight")
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(wt.Dims) != 2 {
+			return nil, nil, fmt.Errorf("weight has shape %v", wt.Dims)
+		}
+		w := onnxMatrix(wt).(*num.Matrix)
+		if integer("transB", 0) != 0 {
+			w = w.T()
+		}
+		w = num.Mul(w, float("alpha", 1))
+		b := num.Zeros(1, w.Columns)
+		ct, err := param(2)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ct != nil {
+			// (N)・(1, N)・スカラーだけ（バッチごとのCは使えない）
+			if len(ct.Data) != 1 && len(ct.Data) != w.Columns {
+				return nil, nil, fmt.Errorf("C has shape %v", ct.Dims)
+			}
+			beta := float("beta", 1)
+			for i := range b.Vector {
+				b.Vector[i] = beta * ct.Data[i%len(ct.Data)]
+			}
+		}
+		return layer.NewAffineT4D(w, b), data, nil
+	case "Add":
+		if len(n.Inputs) != 2 {
+			return nil, nil, fmt.Errorf("%d inputs", len(n.Inputs))
+		}
+		for i := range n.Inputs {
+			if _, ok := inits[n.Inputs[i]]; ok {
+				t, err := param(i)
+				if err != nil {
+					return nil, nil, err
+				}
+				b, err := onnxAddBias(t)
+				if err != nil {
+					return nil, nil, err
+				}
+				return b, n.Inputs[1-i : 2-i], nil
+			}
+		}
+		return layer.NewElementwiseAdd(), n.Inputs, nil
+	case "Sum":
+		return layer.NewElementwiseAdd(), n.Inputs, nil
+	case "Conv":
+		wt, err := required(1, "weight")
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(wt.Dims) != 4 {
+			return nil, nil, fmt.Errorf("%d-D convolution", len(wt.Dims)-2)
+		}
+		w := onnxMatrix(wt).(num.Tensor4D)
+		b := num.Zeros(1, len(w))
+		if bt, err := param(2); err != nil {
+			return nil, nil, err
+		} else if bt != nil {
+			if len(bt.Data) != len(w) {
+				return nil, nil, fmt.Errorf("bias has shape %v for %d filters", bt.Dims, len(w))
+			}
+			b.Vector = append(b.Vector[:0], bt.Data...)
+		}
+		strides, err := pair("strides", 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		dilations, err := pair("dilations", 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if group := integer("group", 1); group < 1 || int64(len(w))%group != 0 {
+			return nil, nil, fmt.Errorf("group=%d for %d filters", group, len(w))
+		}
+		p := &layer.Conv2DParams{
+			StrideH: int(strides[0]), StrideW: int(strides[1]),
+			DilationH: int(dilations[0]), DilationW: int(dilations[1]),
+			Groups: int(integer("group", 1)),
+		}
+		switch pad := n.Attr("auto_pad"); {
+		case pad == nil || pad.S == "NOTSET":
+			pads := ints("pads", 0, 0, 0, 0)
+			if len(pads) != 4 {
+				return nil, nil, fmt.Errorf("pads=%v", pads)
+			}
+			p.PadTop, p.PadLeft, p.PadBottom, p.PadRight = int(pads[0]), int(pads[1]), int(pads[2]), int(pads[3])
+		case pad.S == "SAME_UPPER":
+			p.SamePadding = true
+		case pad.S != "VALID":
+			return nil, nil, fmt.Errorf("auto_pad=%s", pad.S)
+		}
+		return layer.NewConv2D(w, b, p), data, nil
+	case "MaxPool", "AveragePool":
+		kernel, strides, pads := ints("kernel_shape"), ints("strides", 1, 1), ints("pads", 0, 0, 0, 0)
+		switch {
+		case len(kernel) != 2:
+			return nil, nil, fmt.Errorf("kernel_shape=%v", kernel)
+		case len(strides) != 2 || strides[0] != strides[1]:
+			return nil, nil, fmt.Errorf("strides=%v", strides)
+		case len(pads) != 4 || pads[0] != pads[1] || pads[0] != pads[2] || pads[0] != pads[3]:
+			return nil, nil, fmt.Errorf("pads=%v", pads)
+		case integer("ceil_mode", 0) != 0:
+			return nil, nil, errors.New("ceil_mode=1")
+		case n.Attr("auto_pad") != nil && n.Attr("auto_pad").S != "NOTSET" && n.Attr("auto_pad").S != "VALID":
+			return nil, nil, fmt.Errorf("auto_pad=%s", n.Attr("auto_pad").S)
+		}
+		for _, d := range ints("dilations") {
+			if d != 1 {
+				return nil, nil, fmt.Errorf("dilations=%v", ints("dilations"))
+			}
+		}
+		ph, pw, stride, pad := int(kernel[0]), int(kernel[1]), int(strides[0]), int(pads[0])
+		if n.OpType == "MaxPool" {
+			// ONNXは-infでパディングするが、この実装は0でパディングする
+			if pad != 0 {
+				return nil, nil, fmt.Errorf("pads=%v", pads)
+			}
+			return layer.NewPooling(ph, pw, stride, pad), data, nil
+		}
+		// この実装はパディングの0も平均に含める
+		if pad != 0 && integer("count_include_pad", 0) == 0 {
+			return nil, nil, errors.New("count_include_pad=0 with padding")
+		}
+		return layer.NewAveragePooling(ph, pw, stride, pad), data, nil
+	case "Relu":
+		return layer.NewReluT4D(), data, nil
+	case "Sigmoid":
+		return &onnxMatrixLayer{layer.NewSigmoid()}, data, nil
+	case "Tanh":
+		return layer.NewTanh(), data, nil
+	case "LeakyRelu":
+		return layer.NewLeakyRelu(float("alpha", 0.01)), data, nil
+	case "Elu":
+		return layer.NewElu(float("alpha", 1)), data, nil
+	case "Softplus":
+		return layer.NewSoftplus(), data, nil
+	case "Flatten":
+		if axis := integer("axis", 1); axis != 1 {
+			return nil, nil, fmt.Errorf("axis=%d", axis)
+		}
+		return &onnxFlatten{}, data, nil
+	case "Reshape":
+		// (N, -1)にするReshapeだけ（PyTorchのx.view(x.size(0), -1)など）
+		st, err := required(1, "shape")
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(st.Data) != 2 || (st.Data[1] != -1 && st.Data[0] != -1 && st.Data[0] != 0) {
+			return nil, nil, fmt.Errorf("shape=%v", st.Data)
+		}
+		return &onnxFlatten{}, data, nil
+	case "Softmax":
+		def := int64(1)
+		if opset >= 13 {
+			def = -1
+		}
+		if axis := integer("axis", def); axis != 1 && axis != -1 {
+			return nil, nil, fmt.Errorf("axis=%d", axis)
+		}
+		return &onnxSoftmax{}, data, nil
+	case "Dropout", "Identity":
+		return &onnxIdentity{}, data, nil
+	case "BatchNormalization":
+		ts := make([]*onnx.Tensor, 4)
+		for i, name := range []string{"scale", "bias", "mean", "var"} {
+			t, err := required(i+1, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(t.Data) == 0 || i > 0 && len(t.Data) != len(ts[0].Data) {
+				return nil, nil, fmt.Errorf("%s has shape %v", name, t.Dims)
+			}
+			ts[i] = t
+		}
+		bn, err := onnxBatchNorm(ts[0].Data, ts[1].Data, ts[2].Data, ts[3].Data, float("epsilon", 1e-5))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &onnxMatrixLayer{bn}, data, nil
+	case "Concat":
+		if axis := integer("axis", 0); axis != 1 {
+			return nil, nil, fmt.Errorf("axis=%d", axis)
+		}
+		return layer.NewConcatenate(), n.Inputs, nil
+	}
+	return nil, nil, errors.New("unsupported operator")
+}
+
+// onnxMatrix は、initializerを*num.Matrix・num.Tensor3D・num.Tensor4Dなどにする（1次元は1行の行列）
+// checkONNXTensor は、initializerの形と値の数が合っているか確かめる
+func checkONNXTensor(t *onnx.Tensor) error {
+	size := 1
+	for _, d := range t.Dims {
+		if d < 0 {
+			return fmt.Errorf("%s has shape %v", t.Name, t.Dims)
+		}
+		size *= int(d)
+	}
+	if len(t.Dims) > 5 || size != len(t.Data) {
+		return fmt.Errorf("%s has shape %v and %d values", t.Name, t.Dims, len(t.Data))
+	}
+	return nil
+}
+
+// onnxAddBias は、Addの定数を行ごと（(D)・(1, D)）かチャンネルごと（(C, 1, 1)・(1, C, 1, 1)）のバイアスにする
+func onnxAddBias(t *onnx.Tensor) (*onnxBias, error) {
+	dims := t.Dims
+	if len(dims) == 4 && dims[0] == 1 {
+		dims = dims[1:]
+	}
+	switch {
+	case len(dims) == 1 || len(dims) == 2 && dims[0] == 1:
+		return &onnxBias{B: &num.Matrix{Vector: t.Data, Rows: 1, Columns: len(t.Data)}}, nil
+	case len(dims) == 3 && dims[1] == 1 && dims[2] == 1:
+		return &onnxBias{B: &num.Matrix{Vector: t.Data, Rows: 1, Columns: len(t.Data)}, PerChannel: true}, nil
+	}
+	return nil, fmt.Errorf("bias has shape %v", t.Dims)
+}
+
+func onnxMatrix(t *onnx.Tensor) interface{} {
+	shape := make([]int, len(t.Dims))
+	for i, d := range t.Dims {
+		shape[i] = int(d)
+	}
+	if len(shape) < 2 {
+		shape = []int{1, len(t.Data)}
+	}
+	return fromTensor(Tensor{Shape: shape, Data: t.Data})
+}
+
+// onnxBatchNorm は、scale*(x-mean)/sqrt(var+epsilon)+biasをこの実装のBatchNormalizationにする
+// Gammaは全チャンネル共通なので、scaleの符号がそろっている場合だけ
+//
+//	Gamma = sign(scale), d = sqrt(var+epsilon)/|scale|
+//	RunningVar = (d-10e-7)^2, RunningMean = mean - Gamma*bias*d
+func onnxBatchNorm(scale, bias, mean, variance []float64, epsilon float64) (*layer.BatchNormalization, error) {
+	c := len(mean)
+	gamma := 1.0
+	if scale[0] < 0 {
+		gamma = -1.0
+	}
+	bn := layer.NewBatchNorimalization(gamma, 0)
+	bn.RunningMean, bn.RunningVar = num.Zeros(1, c), num.Zeros(1, c)
+	for i := 0; i < c; i++ {
+		if scale[i]*gamma <= 0 {
+			return nil, errors.New("scale has mixed signs or zeros")
+		}
+		d := math.Sqrt(variance[i]+epsilon) / math.Abs(scale[i])
+		if d < 10e-7 {
+			return nil, errors.New("variance is too small")
+		}
+		bn.RunningVar.Vector[i] = math.Pow(d-10e-7, 2)
+		bn.RunningMean.Vector[i] = mean[i] - gamma*bias[i]*d
+	}
+	return bn, nil
+}
+
+// onnxMatrixLayer は、(N, D)の行列だけを入出力するlayer.Layerを推論用のlayer.T4DLayerとして使う
+type onnxMatrixLayer struct {
+	layer.Layer
+}
+
+func (o *onnxMatrixLayer) Forward(x interface{}) interface{} {
+	m, ok := x.(*num.Matrix)
+	if !ok {
+		panic(fmt.Sprintf("%T supports only (N, D) input, got %T", o.Layer, x))
+	}
+	return o.Layer.Forward(m, false)
+}
+
+func (o *onnxMatrixLayer) Backward(dout interface{}) interface{} {
+	return o.Layer.Backward(dout.(*num.Matrix))
+}
+
+// onnxFlatten は、(N, C, H, W)を(N, C*H*W)にする
+type onnxFlatten struct {
+	Shape []int
+}
+
+func (f *onnxFlatten) Forward(x interface{}) interface{} {
+	t4d, ok := x.(num.Tensor4D)
+	if !ok {
+		f.Shape = nil
+		return x
+	}
+	f.Shape, _ = shapeOf(t4d)
+	n := len(t4d)
+	v := t4d.Flatten()
+	return &num.Matrix{Vector: v, Rows: n, Columns: len(v) / n}
+}
+
+func (f *onnxFlatten) Backward(dout interface{}) interface{} {
+	if f.Shape == nil {
+		return dout
+	}
+	return fromTensor(Tensor{Shape: f.Shape, Data: dout.(*num.Matrix).Vector})
+}
+
+// onnxSoftmax は、行ごとのソフトマックス関数
+type onnxSoftmax struct {
+	Out *num.Matrix
+}
+
+func (s *onnxSoftmax) Forward(x interface{}) interface{} {
+	s.Out = num.Softmax(x.(*num.Matrix))
+	return s.Out
+}
+
+func (s *onnxSoftmax) Backward(dout interface{}) interface{} {
+	// dx = y * (dout - sum(dout * y))
+	d := dout.(*num.Matrix)
+	dx := num.ZerosLike(d)
+	for i := 0; i < d.Rows; i++ {
+		row := i * d.Columns
+		sum := 0.0
+		for j := 0; j < d.Columns; j++ {
+			sum += d.Vector[row+j] * s.Out.Vector[row+j]
+		}
+		for j := 0; j < d.Columns; j++ {
+			dx.Vector[row+j] = s.Out.Vector[row+j] * (d.Vector[row+j] - sum)
+		}
+	}
+	return dx
+}
+
+// onnxBias は、行列の各行、またはPerChannelなら(N, C, H, W)の各チャンネルにBを足す
+type onnxBias struct {
+	B          *num.Matrix
+	PerChannel bool
+}
+
+func (b *onnxBias) Forward(x interface{}) interface{} {
+	switch x := x.(type) {
+	case *num.Matrix:
+		if !b.PerChannel && x.Columns == b.B.Columns {
+			return num.Add(x, b.B)
+		}
+	case num.Tensor4D:
+		if b.PerChannel && len(x) > 0 && len(x[0]) == b.B.Columns {
+			out := make(num.Tensor4D, len(x))
+			for n, t3d := range x {
+				out[n] = make(num.Tensor3D, len(t3d))
+				for c, m := range t3d {
+					out[n][c] = num.Add(m, b.B.Vector[c])
+				}
+			}
+			return out
+		}
+	}
+	panic(fmt.Sprintf("bias of %d values (per channel: %v) can not be added to %T", b.B.Columns, b.PerChannel, x))
+}
+
+func (b *onnxBias) Backward(dout interface{}) interface{} {
+	return dout
+}
+
+// onnxIdentity は、推論時のDropoutなど何もしない層
+type onnxIdentity struct{}
+
+func (*onnxIdentity) Forward(x interface{}) interface{} {
+	return x
+}
+
+func (*onnxIdentity) Backward(dout interface{}) interface{} {
+	return dout
+}
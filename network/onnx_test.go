@@ -0,0 +1,300 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/onnx"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+func opTypes(g *onnx.Graph) string {
+	ops := []string{}
+	for _, n := range g.Nodes {
+		ops = append(ops, n.OpType)
+	}
+	return strings.Join(ops, " ")
+}
+
+func initializers(g *onnx.Graph) map[string]*onnx.Tensor {
+	ts := map[string]*onnx.Tensor{}
+	for _, t := range g.Initializers {
+		ts[t.Name] = t
+	}
+	return ts
+}
+
+// equalFloat32 は、float32に丸めた値と比べる
+func equalFloat32(actual, expected []float64) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i, v := range expected {
+		if actual[i] != float64(float32(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSequentialExportONNX(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewSGD(0.1))
+	x, _ := num.NewRandnMatrix(4, 4)
+	net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 2, 1}, 3)))
+
+	buf := &bytes.Buffer{}
+	if err := net.ExportONNX(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	m, err := onnx.Read(buf)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if m.IRVersion != onnx.IRVersion || m.Opset("") != onnx.OpsetVersion {
+		fmt.Println(m.IRVersion, m.OpsetImports)
+		t.Fail()
+	}
+	g := m.Graph
+	if ops := opTypes(g); ops != "Gemm BatchNormalization Tanh Dropout Gemm Softmax" {
+		fmt.Println(ops)
+		t.Fail()
+	}
+	if in := g.Inputs[0]; in.Name != "input" || fmt.Sprint(in.Dims) != "[{0 N} {4 }]" || g.Outputs[0].Name != "output" {
+		fmt.Println(in, g.Outputs[0])
+		t.Fail()
+	}
+	gemm := g.Nodes[4]
+	if fmt.Sprint(gemm.Inputs) != "[Dropout1 Affine2.W Affine2.B]" || fmt.Sprint(gemm.Outputs) != "[Affine2]" {
+		fmt.Println(gemm.Inputs, gemm.Outputs)
+		t.Fail()
+	}
+
+	ts := initializers(g)
+	w2 := ts["Affine2.W"]
+	if fmt.Sprint(w2.Dims) != "[5 3]" || !equalFloat32(w2.Data, net.Params["W2"].Vector) {
+		fmt.Println(w2.Dims, w2.Data)
+		t.Fail()
+	}
+	if b1 := ts["Affine1.B"]; fmt.Sprint(b1.Dims) != "[5]" || !equalFloat32(b1.Data, net.Params["b1"].Vector) {
+		fmt.Println(b1.Dims)
+		t.Fail()
+	}
+	// (x-mean)/(sqrt(var)+10e-7)と同じになる分散
+	bn := net.Layers["BatchNorm1"].(*layer.BatchNormalization)
+	variance := make([]float64, 5)
+	for i, v := range bn.RunningVar.Vector {
+		variance[i] = math.Pow(math.Sqrt(v)+10e-7, 2)
+	}
+	if !equalFloat32(ts["BatchNorm1.RunningVar"].Data, variance) || !equalFloat32(ts["BatchNorm1.RunningMean"].Data, bn.RunningMean.Vector) ||
+		g.Nodes[1].Attr("epsilon").F != 0 {
+		fmt.Println(ts["BatchNorm1.RunningVar"].Data, variance)
+		t.Fail()
+	}
+}
+
+func TestGraphExportONNX(t *testing.T) {
+	w1, _ := num.NewRandnT4D(2, 1, 3, 3)
+	b1, _ := num.NewRandnMatrix(1, 2)
+	w2, _ := num.NewRandnMatrix(8, 3)
+	b2, _ := num.NewRandnMatrix(1, 3)
+	g := NewGraph([]string{"x"}, "Affine").
+		AddNode("Conv", layer.NewConv2D(w1, b1, &layer.Conv2DParams{StrideH: 1, StrideW: 1, PadTop: 1, PadBottom: 1, PadLeft: 1, PadRight: 1}), "x").
+		AddNode("Relu", layer.NewReluT4D(), "Conv").
+		AddNode("Pool", layer.NewPooling(2, 2, 2, 0), "Relu").
+		AddNode("Affine", layer.NewAffineT4D(w2, b2), "Pool")
+
+	buf := &bytes.Buffer{}
+	if err := g.ExportONNX(buf, []int{1, 1, 4, 4}); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	m, err := onnx.Read(buf)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if ops := opTypes(m.Graph); ops != "Conv Relu MaxPool Flatten Gemm Identity" {
+		fmt.Println(ops)
+		t.Fail()
+	}
+	conv := m.Graph.Nodes[0]
+	if fmt.Sprint(conv.Attr("kernel_shape").Ints, conv.Attr("pads").Ints, conv.Attr("group").I) != "[3 3] [1 1 1 1] 1" {
+		fmt.Println(conv.Attributes)
+		t.Fail()
+	}
+	pool := m.Graph.Nodes[2]
+	if fmt.Sprint(pool.Attr("kernel_shape").Ints, pool.Attr("strides").Ints) != "[2 2] [2 2]" {
+		fmt.Println(pool.Attributes)
+		t.Fail()
+	}
+	if w := initializers(m.Graph)["Conv.W"]; fmt.Sprint(w.Dims) != "[2 1 3 3]" || !equalFloat32(w.Data, w1.Flatten()) {
+		fmt.Println(w.Dims)
+		t.Fail()
+	}
+	if fmt.Sprint(m.Graph.Inputs[0].Dims) != "[{0 N} {1 } {4 } {4 }]" {
+		fmt.Println(m.Graph.Inputs[0].Dims)
+		t.Fail()
+	}
+
+	// 対応していない層はまとめてエラーにする
+	g.AddNode("GAP", layer.NewGlobalAveragePooling(), "Pool").
+		AddNode("Pad", layer.NewPadding2D(&num.Padding{Top: 1}), "x").
+		AddNode("PaddedPool", layer.NewPooling(2, 2, 2, 1), "Relu")
+	err = g.ExportONNX(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "GAP (*layer.GlobalAveragePooling)") || !strings.Contains(err.Error(), "Pad (*layer.Padding2D)") ||
+		!strings.Contains(err.Error(), "PaddedPool (MaxPool with pad=1)") {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+// readTestTensor は、testdataのTensorProtoを*num.Matrixかnum.Tensor4Dにする
+func readTestTensor(path string) (interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tensor, err := onnx.ReadTensor(f)
+	if err != nil {
+		return nil, err
+	}
+	return onnxMatrix(tensor), nil
+}
+
+// ONNX Model Zooと同じ並びのtestdata（model.onnxとtest_data_set_0）と比べる
+func TestImportONNX(t *testing.T) {
+	for _, model := range []string{"mlp", "lenet"} {
+		dir := filepath.Join("testdata", model)
+		f, err := os.Open(filepath.Join(dir, "model.onnx"))
+		if err != nil {
+			fmt.Println(err)
+			t.FailNow()
+		}
+		g, err := ImportONNX(f)
+		f.Close()
+		if err != nil {
+			fmt.Println(model, err)
+			t.Fail()
+			continue
+		}
+		x, err1 := readTestTensor(filepath.Join(dir, "test_data_set_0", "input_0.pb"))
+		expected, err2 := readTestTensor(filepath.Join(dir, "test_data_set_0", "output_0.pb"))
+		if err1 != nil || err2 != nil {
+			fmt.Println(err1, err2)
+			t.FailNow()
+		}
+		y := g.Forward(x).(*num.Matrix)
+		e := expected.(*num.Matrix)
+		if y.Rows != e.Rows || y.Columns != e.Columns || !closeEnough(y.Vector, e.Vector) {
+			fmt.Println(model, y, e)
+			t.Fail()
+		}
+	}
+}
+
+func TestImportONNXRoundTrip(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewSGD(0.1))
+	x, _ := num.NewRandnMatrix(4, 4)
+	for i := 0; i < 3; i++ {
+		net.UpdateParams(net.Gradient(x, oneHot([]int{0, 1, 2, 1}, 3)))
+	}
+	buf := &bytes.Buffer{}
+	if err := net.ExportONNX(buf); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	g, err := ImportONNX(buf)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	// 書き出しはfloat32なので、その精度で一致する
+	y := g.Forward(x).(*num.Matrix)
+	expected := net.Predict(x, false)
+	if !closeEnough(y.Vector, num.Softmax(expected).Vector) {
+		fmt.Println(y, num.Softmax(expected))
+		t.Fail()
+	}
+}
+
+func TestImportONNXUnsupported(t *testing.T) {
+	f, _ := os.Open(filepath.Join("testdata", "lenet", "model.onnx"))
+	m, err := onnx.Read(f)
+	f.Close()
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	m.Graph.Nodes[2].Attr("ceil_mode").I = 1
+	m.Graph.Nodes = append(m.Graph.Nodes, &onnx.Node{Name: "MaxPool_8", OpType: "MaxPool", Inputs: []string{"output"}, Outputs: []string{"pool"},
+		Attributes: []*onnx.Attribute{onnx.IntsAttr("kernel_shape", 2, 2), onnx.IntsAttr("pads", 1, 1, 1, 1)}})
+	m.Graph.Nodes = append(m.Graph.Nodes, &onnx.Node{Name: "LSTM_9", OpType: "LSTM", Inputs: []string{"output"}, Outputs: []string{"lstm"}})
+	buf := &bytes.Buffer{}
+	onnx.Write(buf, m)
+	_, err = ImportONNX(buf)
+	if err == nil || !strings.Contains(err.Error(), "MaxPool (MaxPool_2: ceil_mode=1)") || !strings.Contains(err.Error(), "LSTM (LSTM_9: unsupported operator)") ||
+		!strings.Contains(err.Error(), "MaxPool (MaxPool_8: pads=[1 1 1 1])") {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+// TestImportONNXMalformed は、壊れたノードがpanicせずにエラーになることを確かめる
+func TestImportONNXMalformed(t *testing.T) {
+	inits := map[string]*onnx.Tensor{
+		"W":     {Name: "W", Dims: []int64{3, 2}, Data: make([]float64, 6)},
+		"C":     {Name: "C", Dims: []int64{0}},
+		"short": {Name: "short", Dims: []int64{2, 2}, Data: []float64{1}},
+		"b3":    {Name: "b3", Dims: []int64{2, 1, 3}, Data: make([]float64, 6)},
+		"s":     {Name: "s", Dims: []int64{2}, Data: []float64{1, 1}},
+		"cb":    {Name: "cb", Dims: []int64{2, 1, 1}, Data: []float64{1, -1}},
+	}
+	cases := []struct {
+		node     *onnx.Node
+		expected string
+	}{
+		{&onnx.Node{OpType: "Relu", Outputs: []string{"y"}}, "0 inputs and 1 outputs"},
+		{&onnx.Node{OpType: "Gemm", Inputs: []string{"x"}, Outputs: []string{"y"}}, "no weight"},
+		{&onnx.Node{OpType: "Gemm", Inputs: []string{"x", "W", "C"}, Outputs: []string{"y"}}, "C has shape [0]"},
+		{&onnx.Node{OpType: "Gemm", Inputs: []string{"x", "short"}, Outputs: []string{"y"}}, "short has shape [2 2] and 1 values"},
+		{&onnx.Node{OpType: "Add", Inputs: []string{"x", "b3"}, Outputs: []string{"y"}}, "bias has shape [2 1 3]"},
+		{&onnx.Node{OpType: "Add", Inputs: []string{"x"}, Outputs: []string{"y"}}, "1 inputs"},
+		{&onnx.Node{OpType: "BatchNormalization", Inputs: []string{"x", "s", "s"}, Outputs: []string{"y"}}, "no mean"},
+		{&onnx.Node{OpType: "BatchNormalization", Inputs: []string{"x", "s", "s", "s", "W"}, Outputs: []string{"y"}}, "var has shape [3 2]"},
+		{&onnx.Node{OpType: "Conv", Inputs: []string{"x"}, Outputs: []string{"y"}}, "no weight"},
+		{&onnx.Node{OpType: "Reshape", Inputs: []string{"x"}, Outputs: []string{"y"}}, "no shape"},
+		{&onnx.Node{OpType: "MaxPool", Inputs: []string{"x"}, Outputs: []string{"y"},
+			Attributes: []*onnx.Attribute{onnx.IntsAttr("kernel_shape", 2, 2), onnx.IntsAttr("strides", 2)}}, "strides=[2]"},
+	}
+	for _, c := range cases {
+		if _, _, err := importNode(c.node, inits, 13); err == nil || err.Error() != c.expected {
+			fmt.Println(c.node.OpType, err)
+			t.Fail()
+		}
+	}
+
+	// (C, 1, 1)の定数はチャンネルごとに足す
+	l, ins, err := importNode(&onnx.Node{OpType: "Add", Inputs: []string{"cb", "x"}, Outputs: []string{"y"}}, inits, 13)
+	if err != nil || fmt.Sprint(ins) != "[x]" {
+		fmt.Println(ins, err)
+		t.FailNow()
+	}
+	x := num.Tensor4D{{num.Zeros(2, 2), num.Zeros(2, 2)}}
+	y := l.(layer.T4DLayer).Forward(x).(num.Tensor4D)
+	if y[0][0].Vector[3] != 1 || y[0][1].Vector[0] != -1 {
+		fmt.Println(y)
+		t.Fail()
+	}
+}
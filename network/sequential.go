@@ -0,0 +1,176 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+// Sequential は、層を順番に積み重ねたモデル
+// Affine・DropConnectのk番目の重みとバイアスをParamsの"Wk"・"bk"にする（TwoLayerNetなどと同じ）
+// Embeddingのk番目の重みは"Ek"にする（重み減衰はしない）
+type Sequential struct {
+	Params            map[string]*num.Matrix
+	Layers            map[string]layer.Layer
+	Sequence          []string
+	LastLayer         layer.LossLayer
+	Optimizer         optimizer.Optimizer
+	Trainable         // 凍結したパラメタはUpdateParamsで更新しない
+	WeightDecayLambda float64
+	// ModelConfig.Buildで作った場合の設定
+	Config *ModelConfig
+	// 重みを持つ層の名前（Paramsの番号順）
+	weighted   []string
+	embeddings []string
+}
+
+func NewSequential(opt optimizer.Optimizer, weightDecayLambda float64) *Sequential {
+	if err := checkWeightDecay(opt, weightDecayLambda); err != nil {
+		panic(err)
+	}
+	return &Sequential{
+		Params:            map[string]*num.Matrix{},
+		Layers:            map[string]layer.Layer{},
+		LastLayer:         layer.NewSfotmaxWithLoss(),
+		Optimizer:         opt,
+		WeightDecayLambda: weightDecayLambda,
+	}
+}
+
+// Add は、層を最後に追加する
+// layer.T4DLayer（Tanhなど）は行列を入出力する層として追加する
+func (net *Sequential) Add(name string, l interface{}) *Sequential {
+	if _, ok := net.Layers[name]; ok {
+		panic(fmt.Sprintf("layer %q already exists", name))
+	}
+	switch v := l.(type) {
+	case layer.Layer:
+		net.Layers[name] = v
+	case layer.T4DLayer:
+		net.Layers[name] = &matrixLayer{T4DLayer: v}
+	default:
+		panic(fmt.Sprintf("layer %q has unsupported type %T", name, l))
+	}
+	net.Sequence = append(net.Sequence, name)
+	if w, b := weightsOf(net.Layers[name]); w != nil {
+		net.weighted = append(net.weighted, name)
+		k := len(net.weighted)
+		net.Params[fmt.Sprintf("W%d", k)] = w
+		net.Params[fmt.Sprintf("b%d", k)] = b
+	}
+	if e, ok := l.(*layer.Embedding); ok {
+		net.embeddings = append(net.embeddings, name)
+		net.Params[fmt.Sprintf("E%d", len(net.embeddings))] = e.W
+	}
+	return net
+}
+
+// SetLoss は、損失関数の層を変える（既定はSoftmaxWithLoss）
+func (net *Sequential) SetLoss(l layer.LossLayer) *Sequential {
+	net.LastLayer = l
+	return net
+}
+
+// matrixLayer は、layer.T4DLayerをlayer.Layerとして使う
+type matrixLayer struct {
+	layer.T4DLayer
+}
+
+func (m *matrixLayer) Forward(x *num.Matrix, _ bool) *num.Matrix {
+	return m.T4DLayer.Forward(x).(*num.Matrix)
+}
+
+func (m *matrixLayer) Backward(dout *num.Matrix) *num.Matrix {
+	return m.T4DLayer.Backward(dout).(*num.Matrix)
+}
+
+// weightsOf は、重みを持つ層の重みとバイアス
+func weightsOf(l layer.Layer) (*num.Matrix, *num.Matrix) {
+	switch v := l.(type) {
+	case *layer.Affine:
+		return v.W, v.B
+	case *layer.DropConnect:
+		return v.W, v.B
+	}
+	return nil, nil
+}
+
+func (net *Sequential) Predict(x *num.Matrix, trainFlg bool) *num.Matrix {
+	for _, k := range net.Sequence {
+		x = net.Layers[k].Forward(x, trainFlg)
+	}
+	return x
+}
+
+func (net *Sequential) Loss(x, t *num.Matrix, trainFlg bool) float64 {
+	y := net.Predict(x, trainFlg)
+
+	weightDecay := 0.0
+	for i := range net.weighted {
+		W := net.Params[fmt.Sprintf("W%d", i+1)]
+		weightDecay += 0.5 * net.WeightDecayLambda * num.SumAll(num.Pow(W, 2))
+	}
+	return net.LastLayer.Forward(y, t) + weightDecay
+}
+
+func (net *Sequential) Accuracy(x, t *num.Matrix) float64 {
+	y := net.Predict(x, false)
+	yMax := num.ArgMax(y, 1)
+	tMax := num.ArgMax(t, 1)
+	sum := 0.0
+	for i, v := range yMax {
+		if v == tMax[i] {
+			sum += 1.0
+		}
+	}
+	return sum / float64(x.Rows)
+}
+
+func (net *Sequential) Gradient(x, t *num.Matrix) map[string]*num.Matrix {
+	// forward
+	net.Loss(x, t, true)
+
+	// backward
+	dout := net.LastLayer.Backward(1.0)
+	for i := len(net.Sequence) - 1; i >= 0; i-- {
+		dout = net.Layers[net.Sequence[i]].Backward(dout)
+	}
+
+	grads := map[string]*num.Matrix{}
+	for i, name := range net.weighted {
+		w := fmt.Sprintf("W%d", i+1)
+		b := fmt.Sprintf("b%d", i+1)
+		switch v := net.Layers[name].(type) {
+		case *layer.Affine:
+			grads[w] = num.Add(v.DW, num.Mul(net.WeightDecayLambda, v.W))
+			grads[b] = v.DB
+		case *layer.DropConnect:
+			grads[w] = num.Add(v.DW, num.Mul(net.WeightDecayLambda, v.W))
+			grads[b] = v.DB
+		}
+	}
+	for i, name := range net.embeddings {
+		grads[fmt.Sprintf("E%d", i+1)] = net.Layers[name].(*layer.Embedding).DenseDW()
+	}
+	return grads
+}
+
+func (net *Sequential) UpdateParams(grads map[string]*num.Matrix) {
+	net.Params = net.update(net.Optimizer, net.Params, grads)
+
+	for i, name := range net.weighted {
+		w := net.Params[fmt.Sprintf("W%d", i+1)]
+		b := net.Params[fmt.Sprintf("b%d", i+1)]
+		switch v := net.Layers[name].(type) {
+		case *layer.Affine:
+			v.W, v.B = w, b
+		case *layer.DropConnect:
+			v.W, v.B = w, b
+		}
+	}
+	for i, name := range net.embeddings {
+		net.Layers[name].(*layer.Embedding).W = net.Params[fmt.Sprintf("E%d", i+1)]
+	}
+}
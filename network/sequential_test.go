@@ -0,0 +1,176 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+const yamlConfig = `
+input_size: 4
+weight_decay_lambda: 0.1
+layers:
+  - {type: affine, units: 5, init: xavier_normal}
+  - {type: batchnorm}
+  - {type: tanh}
+  - {type: dropout, ratio: 0.5}
+  - {type: affine, units: 3}
+`
+
+const jsonConfig = `{
+  "input_size": 4,
+  "weight_decay_lambda": 0.1,
+  "layers": [
+    {"type": "affine", "units": 5, "init": "xavier_normal"},
+    {"type": "batchnorm"},
+    {"type": "tanh"},
+    {"type": "dropout", "ratio": 0.5},
+    {"type": "affine", "units": 3}
+  ]
+}`
+
+func TestReadConfig(t *testing.T) {
+	for _, src := range []string{yamlConfig, jsonConfig} {
+		cfg, err := ReadConfig(strings.NewReader(src))
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			continue
+		}
+		net, err := cfg.Build(optimizer.NewSGD(0.1))
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+			continue
+		}
+		if fmt.Sprint(net.Sequence) != "[Affine1 BatchNorm1 Tanh1 Dropout1 Affine2]" {
+			fmt.Println(net.Sequence)
+			t.Fail()
+		}
+		if w := net.Params["W2"]; w.Rows != 5 || w.Columns != 3 || net.Params["b1"].Columns != 5 {
+			fmt.Println(w.Rows, w.Columns)
+			t.Fail()
+		}
+		if net.WeightDecayLambda != 0.1 {
+			t.Fail()
+		}
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	for _, src := range []string{
+		"input_size: 4\nlayer: []",
+		"input_size: 4\nlayers: [{type: affine, unit: 3}]",
+	} {
+		if _, err := ReadConfig(strings.NewReader(src)); err == nil {
+			fmt.Println(src)
+			t.Fail()
+		}
+	}
+	for _, src := range []string{
+		"input_size: 4\nlayers: [{type: conv}]",
+		"input_size: 4\nlayers: [{type: affine}]",
+		"input_size: 4\nlayers: [{type: affine, units: 3, init: unknown}]",
+		"input_size: 4\nloss: unknown\nlayers: []",
+		"input_size: 4\nlayers: [{type: embedding, units: 3}]",
+		"input_size: 4\nlayers: [{type: embedding, units: 3, vocab: 5, padding_idx: 5}]",
+	} {
+		cfg, err := ReadConfig(strings.NewReader(src))
+		if err != nil {
+			t.Fail()
+			continue
+		}
+		if _, err := cfg.Build(optimizer.NewSGD(0.1)); err == nil {
+			fmt.Println(src)
+			t.Fail()
+		}
+	}
+}
+
+func TestSequentialGradient(t *testing.T) {
+	// 損失はlogの中に微小な値を足しているので、確率が小さすぎると数値微分とずれる
+	// 重みを小さくして、出力の確率を一様に近くしておく
+	w1, _ := num.NewRandnMatrix(4, 5)
+	w2, _ := num.NewRandnMatrix(5, 3)
+	w1, w2 = num.Mul(w1, 0.3), num.Mul(w2, 0.3)
+	net := NewSequential(optimizer.NewSGD(0.1), 0.1).
+		Add("Affine1", layer.NewAffine(w1, num.Zeros(1, 5))).
+		Add("Gelu1", layer.NewGelu()).
+		Add("Affine2", layer.NewAffine(w2, num.Zeros(1, 3)))
+
+	x, _ := num.NewRandnMatrix(2, 4)
+	tm, _ := num.NewMatrix(2, 3, vec.Vector{
+		0, 1, 0,
+		1, 0, 0,
+	})
+	grads := net.Gradient(x, tm)
+	for _, k := range []string{"W1", "b1", "W2", "b2"} {
+		numerical := vec.NumericalGradient(func(vec.Vector) float64 { return net.Loss(x, tm, true) }, net.Params[k].Vector)
+		if !closeEnough(grads[k].Vector, numerical) {
+			fmt.Println(k, grads[k], numerical)
+			t.Fail()
+		}
+	}
+
+	before := net.Loss(x, tm, false)
+	net.UpdateParams(grads)
+	if net.Layers["Affine1"].(*layer.Affine).W != net.Params["W1"] {
+		t.Fail()
+	}
+	if after := net.Loss(x, tm, false); after >= before {
+		fmt.Println(before, after)
+		t.Fail()
+	}
+}
+
+func TestSequentialEmbedding(t *testing.T) {
+	src := `
+input_size: 3
+layers:
+  - {type: embedding, vocab: 5, units: 2, padding_idx: 0}
+  - {type: tanh}
+  - {type: affine, units: 2}
+`
+	cfg, _ := ReadConfig(strings.NewReader(src))
+	net, err := cfg.Build(optimizer.NewSGD(0.1))
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if e := net.Params["E1"]; e.Rows != 5 || e.Columns != 2 || net.Params["W1"].Rows != 6 {
+		fmt.Println(net.Params)
+		t.Fail()
+	}
+
+	x, _ := num.NewMatrix(2, 3, vec.Vector{
+		1, 4, 0,
+		3, 3, 2,
+	})
+	tm := oneHot([]int{0, 1}, 2)
+	grads := net.Gradient(x, tm)
+	numerical := vec.NumericalGradient(func(vec.Vector) float64 { return net.Loss(x, tm, true) }, net.Params["E1"].Vector)
+	// パディングのid 0の行は学習しない
+	numerical[0], numerical[1] = 0, 0
+	if !closeEnough(grads["E1"].Vector, numerical) {
+		fmt.Println(grads["E1"], numerical)
+		t.Fail()
+	}
+	net.UpdateParams(grads)
+	if net.Layers["Embedding1"].(*layer.Embedding).W != net.Params["E1"] {
+		t.Fail()
+	}
+
+	// 語彙数以上のid
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	bad, _ := num.NewMatrix(1, 3, vec.Vector{1, 5, 0})
+	net.Predict(bad, false)
+}
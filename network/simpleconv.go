@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/naronA/zero_deeplearning/initializer"
 	"github.com/naronA/zero_deeplearning/layer"
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/optimizer"
@@ -15,8 +16,9 @@ type SimpleConvNet struct {
 	// T4DParams      map[string]num.Tensor4D
 	T4DLayers map[string]layer.T4DLayer
 	Sequence  []string
-	LastLayer *layer.SoftmaxWithLoss
+	LastLayer layer.LossLayer
 	Optimizer optimizer.AnyOptimizer
+	Trainable // 凍結したパラメタはUpdateParamsで更新しない
 	// WeightDecayLambda float64
 }
 
@@ -41,6 +43,7 @@ func NewSimpleConvNet(
 	hiddenSize int,
 	outputSize int,
 	weightInitStd float64,
+	inits ...initializer.Initializer,
 ) *SimpleConvNet {
 	filterNum := convParams.FilterNum
 	filterSize := convParams.FilterSize
@@ -51,26 +54,18 @@ func NewSimpleConvNet(
 	convOutputSize := (inputSize-filterSize+2*filterPad)/filterStride + 1
 	poolOutputSize := filterNum * (convOutputSize / 2) * (convOutputSize / 2)
 
-	W1Rnd, err := num.NewRandnT4D(filterNum, inputDim.Channel, filterSize, filterSize)
-	if err != nil {
-		panic(err)
-	}
-	W2Rnd, err := num.NewRandnMatrix(poolOutputSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W3Rnd, err := num.NewRandnMatrix(hiddenSize, outputSize)
-	if err != nil {
-		panic(err)
-	}
+	// 初期化方法を省略した場合は、標準偏差weightInitStdの正規分布
+	// 1つなら全層、3つならConv1・Affine1・Affine2の順に使う
+	checkInits(inits, 3)
+	init := initializer.Initializer(initializer.NewNormal(weightInitStd))
 	params := map[string]interface{}{}
 	// t4dparams := map[string]num.Tensor4D{}
 
-	W1 := num.MulT4D(W1Rnd, weightInitStd)
+	W1 := initializer.Tensor4D(layerInit(inits, 0, init), filterNum, inputDim.Channel, filterSize, filterSize)
 	b1 := num.Zeros(1, filterNum)
-	W2 := num.Mul(W2Rnd, weightInitStd)
+	W2 := initializer.Matrix(layerInit(inits, 1, init), poolOutputSize, hiddenSize)
 	b2 := num.Zeros(1, hiddenSize)
-	W3 := num.Mul(W3Rnd, weightInitStd)
+	W3 := initializer.Matrix(layerInit(inits, 2, init), hiddenSize, outputSize)
 	b3 := num.Zeros(1, outputSize)
 
 	params["W1"] = W1
@@ -128,7 +123,7 @@ func (net *SimpleConvNet) Loss(x num.Tensor4D, t *num.Matrix) float64 {
 func (net *SimpleConvNet) Gradient(x num.Tensor4D, t *num.Matrix) map[string]interface{} {
 	// forward
 	net.Loss(x, t)
-	var dout interface{} = net.LastLayer.Backward(0)
+	var dout interface{} = net.LastLayer.Backward(1.0)
 
 	for i := len(net.Sequence) - 1; i >= 0; i-- {
 		key := net.Sequence[i]
@@ -147,7 +142,7 @@ func (net *SimpleConvNet) Gradient(x num.Tensor4D, t *num.Matrix) map[string]int
 }
 
 func (net *SimpleConvNet) UpdateParams(grads map[string]interface{}) {
-	net.Params = net.Optimizer.Update(net.Params, grads)
+	net.Params = net.updateAny(net.Optimizer, net.Params, grads)
 
 	conv1 := net.T4DLayers["Conv1"].(*layer.Convolution)
 	conv1.W = net.Params["W1"].(num.Tensor4D)
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"github.com/naronA/zero_deeplearning/initializer"
 	"github.com/naronA/zero_deeplearning/num"
 	"github.com/naronA/zero_deeplearning/vec"
 )
@@ -9,19 +10,14 @@ type SlowTwoLayerNet struct {
 	Params map[string]*num.Matrix
 }
 
-func NewSlowTwoLayerNet(inputSize, hiddenSize, outputSize int, weightInitStd float64) *SlowTwoLayerNet {
+// NewSlowTwoLayerNet は、初期化方法を省略した場合、標準偏差weightInitStdの正規分布で重みを作る
+func NewSlowTwoLayerNet(inputSize, hiddenSize, outputSize int, weightInitStd float64, inits ...initializer.Initializer) *SlowTwoLayerNet {
+	checkInits(inits, 2)
+	init := initializer.Initializer(initializer.NewNormal(weightInitStd))
 	params := map[string]*num.Matrix{}
-	W1, err := num.NewRandnMatrix(inputSize, hiddenSize)
-	if err != nil {
-		panic(err)
-	}
-	W2, err := num.NewRandnMatrix(hiddenSize, outputSize)
-	if err != nil {
-		panic(err)
-	}
-	params["W1"] = num.Mul(W1, weightInitStd)
+	params["W1"] = initializer.Matrix(layerInit(inits, 0, init), inputSize, hiddenSize)
 	params["b1"] = num.Zeros(1, hiddenSize)
-	params["W2"] = num.Mul(W2, weightInitStd)
+	params["W2"] = initializer.Matrix(layerInit(inits, 1, init), hiddenSize, outputSize)
 	params["b2"] = num.Zeros(1, outputSize)
 	return &SlowTwoLayerNet{Params: params}
 }
@@ -0,0 +1,433 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// LayerSummary は、1つの層の出力の形・パラメタ数・積和演算の回数
+type LayerSummary struct {
+	Name               string
+	Type               string
+	OutputShape        []int
+	TrainableParams    int
+	NonTrainableParams int // BatchNormalizationの移動平均・移動分散など
+	MACs               int // 積和演算の回数の見積もり
+}
+
+// ModelSummary は、モデル全体のSummary
+type ModelSummary struct {
+	InputShape         []int
+	Layers             []LayerSummary
+	TrainableParams    int
+	NonTrainableParams int
+	MACs               int
+}
+
+// String は、Kerasのmodel.summary()のような表
+func (s *ModelSummary) String() string {
+	buf := &bytes.Buffer{}
+	line := strings.Repeat("-", 84)
+	fmt.Fprintf(buf, "%-36s%-20s%12s%16s\n", "Layer (type)", "Output Shape", "Param #", "MACs")
+	fmt.Fprintln(buf, line)
+	fmt.Fprintf(buf, "%-36s%-20s%12d%16d\n", "Input", fmt.Sprint(s.InputShape), 0, 0)
+	for _, l := range s.Layers {
+		name := fmt.Sprintf("%s (%s)", l.Name, l.Type)
+		fmt.Fprintf(buf, "%-36s%-20s%12d%16d\n", name, fmt.Sprint(l.OutputShape), l.TrainableParams+l.NonTrainableParams, l.MACs)
+	}
+	fmt.Fprintln(buf, line)
+	fmt.Fprintf(buf, "Total params: %d\n", s.TrainableParams+s.NonTrainableParams)
+	fmt.Fprintf(buf, "Trainable params: %d\n", s.TrainableParams)
+	fmt.Fprintf(buf, "Non-trainable params: %d\n", s.NonTrainableParams)
+	fmt.Fprintf(buf, "Multiply-adds: %d\n", s.MACs)
+	return buf.String()
+}
+
+// Summary は、inputShape（バッチサイズを含む）の入力に対する各層の出力の形などを表示して返す
+// 形が合わない層があれば、その層の名前のエラーを返す
+// 凍結したパラメタは学習しないパラメタに数える
+func (net *Sequential) Summary(inputShape []int) (*ModelSummary, error) {
+	frozen := net.frozenSize(net.layerParams, matrixParams(net.Params))
+	return printSummary(sequenceSummary(net.Sequence, layerMap(net.Layers), inputShape, frozen))
+}
+
+func (net *SimpleConvNet) Summary(inputShape []int) (*ModelSummary, error) {
+	layers := map[string]interface{}{}
+	for k, l := range net.T4DLayers {
+		layers[k] = l
+	}
+	frozen := net.frozenSize(net.layerParams, net.Params)
+	return printSummary(sequenceSummary(net.Sequence, layers, inputShape, frozen))
+}
+
+func (net *TwoLayerNet) Summary(inputShape []int) (*ModelSummary, error) {
+	frozen := net.frozenSize(affineParams(net.Layers), matrixParams(net.Params))
+	return printSummary(sequenceSummary(net.Sequence, layerMap(net.Layers), inputShape, frozen))
+}
+
+func (net *ThreeLayerNet) Summary(inputShape []int) (*ModelSummary, error) {
+	frozen := net.frozenSize(affineParams(net.Layers), matrixParams(net.Params))
+	return printSummary(sequenceSummary(net.Sequence, layerMap(net.Layers), inputShape, frozen))
+}
+
+func (net *FourLayerNet) Summary(inputShape []int) (*ModelSummary, error) {
+	frozen := net.frozenSize(affineParams(net.Layers), matrixParams(net.Params))
+	return printSummary(sequenceSummary(net.Sequence, layerMap(net.Layers), inputShape, frozen))
+}
+
+func (net *MultiLayerNet) Summary(inputShape []int) (*ModelSummary, error) {
+	frozen := net.frozenSize(affineParams(net.Layers), matrixParams(net.Params))
+	return printSummary(sequenceSummary(net.Sequence, layerMap(net.Layers), inputShape, frozen))
+}
+
+// Summary は、Graphの入力が1つならinputShapes[0]、複数ならInputsの順の形で求める
+func (g *Graph) Summary(inputShapes ...[]int) (*ModelSummary, error) {
+	shapes := map[string][]int{}
+	for i, in := range g.Inputs {
+		shapes[in] = inputShapes[i]
+	}
+	nodes := make([]*GraphNode, len(g.Order()))
+	for i, name := range g.Order() {
+		nodes[i] = g.Nodes[name]
+	}
+	s, err := summarize(nodes, shapes, nil)
+	if err == nil {
+		s.InputShape = inputShapes[0]
+	}
+	return printSummary(s, err)
+}
+
+func layerMap(layers map[string]layer.Layer) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, l := range layers {
+		m[k] = l
+	}
+	return m
+}
+
+func printSummary(s *ModelSummary, err error) (*ModelSummary, error) {
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print(s)
+	return s, nil
+}
+
+func sequenceSummary(seq []string, layers map[string]interface{}, inputShape []int, frozen func(string) int) (*ModelSummary, error) {
+	nodes := make([]*GraphNode, len(seq))
+	prev := "input"
+	for i, name := range seq {
+		nodes[i] = &GraphNode{Name: name, Layer: layers[name], Inputs: []string{prev}}
+		prev = name
+	}
+	s, err := summarize(nodes, map[string][]int{"input": inputShape}, frozen)
+	if err == nil {
+		s.InputShape = inputShape
+	}
+	return s, err
+}
+
+// summarize は、nodesを順に形を求めながら集計する
+// frozenは、層の凍結したパラメタの数（nilなら全部学習する）
+func summarize(nodes []*GraphNode, shapes map[string][]int, frozen func(string) int) (*ModelSummary, error) {
+	s := &ModelSummary{}
+	for _, node := range nodes {
+		l := node.Layer
+		if m, ok := l.(*matrixLayer); ok {
+			l = m.T4DLayer
+		}
+		in := make([][]int, len(node.Inputs))
+		for i, name := range node.Inputs {
+			in[i] = shapes[name]
+		}
+		out, err := outputShape(l, in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: input shape %v: %v", node.Name, in[0], err)
+		}
+		shapes[node.Name] = out
+		trainable, nonTrainable := countParams(l, in[0])
+		if frozen != nil {
+			n := frozen(node.Name)
+			trainable, nonTrainable = trainable-n, nonTrainable+n
+		}
+		ls := LayerSummary{
+			Name:               node.Name,
+			Type:               strings.TrimPrefix(fmt.Sprintf("%T", l), "*layer."),
+			OutputShape:        out,
+			TrainableParams:    trainable,
+			NonTrainableParams: nonTrainable,
+			MACs:               countMACs(l, in[0], out),
+		}
+		s.Layers = append(s.Layers, ls)
+		s.TrainableParams += trainable
+		s.NonTrainableParams += nonTrainable
+		s.MACs += ls.MACs
+	}
+	return s, nil
+}
+
+func prod(shape []int) int {
+	p := 1
+	for _, v := range shape {
+		p *= v
+	}
+	return p
+}
+
+// outputShape は、形を変えない層・全結合層・再帰層は計算で、それ以外は0の入力で順伝搬して求める
+// 順伝搬の後は層の状態（キャッシュ・隠れ状態など）を元に戻すので、学習の途中で呼んでもよい
+func outputShape(l interface{}, in [][]int) (out []int, err error) {
+	switch v := l.(type) {
+	case *layer.ReLU, *layer.ReLUT4D, *layer.Sigmoid, *layer.Tanh, *layer.LeakyReLU, *layer.PReLU,
+		*layer.ELU, *layer.GELU, *layer.Swish, *layer.Softplus,
+		*layer.Dropout, *layer.Dropout2D, *layer.BatchNormalization:
+		return in[0], nil
+	case *layer.Affine, *layer.AffineT4D, *layer.DropConnect:
+		w, _ := weightsOfAny(v)
+		if d := prod(in[0][1:]); d != w.Rows {
+			return nil, fmt.Errorf("flattened input size %d does not match weight rows %d", d, w.Rows)
+		}
+		if _, ok := v.(*layer.AffineT4D); !ok && len(in[0]) != 2 {
+			return nil, fmt.Errorf("%T takes a matrix", v)
+		}
+		return []int{in[0][0], w.Columns}, nil
+	case *layer.TimeRNN:
+		return []int{in[0][0], in[0][1], v.Wh.Rows}, nil
+	case *layer.TimeLSTM:
+		return []int{in[0][0], in[0][1], v.Wh.Rows}, nil
+	case *layer.TimeGRU:
+		return []int{in[0][0], in[0][1], v.Wh.Rows}, nil
+	}
+
+	defer preserve(l)()
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	var y interface{}
+	switch v := l.(type) {
+	case layer.Layer:
+		y = v.Forward(zerosOf(in[0]).(*num.Matrix), false)
+	case layer.T4DLayer:
+		y = v.Forward(zerosOf(in[0]))
+	case layer.MultiInputLayer:
+		xs := make([]interface{}, len(in))
+		for i, shape := range in {
+			xs[i] = zerosOf(shape)
+		}
+		y = v.Forward(xs)
+	default:
+		return nil, fmt.Errorf("unsupported layer %T", l)
+	}
+	return shapeOf(y)
+}
+
+// preserve は、lから公開フィールドでたどれる層などの構造体の値を保存し、元に戻す関数を返す
+// 重みの値は書き換えないので、行列の要素はたどらない
+func preserve(l interface{}) func() {
+	type saved struct{ ptr, value reflect.Value }
+	all := []saved{}
+	seen := map[uintptr]bool{}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() || v.Elem().Kind() != reflect.Struct || seen[v.Pointer()] {
+				return
+			}
+			seen[v.Pointer()] = true
+			value := reflect.New(v.Elem().Type()).Elem()
+			value.Set(v.Elem())
+			all = append(all, saved{v, value})
+			walk(v.Elem())
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).PkgPath == "" {
+					walk(v.Field(i))
+				}
+			}
+		case reflect.Slice:
+			switch v.Type().Elem().Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Slice, reflect.Map:
+				for i := 0; i < v.Len(); i++ {
+					walk(v.Index(i))
+				}
+			}
+		case reflect.Map:
+			for _, k := range v.MapKeys() {
+				walk(v.MapIndex(k))
+			}
+		}
+	}
+	walk(reflect.ValueOf(l))
+	return func() {
+		for i := len(all) - 1; i >= 0; i-- {
+			all[i].ptr.Elem().Set(all[i].value)
+		}
+	}
+}
+
+// weightsOfAny は、全結合層の重みとバイアス
+func weightsOfAny(l interface{}) (*num.Matrix, *num.Matrix) {
+	if v, ok := l.(*layer.AffineT4D); ok {
+		return v.W, v.B
+	}
+	return weightsOf(l.(layer.Layer))
+}
+
+func zerosOf(shape []int) interface{} {
+	switch len(shape) {
+	case 2:
+		return num.Zeros(shape[0], shape[1])
+	case 3:
+		t3d := make(num.Tensor3D, shape[0])
+		for i := range t3d {
+			t3d[i] = num.Zeros(shape[1], shape[2])
+		}
+		return t3d
+	case 4:
+		return num.ZerosT4D(shape[0], shape[1], shape[2], shape[3])
+	case 5:
+		return num.ZerosT5D(shape[0], shape[1], shape[2], shape[3], shape[4])
+	}
+	panic(fmt.Sprintf("unsupported shape %v", shape))
+}
+
+func shapeOf(x interface{}) ([]int, error) {
+	switch v := x.(type) {
+	case *num.Matrix:
+		if v != nil {
+			return []int{v.Rows, v.Columns}, nil
+		}
+	case num.Tensor3D:
+		return []int{len(v), v[0].Rows, v[0].Columns}, nil
+	case num.Tensor4D:
+		return []int{len(v), len(v[0]), v[0][0].Rows, v[0][0].Columns}, nil
+	case num.Tensor5D:
+		return []int{len(v), len(v[0]), len(v[0][0]), v[0][0][0].Rows, v[0][0][0].Columns}, nil
+	}
+	return nil, fmt.Errorf("unexpected output %T", x)
+}
+
+func size(ms ...*num.Matrix) int {
+	n := 0
+	for _, m := range ms {
+		if m != nil {
+			n += len(m.Vector)
+		}
+	}
+	return n
+}
+
+// countParams は、学習するパラメタと学習しないパラメタの数
+func countParams(l interface{}, in []int) (int, int) {
+	switch v := l.(type) {
+	case *layer.Affine:
+		return size(v.W, v.B), 0
+	case *layer.AffineT4D:
+		return size(v.W, v.B), 0
+	case *layer.DropConnect:
+		return size(v.W, v.B), 0
+	case *layer.TimeAffine:
+		return size(v.W, v.B), 0
+	case *layer.Convolution:
+		return len(v.W.Flatten()) + size(v.B), 0
+	case *layer.Conv2D:
+		return len(v.W.Flatten()) + size(v.B), 0
+	case *layer.ConvTranspose2D:
+		return len(v.W.Flatten()) + size(v.B), 0
+	case *layer.Conv3D:
+		return len(v.W.Flatten()) + size(v.B), 0
+	case *layer.Conv1D:
+		return len(v.W.Flatten()) + size(v.B), 0
+	case *layer.DepthwiseSeparableConv2D:
+		dw, _ := countParams(v.Depthwise, in)
+		pw, _ := countParams(v.Pointwise, in)
+		return dw + pw, 0
+	case *layer.PReLU:
+		return size(v.Alpha), 0
+	case *layer.Embedding:
+		return size(v.W), 0
+	case *layer.LayerNormalization:
+		return size(v.Gamma, v.Beta), 0
+	case *layer.GroupNormalization:
+		return size(v.Gamma, v.Beta), 0
+	case *layer.InstanceNormalization:
+		return size(v.Gamma, v.Beta), 0
+	case *layer.BatchNormalization:
+		// 移動平均と移動分散
+		return 0, 2 * prod(in[1:])
+	case *layer.TimeRNN:
+		return size(v.Wx, v.Wh, v.B), 0
+	case *layer.TimeLSTM:
+		return size(v.Wx, v.Wh, v.B), 0
+	case *layer.TimeGRU:
+		return size(v.Wx, v.Wh, v.B), 0
+	case *layer.MultiHeadAttention:
+		return size(v.Wq, v.Bq, v.Wk, v.Bk, v.Wv, v.Bv, v.Wo, v.Bo), 0
+	case *layer.TransformerEncoder:
+		attn, _ := countParams(v.Attention, in)
+		return attn + size(v.Norm1.Gamma, v.Norm1.Beta, v.Norm2.Gamma, v.Norm2.Beta,
+			v.FFN1.W, v.FFN1.B, v.FFN2.W, v.FFN2.B), 0
+	case *Graph:
+		trainable, nonTrainable := 0, 0
+		for _, node := range v.Nodes {
+			t, n := countParams(node.Layer, in)
+			trainable += t
+			nonTrainable += n
+		}
+		return trainable, nonTrainable
+	}
+	return 0, 0
+}
+
+// countMACs は、重みとの積和演算の回数（活性化関数などは数えない）
+func countMACs(l interface{}, in, out []int) int {
+	switch v := l.(type) {
+	case *layer.Affine:
+		return prod(in) * v.W.Columns
+	case *layer.AffineT4D:
+		return prod(in) * v.W.Columns
+	case *layer.DropConnect:
+		return prod(in) * v.W.Columns
+	case *layer.TimeAffine:
+		return prod(in) * v.W.Columns
+	case *layer.Convolution:
+		return prod(out) * len(v.W[0].Flatten())
+	case *layer.Conv2D:
+		return prod(out) * len(v.W[0].Flatten())
+	case *layer.Conv3D:
+		return prod(out) * len(v.W[0].Flatten())
+	case *layer.Conv1D:
+		return prod(out) * len(v.W[0].Vector)
+	case *layer.ConvTranspose2D:
+		return prod(in) * len(v.W[0].Flatten())
+	case *layer.DepthwiseSeparableConv2D:
+		// 1x1のpointwiseは縦横の大きさを変えない
+		dw := v.Depthwise.W
+		return out[0]*len(dw)*out[2]*out[3]*len(dw[0].Flatten()) + prod(out)*len(v.Pointwise.W[0].Flatten())
+	case *layer.TimeRNN:
+		return prod(in[:2]) * (v.Wx.Rows + v.Wh.Rows) * v.Wx.Columns
+	case *layer.TimeLSTM:
+		return prod(in[:2]) * (v.Wx.Rows + v.Wh.Rows) * v.Wx.Columns
+	case *layer.TimeGRU:
+		return prod(in[:2]) * (v.Wx.Rows + v.Wh.Rows) * v.Wx.Columns
+	case *layer.MultiHeadAttention:
+		// 4つの射影とQK^T・重み付き和
+		N, T, D := in[0], in[1], in[2]
+		return 4*N*T*D*D + 2*N*T*T*D
+	case *layer.TransformerEncoder:
+		return countMACs(v.Attention, in, out) + countMACs(v.FFN1, in, nil) + prod(in[:2])*v.FFN2.W.Rows*v.FFN2.W.Columns
+	}
+	return 0
+}
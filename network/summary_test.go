@@ -0,0 +1,142 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/initializer"
+	"github.com/naronA/zero_deeplearning/layer"
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/optimizer"
+)
+
+func TestSimpleConvNetSummary(t *testing.T) {
+	net := NewSimpleConvNet(optimizer.NewAdamAny(0.001),
+		&InputDim{Channel: 1, Height: 8, Weidth: 8},
+		&ConvParams{FilterNum: 4, FilterSize: 3, Pad: 1, Stride: 1},
+		10, 3, 0.01)
+	s, err := net.Summary([]int{2, 1, 8, 8})
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	expected := []struct {
+		shape  string
+		params int
+		macs   int
+	}{
+		{"[2 4 8 8]", 4*9 + 4, 2 * 4 * 8 * 8 * 9}, // Conv1
+		{"[2 4 8 8]", 0, 0},                       // Relu1
+		{"[2 4 4 4]", 0, 0},                       // Pool1
+		{"[2 10]", 64*10 + 10, 2 * 64 * 10},       // Affine1
+		{"[2 10]", 0, 0},                          // Relu2
+		{"[2 3]", 10*3 + 3, 2 * 10 * 3},           // Affine2
+	}
+	for i, e := range expected {
+		l := s.Layers[i]
+		if fmt.Sprint(l.OutputShape) != e.shape || l.TrainableParams != e.params || l.MACs != e.macs {
+			fmt.Println(l, e)
+			t.Fail()
+		}
+	}
+	if s.TrainableParams != 40+650+33 || s.Layers[0].Type != "Convolution" {
+		fmt.Println(s)
+		t.Fail()
+	}
+	if !strings.Contains(s.String(), "Trainable params: 723") {
+		fmt.Println(s)
+		t.Fail()
+	}
+}
+
+func TestSequentialSummary(t *testing.T) {
+	cfg, _ := ReadConfig(strings.NewReader(yamlConfig))
+	net, _ := cfg.Build(optimizer.NewSGD(0.1))
+	s, err := net.Summary([]int{8, 4})
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	// BatchNormalizationの移動平均・移動分散は学習しない
+	if s.TrainableParams != 4*5+5+5*3+3 || s.NonTrainableParams != 2*5 || s.Layers[2].Type != "Tanh" {
+		fmt.Println(s)
+		t.Fail()
+	}
+
+	// 形が合わない層の名前がエラーになる
+	_, err = net.Summary([]int{8, 6})
+	if err == nil || !strings.HasPrefix(err.Error(), "Affine1:") {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestGraphSummary(t *testing.T) {
+	w1, _ := num.NewRandnT4D(3, 2, 3, 3)
+	w2, _ := num.NewRandnT4D(2, 3, 3, 3)
+	block := NewResidualBlock(w1, num.Zeros(1, 3), w2, num.Zeros(1, 2))
+	s, err := block.Summary([]int{1, 2, 5, 5})
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if fmt.Sprint(s.Layers[len(s.Layers)-1].OutputShape) != "[1 2 5 5]" || s.TrainableParams != 54+3+54+2 {
+		fmt.Println(s)
+		t.Fail()
+	}
+
+	// チャンネル数が合わない
+	if _, err := block.Summary([]int{1, 3, 5, 5}); err == nil || !strings.HasPrefix(err.Error(), "Conv1:") {
+		fmt.Println(err)
+		t.Fail()
+	}
+}
+
+func TestSummaryMultiInput(t *testing.T) {
+	w, _ := num.NewRandnMatrix(5, 2)
+	g := NewGraph([]string{"a", "b"}, "Affine").
+		AddNode("Concat", layer.NewConcatenate(), "a", "b").
+		AddNode("Affine", layer.NewAffineT4D(w, num.Zeros(1, 2)), "Concat")
+	s, err := g.Summary([]int{4, 3}, []int{4, 2})
+	if err != nil || fmt.Sprint(s.Layers[0].OutputShape) != "[4 5]" || s.MACs != 4*5*2 {
+		fmt.Println(s, err)
+		t.Fail()
+	}
+}
+
+// TestSummaryKeepsState は、学習の途中でSummaryを呼んでも層の状態が変わらないことを確かめる
+func TestSummaryKeepsState(t *testing.T) {
+	lstm := layer.NewTimeLSTMWithInit(initializer.NewXavierNormal(), 4, 3, true)
+	xs := num.Tensor3D{}
+	for i := 0; i < 2; i++ {
+		x, _ := num.NewRandnMatrix(5, 4)
+		xs = append(xs, x)
+	}
+	lstm.Forward(xs)
+	h, c := lstm.H, num.Mul(1.0, lstm.C)
+	g := NewGraph([]string{"x"}, "LSTM").AddNode("LSTM", lstm, "x")
+	// バッチサイズが違っても形を求められる
+	if s, err := g.Summary([]int{3, 5, 4}); err != nil || fmt.Sprint(s.Layers[0].OutputShape) != "[3 5 3]" {
+		fmt.Println(s, err)
+		t.Fail()
+	}
+	if lstm.H != h || !num.Equal(lstm.C, c) {
+		fmt.Println(lstm.H, h)
+		t.Fail()
+	}
+
+	net := NewSimpleConvNet(optimizer.NewAdamAny(0.001),
+		&InputDim{Channel: 1, Height: 8, Weidth: 8},
+		&ConvParams{FilterNum: 4, FilterSize: 3, Pad: 1, Stride: 1},
+		10, 3, 0.01)
+	x, _ := num.NewRandnT4D(2, 1, 8, 8)
+	net.Predict(x)
+	conv := net.T4DLayers["Conv1"].(*layer.Convolution)
+	col := conv.Col
+	net.Summary([]int{5, 1, 8, 8})
+	if conv.Col != col || len(conv.X) != 2 {
+		fmt.Println(conv.Col.Rows, col.Rows, len(conv.X))
+		t.Fail()
+	}
+}
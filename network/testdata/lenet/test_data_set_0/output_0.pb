@@ -0,0 +1,2 @@
+
+BoutputJRYNA?Tcs75?"sc
\ No newline at end of file
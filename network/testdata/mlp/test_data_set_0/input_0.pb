@@ -0,0 +1,2 @@
+
+BinputJP	ui?	m?ɾu%?rY(@i5?o=Ct꿈)"@"k_?y>?g$.?&>/eT>
\ No newline at end of file
@@ -0,0 +1,2 @@
+
+BoutputJ<>>v9>mH?UB=">-c?5>/w>|>>>=r>R	>>
\ No newline at end of file
@@ -0,0 +1,395 @@
+package npy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// NumPyの.npy形式
+// https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+const magic = "\x93NUMPY"
+
+// Array は、.npyファイルの配列（値はC順）
+type Array struct {
+	Shape []int
+	Data  []float64
+	// 書き出すときの型（"<f8"・"<f4"・"<i8"・"<i4"、省略時は"<f8"）
+	Dtype string
+}
+
+// Read は、.npyを読んでnum.Matrix・num.Tensor3D・num.Tensor4D・num.Tensor5Dにする
+// 0次元・1次元の配列は1行の行列にする
+func Read(r io.Reader) (interface{}, error) {
+	a, err := ReadArray(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Tensor()
+}
+
+// Write は、テンソルを<f8の.npyとして書く
+func Write(w io.Writer, x interface{}) error {
+	a, err := FromTensor(x)
+	if err != nil {
+		return err
+	}
+	return WriteArray(w, a)
+}
+
+// ReadArray は、.npyを読む
+// 浮動小数点数・整数・真偽値の型と、C順・Fortran順に対応する
+func ReadArray(r io.Reader) (*Array, error) {
+	prefix := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(magic)]) != magic {
+		return nil, errors.New("not a .npy file")
+	}
+	var headerLen int
+	switch major := prefix[len(magic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported .npy version %d", major)
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	descr, fortran, shape, err := parseHeader(string(header))
+	if err != nil {
+		return nil, err
+	}
+	_, size, _, err := decoder(descr)
+	if err != nil {
+		return nil, err
+	}
+	n, err := byteCount(shape, size)
+	if err != nil {
+		return nil, err
+	}
+	// ヘッダの形が大きすぎても、実際にあるデータの分しか確保しない
+	raw := &bytes.Buffer{}
+	if _, err := io.CopyN(raw, r, int64(n)); err != nil {
+		return nil, fmt.Errorf("data is truncated: %v", err)
+	}
+	return Decode(descr, fortran, shape, raw.Bytes())
+}
+
+// Decode は、型がdescr（"<f4"など）の値の並びrawをArrayにする
+// pickleしたnumpy.ndarrayなど、.npy以外の形式の配列を読むときに使う
+func Decode(descr string, fortran bool, shape []int, raw []byte) (*Array, error) {
+	decode, size, order, err := decoder(descr)
+	if err != nil {
+		return nil, err
+	}
+	length, err := byteCount(shape, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != length {
+		return nil, fmt.Errorf("shape %v needs %d bytes, got %d", shape, length, len(raw))
+	}
+	data := make([]float64, length/size)
+	for i := range data {
+		data[i] = decode(order, raw[i*size:(i+1)*size])
+	}
+	if fortran {
+		data = fortranToC(data, shape)
+	}
+	return &Array{Shape: shape, Data: data, Dtype: descr}, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// byteCount は、形がshapeで1つsizeバイトの値の並びのバイト数
+// 負の次元や、intに収まらない大きさはエラーにする
+func byteCount(shape []int, size int) (int, error) {
+	n := size
+	for _, s := range shape {
+		if s < 0 {
+			return 0, fmt.Errorf("invalid shape %v", shape)
+		}
+		if s != 0 && n > maxInt/s {
+			return 0, fmt.Errorf("shape %v is too large", shape)
+		}
+		n *= s
+	}
+	return n, nil
+}
+
+var (
+	descrPattern   = regexp.MustCompile(`'descr'\s*:\s*'([^']*)'`)
+	fortranPattern = regexp.MustCompile(`'fortran_order'\s*:\s*(True|False)`)
+	shapePattern   = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+)
+
+// parseHeader は、ヘッダのPythonの辞書を読む
+// 例: {'descr': '<f8', 'fortran_order': False, 'shape': (2, 3), }
+func parseHeader(header string) (string, bool, []int, error) {
+	descr := descrPattern.FindStringSubmatch(header)
+	fortran := fortranPattern.FindStringSubmatch(header)
+	shape := shapePattern.FindStringSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil {
+		return "", false, nil, fmt.Errorf("invalid .npy header %q", header)
+	}
+	dims := []int{}
+	for _, s := range strings.Split(shape[1], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		d, err := strconv.Atoi(strings.TrimSuffix(s, "L"))
+		if err != nil {
+			return "", false, nil, fmt.Errorf("invalid shape %q", shape[1])
+		}
+		dims = append(dims, d)
+	}
+	return descr[1], fortran[1] == "True", dims, nil
+}
+
+// decoder は、型の文字列（"<f4"など）に対応する値の読み方とバイト数
+func decoder(descr string) (func(binary.ByteOrder, []byte) float64, int, binary.ByteOrder, error) {
+	if len(descr) < 3 {
+		return nil, 0, nil, fmt.Errorf("unsupported dtype %q", descr)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if descr[0] == '>' {
+		order = binary.BigEndian
+	}
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("unsupported dtype %q", descr)
+	}
+	switch descr[1:] {
+	case "f4":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(math.Float32frombits(o.Uint32(b))) }, size, order, nil
+	case "f8":
+		return func(o binary.ByteOrder, b []byte) float64 { return math.Float64frombits(o.Uint64(b)) }, size, order, nil
+	case "i1":
+		return func(_ binary.ByteOrder, b []byte) float64 { return float64(int8(b[0])) }, size, order, nil
+	case "i2":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(int16(o.Uint16(b))) }, size, order, nil
+	case "i4":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(int32(o.Uint32(b))) }, size, order, nil
+	case "i8":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(int64(o.Uint64(b))) }, size, order, nil
+	case "u1", "b1":
+		return func(_ binary.ByteOrder, b []byte) float64 { return float64(b[0]) }, size, order, nil
+	case "u2":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(o.Uint16(b)) }, size, order, nil
+	case "u4":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(o.Uint32(b)) }, size, order, nil
+	case "u8":
+		return func(o binary.ByteOrder, b []byte) float64 { return float64(o.Uint64(b)) }, size, order, nil
+	}
+	return nil, 0, nil, fmt.Errorf("unsupported dtype %q", descr)
+}
+
+// fortranToC は、Fortran順（最初の軸が最も速く変わる）の値をC順に並べ替える
+func fortranToC(data []float64, shape []int) []float64 {
+	out := make([]float64, len(data))
+	index := make([]int, len(shape))
+	for i := range out {
+		offset, stride := 0, 1
+		for k, s := range shape {
+			offset += index[k] * stride
+			stride *= s
+		}
+		out[i] = data[offset]
+		// C順で次の位置へ
+		for k := len(shape) - 1; k >= 0; k-- {
+			index[k]++
+			if index[k] < shape[k] {
+				break
+			}
+			index[k] = 0
+		}
+	}
+	return out
+}
+
+// WriteArray は、aをバージョン1.0の.npyとして書く
+func WriteArray(w io.Writer, a *Array) error {
+	dtype := a.Dtype
+	if dtype == "" {
+		dtype = "<f8"
+	}
+	var encode func([]byte, float64)
+	var size int
+	switch dtype {
+	case "<f8":
+		size, encode = 8, func(b []byte, v float64) { binary.LittleEndian.PutUint64(b, math.Float64bits(v)) }
+	case "<f4":
+		size, encode = 4, func(b []byte, v float64) { binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v))) }
+	case "<i8":
+		size, encode = 8, func(b []byte, v float64) { binary.LittleEndian.PutUint64(b, uint64(int64(v))) }
+	case "<i4":
+		size, encode = 4, func(b []byte, v float64) { binary.LittleEndian.PutUint32(b, uint32(int32(v))) }
+	default:
+		return fmt.Errorf("unsupported dtype %q", dtype)
+	}
+
+	dims := make([]string, len(a.Shape))
+	n := 1
+	for i, s := range a.Shape {
+		dims[i] = strconv.Itoa(s)
+		n *= s
+	}
+	if n != len(a.Data) {
+		return fmt.Errorf("shape %v does not match %d values", a.Shape, len(a.Data))
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", dtype, shape)
+	// NumPyと同じく、データの先頭が64バイト境界になるように空白で埋めて改行で終える
+	total := len(magic) + 4 + len(header) + 1
+	header += strings.Repeat(" ", (64-total%64)%64) + "\n"
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(magic)
+	buf.Write([]byte{1, 0})
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	b := make([]byte, size)
+	for _, v := range a.Data {
+		encode(b, v)
+		buf.Write(b)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadNpz は、.npz（.npyのzip）を読む（キーは".npy"を除いた名前）
+func ReadNpz(r io.ReaderAt, size int64) (map[string]*Array, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	arrays := map[string]*Array{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		a, err := ReadArray(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		arrays[strings.TrimSuffix(f.Name, ".npy")] = a
+	}
+	return arrays, nil
+}
+
+// WriteNpz は、numpy.savezと同じく圧縮せずに.npzを書く
+func WriteNpz(w io.Writer, arrays map[string]*Array) error {
+	names := make([]string, 0, len(arrays))
+	for name := range arrays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	z := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: name + ".npy", Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if err := WriteArray(f, arrays[name]); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return z.Close()
+}
+
+// FromTensor は、*num.Matrix・num.Tensor3D・num.Tensor4D・num.Tensor5DをArrayにする
+func FromTensor(x interface{}) (*Array, error) {
+	switch v := x.(type) {
+	case *num.Matrix:
+		return &Array{Shape: []int{v.Rows, v.Columns}, Data: append([]float64{}, v.Vector...)}, nil
+	case num.Tensor3D:
+		if len(v) == 0 {
+			return &Array{Shape: []int{0, 0, 0}}, nil
+		}
+		return &Array{Shape: []int{len(v), v[0].Rows, v[0].Columns}, Data: v.Flatten()}, nil
+	case num.Tensor4D:
+		if len(v) == 0 || len(v[0]) == 0 {
+			return &Array{Shape: []int{len(v), 0, 0, 0}}, nil
+		}
+		m := v[0][0]
+		return &Array{Shape: []int{len(v), len(v[0]), m.Rows, m.Columns}, Data: v.Flatten()}, nil
+	case num.Tensor5D:
+		if len(v) == 0 || len(v[0]) == 0 || len(v[0][0]) == 0 {
+			return &Array{Shape: []int{len(v), 0, 0, 0, 0}}, nil
+		}
+		m := v[0][0][0]
+		return &Array{Shape: []int{len(v), len(v[0]), len(v[0][0]), m.Rows, m.Columns}, Data: v.Flatten()}, nil
+	}
+	return nil, fmt.Errorf("unsupported tensor %T", x)
+}
+
+// Tensor は、階数に応じて*num.Matrix・num.Tensor3D・num.Tensor4D・num.Tensor5Dにする
+// 0次元・1次元の配列は1行の行列にする
+func (a *Array) Tensor() (interface{}, error) {
+	data := a.Data
+	matrix := func(rows, cols int) *num.Matrix {
+		m := &num.Matrix{Vector: append([]float64{}, data[:rows*cols]...), Rows: rows, Columns: cols}
+		data = data[rows*cols:]
+		return m
+	}
+	t3d := func(c, h, w int) num.Tensor3D {
+		t := make(num.Tensor3D, c)
+		for i := range t {
+			t[i] = matrix(h, w)
+		}
+		return t
+	}
+	t4d := func(n, c, h, w int) num.Tensor4D {
+		t := make(num.Tensor4D, n)
+		for i := range t {
+			t[i] = t3d(c, h, w)
+		}
+		return t
+	}
+	s := a.Shape
+	switch len(s) {
+	case 0:
+		return matrix(1, 1), nil
+	case 1:
+		return matrix(1, s[0]), nil
+	case 2:
+		return matrix(s[0], s[1]), nil
+	case 3:
+		return t3d(s[0], s[1], s[2]), nil
+	case 4:
+		return t4d(s[0], s[1], s[2], s[3]), nil
+	case 5:
+		t := make(num.Tensor5D, s[0])
+		for i := range t {
+			t[i] = t4d(s[1], s[2], s[3], s[4])
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported rank %d", len(s))
+}
@@ -0,0 +1,167 @@
+package npy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+// npyFile は、ヘッダと値からバージョン1.0の.npyを作る
+func npyFile(header string, values interface{}) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(magic)
+	buf.Write([]byte{1, 0})
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	binary.Write(buf, binary.LittleEndian, values)
+	return buf.Bytes()
+}
+
+func TestReadArray(t *testing.T) {
+	cases := []struct {
+		file  []byte
+		shape []int
+		data  []float64
+	}{
+		// np.arange(6, dtype=np.float32).reshape(2, 3)
+		{npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }\n", []float32{0, 1, 2, 3, 4, 5}),
+			[]int{2, 3}, []float64{0, 1, 2, 3, 4, 5}},
+		// np.asfortranarray(np.arange(6).reshape(2, 3))
+		{npyFile("{'descr': '<i8', 'fortran_order': True, 'shape': (2, 3), }\n", []int64{0, 3, 1, 4, 2, 5}),
+			[]int{2, 3}, []float64{0, 1, 2, 3, 4, 5}},
+		// np.array([-1, 2], dtype='<i4')
+		{npyFile("{'descr': '<i4', 'fortran_order': False, 'shape': (2,), }\n", []int32{-1, 2}),
+			[]int{2}, []float64{-1, 2}},
+		// np.array(3.5)
+		{npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (), }\n", []float64{3.5}),
+			[]int{}, []float64{3.5}},
+		// Fortran順の3次元
+		{npyFile("{'descr': '<f8', 'fortran_order': True, 'shape': (2, 2, 2), }\n", []float64{0, 4, 2, 6, 1, 5, 3, 7}),
+			[]int{2, 2, 2}, []float64{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	for i, c := range cases {
+		a, err := ReadArray(bytes.NewReader(c.file))
+		if err != nil {
+			fmt.Println(i, err)
+			t.Fail()
+			continue
+		}
+		if !reflect.DeepEqual(a.Shape, c.shape) || !reflect.DeepEqual(a.Data, c.data) {
+			fmt.Println(i, a.Shape, a.Data)
+			t.Fail()
+		}
+	}
+
+	// ビッグエンディアン
+	buf := &bytes.Buffer{}
+	buf.WriteString(magic)
+	buf.Write([]byte{1, 0})
+	header := "{'descr': '>f8', 'fortran_order': False, 'shape': (1,), }\n"
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	binary.Write(buf, binary.BigEndian, math.Pi)
+	if a, err := ReadArray(buf); err != nil || a.Data[0] != math.Pi {
+		fmt.Println(a, err)
+		t.Fail()
+	}
+}
+
+func TestReadArrayErrors(t *testing.T) {
+	files := map[string][]byte{
+		"magic":     []byte("NUMPY"),
+		"dtype":     npyFile("{'descr': '<U3', 'fortran_order': False, 'shape': (1,), }\n", []int32{0, 0, 0}),
+		"truncated": npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (3,), }\n", []float64{1, 2}),
+		"negative":  npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (-1, -2), }\n", []float64{1, 2}),
+		"overflow":  npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (4294967296, 4294967296), }\n", []float64{1, 2}),
+		"huge":      npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (1000000000, 1000), }\n", []float64{1, 2}),
+	}
+	for name, f := range files {
+		if _, err := ReadArray(bytes.NewReader(f)); err == nil {
+			fmt.Println(name)
+			t.Fail()
+		}
+	}
+}
+
+func TestWriteArray(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteArray(buf, &Array{Shape: []int{2}, Data: []float64{1, 2}}); err != nil {
+		t.FailNow()
+	}
+	// np.save(f, np.array([1.0, 2.0]))と同じバイト列
+	// ヘッダは118バイト
+	dict := "{'descr': '<f8', 'fortran_order': False, 'shape': (2,), }"
+	expected := npyFile(dict+strings.Repeat(" ", 117-len(dict))+"\n", []float64{1, 2})
+	if !bytes.Equal(buf.Bytes(), expected) {
+		fmt.Printf("%q\n%q\n", buf.Bytes(), expected)
+		t.Fail()
+	}
+	if (buf.Len()-16)%64 != 0 {
+		fmt.Println(buf.Len())
+		t.Fail()
+	}
+
+	buf.Reset()
+	WriteArray(buf, &Array{Shape: []int{1, 2}, Data: []float64{-1.5, 7}, Dtype: "<f4"})
+	a, _ := ReadArray(buf)
+	if a.Dtype != "<f4" || !reflect.DeepEqual(a.Data, []float64{-1.5, 7}) {
+		fmt.Println(a)
+		t.Fail()
+	}
+}
+
+func TestTensorRoundTrip(t *testing.T) {
+	m, _ := num.NewRandnMatrix(3, 4)
+	t3d, _ := num.NewRandnT3D(2, 3, 4)
+	t4d, _ := num.NewRandnT4D(2, 3, 1, 4)
+	t5d := num.Tensor5D{t4d, t4d}
+	for _, x := range []interface{}{m, t3d, t4d, t5d} {
+		buf := &bytes.Buffer{}
+		if err := Write(buf, x); err != nil {
+			fmt.Println(err)
+			t.Fail()
+			continue
+		}
+		y, err := Read(buf)
+		if err != nil || !reflect.DeepEqual(x, y) {
+			fmt.Println(x, y, err)
+			t.Fail()
+		}
+	}
+
+	// 1次元の配列は1行の行列
+	a := &Array{Shape: []int{3}, Data: []float64{1, 2, 3}}
+	x, _ := a.Tensor()
+	if !num.Equal(x.(*num.Matrix), &num.Matrix{Vector: vec.Vector{1, 2, 3}, Rows: 1, Columns: 3}) {
+		fmt.Println(x)
+		t.Fail()
+	}
+}
+
+func TestNpz(t *testing.T) {
+	arrays := map[string]*Array{
+		"W1": {Shape: []int{2, 2}, Data: []float64{1, 2, 3, 4}, Dtype: "<f8"},
+		"b1": {Shape: []int{2}, Data: []float64{5, 6}, Dtype: "<f4"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteNpz(buf, arrays); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	loaded, err := ReadNpz(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(loaded, arrays) {
+		fmt.Println(loaded)
+		t.Fail()
+	}
+}
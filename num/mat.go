@@ -119,8 +119,8 @@ func (m *Matrix) Ndim() int {
 }
 
 func (m *Matrix) Reshape(row, col int) *Matrix {
-	r, c := m.Shape()
-	size := r * c
+	// Shapeは1行の行列で(Columns, -1)を返すので使わない
+	size := m.Rows * m.Columns
 	if row == -1 {
 		row = size / col
 	} else if col == -1 {
@@ -138,8 +138,7 @@ func (m *Matrix) Reshape(row, col int) *Matrix {
 }
 
 func (m *Matrix) ReshapeTo4D(a, b, c, d int) Tensor4D {
-	row, col := m.Shape()
-	size := row * col
+	size := m.Rows * m.Columns
 
 	if a == -1 {
 		a = int(size / b / c / d)
@@ -166,8 +165,7 @@ func (m *Matrix) ReshapeTo4D(a, b, c, d int) Tensor4D {
 }
 
 func (m *Matrix) ReshapeTo5D(a, b, c, d, e int) Tensor5D {
-	row, col := m.Shape()
-	size := row * col
+	size := m.Rows * m.Columns
 
 	if a == -1 {
 		a = int(size / b / c / d / e)
@@ -188,8 +186,8 @@ func (m *Matrix) ReshapeTo5D(a, b, c, d, e int) Tensor5D {
 				sv := m.Vector[((i*b+j)*c+k)*d*e : ((i*b+j)*c+k+1)*d*e]
 				t5d[i][j][k] = &Matrix{
 					Vector:  sv,
-					Rows:    c,
-					Columns: d,
+					Rows:    d,
+					Columns: e,
 				}
 			}
 		}
@@ -268,6 +266,38 @@ func (m *Matrix) Col2Img(shape []int, fh, fw, stride, pad int) Tensor4D {
 	return img.Slice(pad, H+pad, pad, W+pad)
 }
 
+// Col2ImgWithParams は、Im2ColWithParamsの逆変換
+// 重なった窓の値は足し合わせ、パディング部分は捨てる
+func (m *Matrix) Col2ImgWithParams(shape []int, p *Conv2DParams) Tensor4D {
+	N, C, H, W := shape[0], shape[1], shape[2], shape[3]
+	outH, outW := p.OutputSize(H, W)
+	cols := C * p.FH * p.FW
+	img := ZerosT4D(N, C, H, W)
+	for n, t3d := range img {
+		for oh := 0; oh < outH; oh++ {
+			for ow := 0; ow < outW; ow++ {
+				row := m.Vector[((n*outH+oh)*outW+ow)*cols:]
+				for c, mat := range t3d {
+					for kh := 0; kh < p.FH; kh++ {
+						ih := oh*p.StrideH - p.PadTop + kh*p.DilationH
+						if ih < 0 || ih >= H {
+							continue
+						}
+						for kw := 0; kw < p.FW; kw++ {
+							iw := ow*p.StrideW - p.PadLeft + kw*p.DilationW
+							if iw < 0 || iw >= W {
+								continue
+							}
+							mat.Vector[ih*W+iw] += row[(c*p.FH+kh)*p.FW+kw]
+						}
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
 func Zeros(rows int, cols int) *Matrix {
 	zeros := vec.Zeros(rows * cols)
 	return &Matrix{
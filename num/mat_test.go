@@ -180,3 +180,31 @@ func TestCrossEntropyError1(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// TestOneRowShape は、1行の行列のReshape・テンソルのShape
+// 1行の行列のShapeは(Columns, -1)を返すが、テンソルの形には行数・列数を使う
+func TestOneRowShape(t *testing.T) {
+	m, _ := NewMatrix(1, 4, vec.Vector{1, 2, 3, 4})
+	if r := m.Reshape(2, -1); r.Rows != 2 || r.Columns != 2 {
+		fmt.Println(r.Rows, r.Columns)
+		t.Fail()
+	}
+	t4d := m.ReshapeTo4D(1, 1, 1, -1)
+	if n, c, h, w := t4d.Shape(); fmt.Sprint(n, c, h, w) != "1 1 1 4" {
+		fmt.Println(n, c, h, w)
+		t.Fail()
+	}
+	if c, h, w := t4d[0].Shape(); fmt.Sprint(c, h, w) != "1 1 4" {
+		fmt.Println(c, h, w)
+		t.Fail()
+	}
+	t5d := Tensor5D{t4d}
+	if a, b, c, d, e := t5d.Shape(); fmt.Sprint(a, b, c, d, e) != "1 1 1 1 4" {
+		fmt.Println(a, b, c, d, e)
+		t.Fail()
+	}
+	if a, b, n, c, h, w := (Tensor6D{t5d}).Shape(); fmt.Sprint(a, b, n, c, h, w) != "1 1 1 1 1 4" {
+		fmt.Println(a, b, n, c, h, w)
+		t.Fail()
+	}
+}
@@ -0,0 +1,117 @@
+package num
+
+type PadMode int
+
+const (
+	CONSTANTPAD  PadMode = iota // Valueで埋める
+	REFLECTPAD                  // 端を軸に折り返す（端の値は繰り返さない）
+	REPLICATEPAD                // 端の値を繰り返す
+	CIRCULARPAD                 // 反対側から回り込む
+)
+
+// Padding は、上下左右それぞれの幅とモードを指定するパディング
+type Padding struct {
+	Top    int
+	Bottom int
+	Left   int
+	Right  int
+	Mode   PadMode
+	Value  float64 // CONSTANTPADの値
+}
+
+// sourceIndex は、パディング後の位置iに対応する長さnの元データの位置
+// CONSTANTPADのパディング部分は-1
+func (mode PadMode) sourceIndex(i, n int) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch mode {
+	case REFLECTPAD:
+		if n == 1 {
+			return 0
+		}
+		period := 2 * (n - 1)
+		i = (i%period + period) % period
+		if i >= n {
+			i = period - i
+		}
+		return i
+	case REPLICATEPAD:
+		if i < 0 {
+			return 0
+		}
+		return n - 1
+	case CIRCULARPAD:
+		return (i%n + n) % n
+	}
+	return -1
+}
+
+func (m *Matrix) PadWith(p *Padding) *Matrix {
+	rows := m.Rows + p.Top + p.Bottom
+	cols := m.Columns + p.Left + p.Right
+	padded := Zeros(rows, cols)
+	for i := 0; i < rows; i++ {
+		si := p.Mode.sourceIndex(i-p.Top, m.Rows)
+		for j := 0; j < cols; j++ {
+			sj := p.Mode.sourceIndex(j-p.Left, m.Columns)
+			if si < 0 || sj < 0 {
+				padded.Vector[i*cols+j] = p.Value
+				continue
+			}
+			padded.Vector[i*cols+j] = m.Vector[si*m.Columns+sj]
+		}
+	}
+	return padded
+}
+
+// UnpadWith は、PadWithの逆伝搬
+// パディング部分の勾配を、値の取り出し元の位置に足し込む
+func (m *Matrix) UnpadWith(p *Padding) *Matrix {
+	rows := m.Rows - p.Top - p.Bottom
+	cols := m.Columns - p.Left - p.Right
+	grad := Zeros(rows, cols)
+	for i := 0; i < m.Rows; i++ {
+		si := p.Mode.sourceIndex(i-p.Top, rows)
+		for j := 0; j < m.Columns; j++ {
+			sj := p.Mode.sourceIndex(j-p.Left, cols)
+			if si < 0 || sj < 0 {
+				continue
+			}
+			grad.Vector[si*cols+sj] += m.Vector[i*m.Columns+j]
+		}
+	}
+	return grad
+}
+
+func (t Tensor3D) PadWith(p *Padding) Tensor3D {
+	padded := make(Tensor3D, len(t))
+	for i, m := range t {
+		padded[i] = m.PadWith(p)
+	}
+	return padded
+}
+
+func (t Tensor3D) UnpadWith(p *Padding) Tensor3D {
+	grad := make(Tensor3D, len(t))
+	for i, m := range t {
+		grad[i] = m.UnpadWith(p)
+	}
+	return grad
+}
+
+func (t Tensor4D) PadWith(p *Padding) Tensor4D {
+	padded := make(Tensor4D, len(t))
+	for i, t3d := range t {
+		padded[i] = t3d.PadWith(p)
+	}
+	return padded
+}
+
+func (t Tensor4D) UnpadWith(p *Padding) Tensor4D {
+	grad := make(Tensor4D, len(t))
+	for i, t3d := range t {
+		grad[i] = t3d.UnpadWith(p)
+	}
+	return grad
+}
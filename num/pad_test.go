@@ -0,0 +1,75 @@
+package num
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/vec"
+)
+
+func TestPadWith(t *testing.T) {
+	m, _ := NewMatrix(2, 3, vec.Vector{
+		1, 2, 3,
+		4, 5, 6,
+	})
+	cases := []struct {
+		mode     PadMode
+		expected vec.Vector
+	}{
+		{CONSTANTPAD, vec.Vector{
+			9, 9, 9, 9, 9, 9,
+			9, 9, 1, 2, 3, 9,
+			9, 9, 4, 5, 6, 9,
+		}},
+		{REFLECTPAD, vec.Vector{
+			6, 5, 4, 5, 6, 5,
+			3, 2, 1, 2, 3, 2,
+			6, 5, 4, 5, 6, 5,
+		}},
+		{REPLICATEPAD, vec.Vector{
+			1, 1, 1, 2, 3, 3,
+			1, 1, 1, 2, 3, 3,
+			4, 4, 4, 5, 6, 6,
+		}},
+		{CIRCULARPAD, vec.Vector{
+			5, 6, 4, 5, 6, 4,
+			2, 3, 1, 2, 3, 1,
+			5, 6, 4, 5, 6, 4,
+		}},
+	}
+	for _, c := range cases {
+		p := &Padding{Top: 1, Left: 2, Right: 1, Mode: c.mode, Value: 9}
+		actual := m.PadWith(p)
+		expected, _ := NewMatrix(3, 6, c.expected)
+		if NotEqual(actual, expected) {
+			fmt.Println(c.mode, actual, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpadWith(t *testing.T) {
+	// 逆伝搬では、各位置が何回使われたかを数えることになる
+	ones := Add(Zeros(3, 6), 1.0)
+	p := &Padding{Top: 1, Left: 2, Right: 1, Mode: REPLICATEPAD}
+	actual := ones.UnpadWith(p)
+	expected, _ := NewMatrix(2, 3, vec.Vector{
+		6, 2, 4,
+		3, 1, 2,
+	})
+	if NotEqual(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+
+	p.Mode = CONSTANTPAD
+	actual = ones.UnpadWith(p)
+	expected, _ = NewMatrix(2, 3, vec.Vector{
+		1, 1, 1,
+		1, 1, 1,
+	})
+	if NotEqual(actual, expected) {
+		fmt.Println(actual, expected)
+		t.Fail()
+	}
+}
@@ -28,7 +28,7 @@ func (t Tensor3D) Assign(value float64, c, h, w int) {
 
 func (t Tensor3D) Shape() (int, int, int) {
 	C := t.Channels()
-	H, W := t[0].Shape()
+	H, W := t[0].Rows, t[0].Columns
 	return C, H, W
 }
 
@@ -85,7 +85,7 @@ func (t Tensor4D) Pad(size int) Tensor4D {
 func (t Tensor4D) Shape() (int, int, int, int) {
 	N := len(t)
 	C := t[0].Channels()
-	H, W := t[0][0].Shape()
+	H, W := t[0][0].Rows, t[0][0].Columns
 	return N, C, H, W
 }
 
@@ -227,6 +227,59 @@ func (t Tensor4D) Im2Col(fw, fh, stride, pad int) *Matrix {
 	}
 }
 
+// Conv2DParams は、Im2ColWithParams/Col2ImgWithParamsの窓の設定
+// Stride, Dilationは1以上、Padは上下左右それぞれのゼロパディング幅
+type Conv2DParams struct {
+	FH        int
+	FW        int
+	StrideH   int
+	StrideW   int
+	PadTop    int
+	PadBottom int
+	PadLeft   int
+	PadRight  int
+	DilationH int
+	DilationW int
+}
+
+func (p *Conv2DParams) OutputSize(h, w int) (int, int) {
+	outH := (h+p.PadTop+p.PadBottom-p.DilationH*(p.FH-1)-1)/p.StrideH + 1
+	outW := (w+p.PadLeft+p.PadRight-p.DilationW*(p.FW-1)-1)/p.StrideW + 1
+	return outH, outW
+}
+
+// Im2ColWithParams は、(N, C, H, W)を(N*OH*OW, C*FH*FW)の行列に展開する
+// 非正方形のフィルタ・ストライド、非対称なパディング、dilationに対応する
+func (t Tensor4D) Im2ColWithParams(p *Conv2DParams) *Matrix {
+	N, C, H, W := len(t), len(t[0]), t[0][0].Rows, t[0][0].Columns
+	outH, outW := p.OutputSize(H, W)
+	cols := C * p.FH * p.FW
+	col := Zeros(N*outH*outW, cols)
+	for n, t3d := range t {
+		for oh := 0; oh < outH; oh++ {
+			for ow := 0; ow < outW; ow++ {
+				row := col.Vector[((n*outH+oh)*outW+ow)*cols:]
+				for c, mat := range t3d {
+					for kh := 0; kh < p.FH; kh++ {
+						ih := oh*p.StrideH - p.PadTop + kh*p.DilationH
+						if ih < 0 || ih >= H {
+							continue
+						}
+						for kw := 0; kw < p.FW; kw++ {
+							iw := ow*p.StrideW - p.PadLeft + kw*p.DilationW
+							if iw < 0 || iw >= W {
+								continue
+							}
+							row[(c*p.FH+kh)*p.FW+kw] = mat.Vector[ih*W+iw]
+						}
+					}
+				}
+			}
+		}
+	}
+	return col
+}
+
 func NewRandnT4D(n, c, h, w int) (Tensor4D, error) {
 	if n == 0 || c == 0 || h == 0 || w == 0 {
 		return nil, errors.New("row/columns is zero")
@@ -69,3 +69,47 @@ func TestReshape(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestIm2ColWithParams(t *testing.T) {
+	t4d := SmapleT4D()
+	p := &Conv2DParams{
+		FH: 2, FW: 2,
+		StrideH: 2, StrideW: 2,
+		PadTop: 1, PadBottom: 1, PadLeft: 1, PadRight: 1,
+		DilationH: 1, DilationW: 1,
+	}
+	actual := t4d.Im2ColWithParams(p)
+	expected := t4d.Im2Col(2, 2, 2, 1).Reshape(-1, 8)
+	if NotEqual(expected, actual) {
+		fmt.Println(expected, actual)
+		t.Fail()
+	}
+
+	img := actual.Col2ImgWithParams([]int{2, 2, 2, 2}, p)
+	if !EqualT4D(img, t4d) {
+		fmt.Println(img, t4d)
+		t.Fail()
+	}
+}
+
+func TestIm2ColWithParamsDilation(t *testing.T) {
+	mat := &Matrix{Vector: vec.Vector{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+	}, Rows: 3, Columns: 4}
+	p := &Conv2DParams{
+		FH: 2, FW: 2,
+		StrideH: 1, StrideW: 2,
+		DilationH: 2, DilationW: 1,
+	}
+	actual := Tensor4D{Tensor3D{mat}}.Im2ColWithParams(p)
+	expected := &Matrix{Vector: vec.Vector{
+		1, 2, 9, 10,
+		3, 4, 11, 12,
+	}, Rows: 2, Columns: 4}
+	if NotEqual(expected, actual) {
+		fmt.Println(expected, actual)
+		t.Fail()
+	}
+}
@@ -23,7 +23,7 @@ func (t Tensor5D) Shape() (int, int, int, int, int) {
 	a := len(t)
 	b := len(t[0])
 	c := len(t[0][0])
-	d, e := t[0][0][0].Shape()
+	d, e := t[0][0][0].Rows, t[0][0][0].Columns
 	return a, b, c, d, e
 
 }
@@ -68,3 +68,100 @@ func EqualT5D(t1, t2 Tensor5D) bool {
 	}
 	return true
 }
+
+// Conv3DParams は、Im2Col3D/Col2Img3Dの窓の設定
+// Stride, Dilationは1以上、Padは前後・上下・左右に同じ幅のゼロパディング
+type Conv3DParams struct {
+	FD        int
+	FH        int
+	FW        int
+	StrideD   int
+	StrideH   int
+	StrideW   int
+	PadD      int
+	PadH      int
+	PadW      int
+	DilationD int
+	DilationH int
+	DilationW int
+}
+
+func (p *Conv3DParams) OutputSize(d, h, w int) (int, int, int) {
+	outD := (d+2*p.PadD-p.DilationD*(p.FD-1)-1)/p.StrideD + 1
+	outH := (h+2*p.PadH-p.DilationH*(p.FH-1)-1)/p.StrideH + 1
+	outW := (w+2*p.PadW-p.DilationW*(p.FW-1)-1)/p.StrideW + 1
+	return outD, outH, outW
+}
+
+// window3D は、出力(od, oh, ow)の窓の各要素について、入力のd*H*W+h*W+wの位置を呼ぶ
+// パディング部分はスキップする
+func (p *Conv3DParams) window3D(d, h, w, od, oh, ow int, f func(k, i int)) {
+	for kd := 0; kd < p.FD; kd++ {
+		id := od*p.StrideD - p.PadD + kd*p.DilationD
+		if id < 0 || id >= d {
+			continue
+		}
+		for kh := 0; kh < p.FH; kh++ {
+			ih := oh*p.StrideH - p.PadH + kh*p.DilationH
+			if ih < 0 || ih >= h {
+				continue
+			}
+			for kw := 0; kw < p.FW; kw++ {
+				iw := ow*p.StrideW - p.PadW + kw*p.DilationW
+				if iw < 0 || iw >= w {
+					continue
+				}
+				f((kd*p.FH+kh)*p.FW+kw, (id*h+ih)*w+iw)
+			}
+		}
+	}
+}
+
+// Im2Col3D は、(N, C, D, H, W)を(N*OD*OH*OW, C*FD*FH*FW)の行列に展開する
+func (t Tensor5D) Im2Col3D(p *Conv3DParams) *Matrix {
+	N, C, D, H, W := len(t), len(t[0]), len(t[0][0]), t[0][0][0].Rows, t[0][0][0].Columns
+	outD, outH, outW := p.OutputSize(D, H, W)
+	k := p.FD * p.FH * p.FW
+	cols := C * k
+	col := Zeros(N*outD*outH*outW, cols)
+	for n, t4d := range t {
+		for od := 0; od < outD; od++ {
+			for oh := 0; oh < outH; oh++ {
+				for ow := 0; ow < outW; ow++ {
+					row := col.Vector[(((n*outD+od)*outH+oh)*outW+ow)*cols:]
+					for c, t3d := range t4d {
+						p.window3D(D, H, W, od, oh, ow, func(j, i int) {
+							row[c*k+j] = t3d[i/(H*W)].Vector[i%(H*W)]
+						})
+					}
+				}
+			}
+		}
+	}
+	return col
+}
+
+// Col2Img3D は、Im2Col3Dの逆変換
+// 重なった窓の値は足し合わせ、パディング部分は捨てる
+func (m *Matrix) Col2Img3D(shape []int, p *Conv3DParams) Tensor5D {
+	N, C, D, H, W := shape[0], shape[1], shape[2], shape[3], shape[4]
+	outD, outH, outW := p.OutputSize(D, H, W)
+	k := p.FD * p.FH * p.FW
+	cols := C * k
+	img := ZerosT5D(N, C, D, H, W)
+	for n, t4d := range img {
+		for od := 0; od < outD; od++ {
+			for oh := 0; oh < outH; oh++ {
+				for ow := 0; ow < outW; ow++ {
+					row := m.Vector[(((n*outD+od)*outH+oh)*outW+ow)*cols:]
+					for c, t3d := range t4d {
+						p.window3D(D, H, W, od, oh, ow, func(j, i int) {
+							t3d[i/(H*W)].Vector[i%(H*W)] += row[c*k+j]
+						})
+					}
+				}
+			}
+		}
+	}
+	return img
+}
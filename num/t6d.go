@@ -5,7 +5,7 @@ func (t Tensor6D) Shape() (int, int, int, int, int, int) {
 	B := len(t[0])
 	N := len(t[0][0])
 	C := t[0][0][0].Channels()
-	H, W := t[0][0][0][0].Shape()
+	H, W := t[0][0][0][0].Rows, t[0][0][0][0].Columns
 	return A, B, N, C, H, W
 }
 
@@ -0,0 +1,540 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// ONNXのモデルファイル（onnx.protoのModelProto）のうち、推論に必要な部分
+// https://github.com/onnx/onnx/blob/main/onnx/onnx.proto
+// フィールド番号はonnx.protoに合わせる
+
+// TensorProto.DataType
+const (
+	FLOAT  = 1
+	INT32  = 6
+	INT64  = 7
+	DOUBLE = 11
+)
+
+// AttributeProto.AttributeType
+type AttributeType int32
+
+const (
+	AttrFloat   AttributeType = 1
+	AttrInt     AttributeType = 2
+	AttrString  AttributeType = 3
+	AttrTensor  AttributeType = 4
+	AttrFloats  AttributeType = 6
+	AttrInts    AttributeType = 7
+	AttrStrings AttributeType = 8
+)
+
+const (
+	// IRVersion は、書き出すモデルのIRのバージョン（ONNX 1.8）
+	IRVersion = 7
+	// OpsetVersion は、書き出すモデルの既定のドメインの演算子セットのバージョン
+	OpsetVersion = 13
+)
+
+type Model struct {
+	IRVersion       int64
+	OpsetImports    []*OpsetID
+	ProducerName    string
+	ProducerVersion string
+	Domain          string
+	ModelVersion    int64
+	DocString       string
+	Graph           *Graph
+}
+
+type OpsetID struct {
+	Domain  string // ""は既定のドメイン（ai.onnx）
+	Version int64
+}
+
+type Graph struct {
+	Name         string
+	Nodes        []*Node
+	Initializers []*Tensor
+	DocString    string
+	Inputs       []*ValueInfo
+	Outputs      []*ValueInfo
+	ValueInfo    []*ValueInfo
+}
+
+type Node struct {
+	Inputs     []string
+	Outputs    []string
+	Name       string
+	OpType     string
+	Domain     string
+	Attributes []*Attribute
+	DocString  string
+}
+
+type Attribute struct {
+	Name    string
+	Type    AttributeType
+	F       float32
+	I       int64
+	S       string
+	T       *Tensor
+	Floats  []float32
+	Ints    []int64
+	Strings []string
+}
+
+// Tensor は、値をfloat64で持つ（書き出すときはDataTypeの型にする）
+type Tensor struct {
+	Name     string
+	Dims     []int64
+	DataType int32
+	Data     []float64
+}
+
+// ValueInfo は、グラフの入出力の名前・要素の型・形
+type ValueInfo struct {
+	Name     string
+	ElemType int32
+	Dims     []Dim // nilなら形は不明
+}
+
+// Dim は、大きさ（Value）か記号（Param, バッチサイズの"N"など）
+type Dim struct {
+	Value int64
+	Param string
+}
+
+// Opset は、ドメインの演算子セットのバージョン（なければ0）
+func (m *Model) Opset(domain string) int64 {
+	for _, o := range m.OpsetImports {
+		if o.Domain == domain || (domain == "" && o.Domain == "ai.onnx") {
+			return o.Version
+		}
+	}
+	return 0
+}
+
+// Attr は、名前がnameの属性（なければnil）
+func (n *Node) Attr(name string) *Attribute {
+	for _, a := range n.Attributes {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func IntAttr(name string, v int64) *Attribute {
+	return &Attribute{Name: name, Type: AttrInt, I: v}
+}
+
+func IntsAttr(name string, vs ...int64) *Attribute {
+	return &Attribute{Name: name, Type: AttrInts, Ints: vs}
+}
+
+func FloatAttr(name string, v float32) *Attribute {
+	return &Attribute{Name: name, Type: AttrFloat, F: v}
+}
+
+func StringAttr(name, v string) *Attribute {
+	return &Attribute{Name: name, Type: AttrString, S: v}
+}
+
+// Write は、mをモデルファイルとして書く
+func Write(w io.Writer, m *Model) error {
+	e := &encoder{}
+	m.encode(e)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Read は、モデルファイルを読む
+func Read(r io.Reader) (*Model, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{}
+	if err := decode(b, m.decode); err != nil {
+		return nil, err
+	}
+	if m.Graph == nil {
+		return nil, fmt.Errorf("onnx: model has no graph")
+	}
+	return m, nil
+}
+
+// ReadTensor は、TensorProtoだけのファイル（モデルのテストデータのinput_0.pbなど）を読む
+func ReadTensor(r io.Reader) (*Tensor, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tensor{}
+	if err := t.decodeAll(b); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WriteTensor は、tをTensorProtoだけのファイルとして書く
+func WriteTensor(w io.Writer, t *Tensor) error {
+	e := &encoder{}
+	t.encode(e)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+func (m *Model) encode(e *encoder) {
+	e.int(1, m.IRVersion)
+	e.string(2, m.ProducerName)
+	e.string(3, m.ProducerVersion)
+	e.string(4, m.Domain)
+	e.intIfSet(5, m.ModelVersion)
+	e.string(6, m.DocString)
+	if m.Graph != nil {
+		e.message(7, m.Graph)
+	}
+	for _, o := range m.OpsetImports {
+		e.message(8, o)
+	}
+}
+
+func (m *Model) decode(f field) error {
+	switch f.num {
+	case 1:
+		m.IRVersion = f.int()
+	case 2:
+		m.ProducerName = string(f.bytes)
+	case 3:
+		m.ProducerVersion = string(f.bytes)
+	case 4:
+		m.Domain = string(f.bytes)
+	case 5:
+		m.ModelVersion = f.int()
+	case 6:
+		m.DocString = string(f.bytes)
+	case 7:
+		m.Graph = &Graph{}
+		return decode(f.bytes, m.Graph.decode)
+	case 8:
+		o := &OpsetID{}
+		m.OpsetImports = append(m.OpsetImports, o)
+		return decode(f.bytes, o.decode)
+	}
+	return nil
+}
+
+func (o *OpsetID) encode(e *encoder) {
+	e.string(1, o.Domain)
+	e.int(2, o.Version)
+}
+
+func (o *OpsetID) decode(f field) error {
+	switch f.num {
+	case 1:
+		o.Domain = string(f.bytes)
+	case 2:
+		o.Version = f.int()
+	}
+	return nil
+}
+
+func (g *Graph) encode(e *encoder) {
+	for _, n := range g.Nodes {
+		e.message(1, n)
+	}
+	e.string(2, g.Name)
+	for _, t := range g.Initializers {
+		e.message(5, t)
+	}
+	e.string(10, g.DocString)
+	for _, v := range g.Inputs {
+		e.message(11, v)
+	}
+	for _, v := range g.Outputs {
+		e.message(12, v)
+	}
+	for _, v := range g.ValueInfo {
+		e.message(13, v)
+	}
+}
+
+func (g *Graph) decode(f field) error {
+	switch f.num {
+	case 1:
+		n := &Node{}
+		g.Nodes = append(g.Nodes, n)
+		return decode(f.bytes, n.decode)
+	case 2:
+		g.Name = string(f.bytes)
+	case 5:
+		t := &Tensor{}
+		g.Initializers = append(g.Initializers, t)
+		return t.decodeAll(f.bytes)
+	case 10:
+		g.DocString = string(f.bytes)
+	case 11, 12, 13:
+		v := &ValueInfo{}
+		switch f.num {
+		case 11:
+			g.Inputs = append(g.Inputs, v)
+		case 12:
+			g.Outputs = append(g.Outputs, v)
+		default:
+			g.ValueInfo = append(g.ValueInfo, v)
+		}
+		return decode(f.bytes, v.decode)
+	}
+	return nil
+}
+
+func (n *Node) encode(e *encoder) {
+	for _, in := range n.Inputs {
+		e.bytes(1, []byte(in))
+	}
+	for _, out := range n.Outputs {
+		e.bytes(2, []byte(out))
+	}
+	e.string(3, n.Name)
+	e.string(4, n.OpType)
+	for _, a := range n.Attributes {
+		e.message(5, a)
+	}
+	e.string(6, n.DocString)
+	e.string(7, n.Domain)
+}
+
+func (n *Node) decode(f field) error {
+	switch f.num {
+	case 1:
+		n.Inputs = append(n.Inputs, string(f.bytes))
+	case 2:
+		n.Outputs = append(n.Outputs, string(f.bytes))
+	case 3:
+		n.Name = string(f.bytes)
+	case 4:
+		n.OpType = string(f.bytes)
+	case 5:
+		a := &Attribute{}
+		n.Attributes = append(n.Attributes, a)
+		return decode(f.bytes, a.decode)
+	case 6:
+		n.DocString = string(f.bytes)
+	case 7:
+		n.Domain = string(f.bytes)
+	}
+	return nil
+}
+
+func (a *Attribute) encode(e *encoder) {
+	e.string(1, a.Name)
+	switch a.Type {
+	case AttrFloat:
+		e.float(2, a.F)
+	case AttrInt:
+		e.int(3, a.I)
+	case AttrString:
+		e.bytes(4, []byte(a.S))
+	case AttrTensor:
+		e.message(5, a.T)
+	case AttrFloats:
+		e.packedFloats(7, a.Floats)
+	case AttrInts:
+		e.packedInts(8, a.Ints)
+	case AttrStrings:
+		for _, s := range a.Strings {
+			e.bytes(9, []byte(s))
+		}
+	}
+	e.int(20, int64(a.Type))
+}
+
+func (a *Attribute) decode(f field) error {
+	switch f.num {
+	case 1:
+		a.Name = string(f.bytes)
+	case 2:
+		a.F = f.float()
+	case 3:
+		a.I = f.int()
+	case 4:
+		a.S = string(f.bytes)
+	case 5:
+		a.T = &Tensor{}
+		return a.T.decodeAll(f.bytes)
+	case 7:
+		a.Floats = append(a.Floats, f.floats()...)
+	case 8:
+		vs, err := f.ints()
+		if err != nil {
+			return err
+		}
+		a.Ints = append(a.Ints, vs...)
+	case 9:
+		a.Strings = append(a.Strings, string(f.bytes))
+	case 20:
+		a.Type = AttributeType(f.int())
+	}
+	return nil
+}
+
+func (t *Tensor) encode(e *encoder) {
+	e.packedInts(1, t.Dims)
+	e.int(2, int64(t.DataType))
+	e.string(8, t.Name)
+	// 値はraw_data（リトルエンディアン）に書く
+	raw := []byte{}
+	for _, v := range t.Data {
+		switch t.DataType {
+		case FLOAT:
+			raw = appendFloat(raw, float32(v))
+		case DOUBLE:
+			var le [8]byte
+			binary.LittleEndian.PutUint64(le[:], math.Float64bits(v))
+			raw = append(raw, le[:]...)
+		case INT64:
+			var le [8]byte
+			binary.LittleEndian.PutUint64(le[:], uint64(int64(v)))
+			raw = append(raw, le[:]...)
+		case INT32:
+			var le [4]byte
+			binary.LittleEndian.PutUint32(le[:], uint32(int32(v)))
+			raw = append(raw, le[:]...)
+		}
+	}
+	if len(raw) > 0 {
+		e.bytes(9, raw)
+	}
+}
+
+// decodeAll は、raw_dataはdata_typeが分かってから読む
+func (t *Tensor) decodeAll(b []byte) error {
+	var raw []byte
+	err := decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			vs, err := f.ints()
+			if err != nil {
+				return err
+			}
+			t.Dims = append(t.Dims, vs...)
+		case 2:
+			t.DataType = int32(f.int())
+		case 4:
+			for _, v := range f.floats() {
+				t.Data = append(t.Data, float64(v))
+			}
+		case 5, 7:
+			// int32_data, int64_data
+			vs, err := f.ints()
+			if err != nil {
+				return err
+			}
+			for _, v := range vs {
+				if f.num == 5 {
+					v = int64(int32(v))
+				}
+				t.Data = append(t.Data, float64(v))
+			}
+		case 8:
+			t.Name = string(f.bytes)
+		case 9:
+			raw = f.bytes
+		case 10:
+			t.Data = append(t.Data, f.doubles()...)
+		case 13:
+			return fmt.Errorf("onnx: tensor %q uses external data", t.Name)
+		}
+		return nil
+	})
+	if err != nil || raw == nil {
+		return err
+	}
+	size := map[int32]int{FLOAT: 4, DOUBLE: 8, INT64: 8, INT32: 4}[t.DataType]
+	if size == 0 {
+		return fmt.Errorf("onnx: tensor %q has unsupported data type %d", t.Name, t.DataType)
+	}
+	for i := 0; i+size <= len(raw); i += size {
+		b := raw[i : i+size]
+		switch t.DataType {
+		case FLOAT:
+			t.Data = append(t.Data, float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		case DOUBLE:
+			t.Data = append(t.Data, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		case INT64:
+			t.Data = append(t.Data, float64(int64(binary.LittleEndian.Uint64(b))))
+		case INT32:
+			t.Data = append(t.Data, float64(int32(binary.LittleEndian.Uint32(b))))
+		}
+	}
+	return nil
+}
+
+func (v *ValueInfo) encode(e *encoder) {
+	e.string(1, v.Name)
+	// TypeProto { tensor_type = 1: Tensor { elem_type = 1, shape = 2 } }
+	tensor := &encoder{}
+	tensor.int(1, int64(v.ElemType))
+	if v.Dims != nil {
+		shape := &encoder{}
+		for _, d := range v.Dims {
+			dim := &encoder{}
+			if d.Param != "" {
+				dim.string(2, d.Param)
+			} else {
+				dim.int(1, d.Value)
+			}
+			shape.bytes(1, dim.buf)
+		}
+		tensor.bytes(2, shape.buf)
+	}
+	typ := &encoder{}
+	typ.bytes(1, tensor.buf)
+	e.bytes(2, typ.buf)
+}
+
+func (v *ValueInfo) decode(f field) error {
+	switch f.num {
+	case 1:
+		v.Name = string(f.bytes)
+	case 2:
+		return decode(f.bytes, func(f field) error {
+			if f.num != 1 {
+				return nil
+			}
+			return decode(f.bytes, func(f field) error {
+				switch f.num {
+				case 1:
+					v.ElemType = int32(f.int())
+				case 2:
+					v.Dims = []Dim{}
+					return decode(f.bytes, func(f field) error {
+						if f.num != 1 {
+							return nil
+						}
+						d := Dim{}
+						err := decode(f.bytes, func(f field) error {
+							switch f.num {
+							case 1:
+								d.Value = f.int()
+							case 2:
+								d.Param = string(f.bytes)
+							}
+							return nil
+						})
+						v.Dims = append(v.Dims, d)
+						return err
+					})
+				}
+				return nil
+			})
+		})
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package onnx
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	m := &Model{
+		IRVersion:    IRVersion,
+		OpsetImports: []*OpsetID{{Version: OpsetVersion}},
+		ProducerName: "test",
+		Graph: &Graph{
+			Name: "g",
+			Nodes: []*Node{
+				{Name: "conv", OpType: "Conv", Inputs: []string{"x", "W", ""}, Outputs: []string{"y"},
+					Attributes: []*Attribute{IntsAttr("pads", 1, 1, 1, 1), IntAttr("group", 1), StringAttr("auto_pad", "NOTSET")}},
+				{Name: "leaky", OpType: "LeakyRelu", Inputs: []string{"y"}, Outputs: []string{"z"},
+					Attributes: []*Attribute{FloatAttr("alpha", 0.25), {Name: "axes", Type: AttrInts, Ints: []int64{-1}}}},
+			},
+			Initializers: []*Tensor{
+				{Name: "W", Dims: []int64{1, 1, 2, 2}, DataType: FLOAT, Data: []float64{1, -2, 0.5, 3}},
+				{Name: "shape", Dims: []int64{2}, DataType: INT64, Data: []float64{-1, 4}},
+			},
+			Inputs:  []*ValueInfo{{Name: "x", ElemType: FLOAT, Dims: []Dim{{Param: "N"}, {Value: 1}, {Value: 4}, {Value: 4}}}},
+			Outputs: []*ValueInfo{{Name: "z", ElemType: FLOAT}},
+		},
+	}
+	buf := &bytes.Buffer{}
+	if err := Write(buf, m); err != nil {
+		t.FailNow()
+	}
+	actual, err := Read(buf)
+	if err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(actual, m) {
+		fmt.Printf("%+v\n%+v\n", actual.Graph, m.Graph)
+		t.Fail()
+	}
+	if actual.Opset("") != OpsetVersion || actual.Graph.Nodes[1].Attr("alpha").F != 0.25 {
+		t.Fail()
+	}
+}
+
+// protocの出力と同じバイト列
+func TestEncoding(t *testing.T) {
+	e := &encoder{}
+	(&Tensor{Name: "b", Dims: []int64{2}, DataType: FLOAT, Data: []float64{1, -1}}).encode(e)
+	// dims: [2], data_type: FLOAT, name: "b", raw_data: 1.0f, -1.0f
+	expected := []byte{0x0a, 0x01, 0x02, 0x10, 0x01, 0x42, 0x01, 'b', 0x4a, 0x08, 0, 0, 0x80, 0x3f, 0, 0, 0x80, 0xbf}
+	if !bytes.Equal(e.buf, expected) {
+		fmt.Printf("% x\n", e.buf)
+		t.Fail()
+	}
+
+	// float_dataとpackedでないint64も読める
+	tensor := &Tensor{}
+	err := tensor.decodeAll([]byte{0x08, 0x03, 0x10, 0x01, 0x22, 0x04, 0, 0, 0x20, 0x40})
+	if err != nil || !reflect.DeepEqual(tensor, &Tensor{Dims: []int64{3}, DataType: FLOAT, Data: []float64{2.5}}) {
+		fmt.Println(tensor, err)
+		t.Fail()
+	}
+
+	if _, err := Read(bytes.NewReader([]byte{0x3a, 0x05, 0x0a})); err == nil {
+		t.Fail()
+	}
+}
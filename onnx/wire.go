@@ -0,0 +1,210 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protocol Buffersのワイヤ形式
+// https://protobuf.dev/programming-guides/encoding/
+const (
+	wireVarint = 0
+	wire64bit  = 1
+	wireBytes  = 2
+	wire32bit  = 5
+)
+
+// encoder は、メッセージを1つ書く
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (e *encoder) int(field int, v int64) {
+	e.tag(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+// intIfSet は、ゼロ値なら省略する（proto3の既定値）
+func (e *encoder) intIfSet(field int, v int64) {
+	if v != 0 {
+		e.int(field, v)
+	}
+}
+
+func (e *encoder) float(field int, v float32) {
+	e.tag(field, wire32bit)
+	e.buf = appendFloat(e.buf, v)
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+func (e *encoder) message(field int, m interface{ encode(*encoder) }) {
+	sub := &encoder{}
+	m.encode(sub)
+	e.bytes(field, sub.buf)
+}
+
+func (e *encoder) packedInts(field int, vs []int64) {
+	if len(vs) == 0 {
+		return
+	}
+	sub := &encoder{}
+	for _, v := range vs {
+		sub.varint(uint64(v))
+	}
+	e.bytes(field, sub.buf)
+}
+
+func (e *encoder) packedFloats(field int, vs []float32) {
+	if len(vs) == 0 {
+		return
+	}
+	b := make([]byte, 0, 4*len(vs))
+	for _, v := range vs {
+		b = appendFloat(b, v)
+	}
+	e.bytes(field, b)
+}
+
+func appendFloat(b []byte, v float32) []byte {
+	var le [4]byte
+	binary.LittleEndian.PutUint32(le[:], math.Float32bits(v))
+	return append(b, le[:]...)
+}
+
+// field は、読んだフィールドの1つ
+type field struct {
+	num   int
+	wire  int
+	value uint64 // varint, 64bit, 32bit
+	bytes []byte // length-delimited
+}
+
+var errTruncated = errors.New("onnx: message is truncated")
+
+func readVarint(b []byte) (uint64, int, error) {
+	v := uint64(0)
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+// decode は、メッセージのフィールドを順にfに渡す
+func decode(b []byte, f func(field) error) error {
+	for len(b) > 0 {
+		key, n, err := readVarint(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		fd := field{num: int(key >> 3), wire: int(key & 7)}
+		switch fd.wire {
+		case wireVarint:
+			fd.value, n, err = readVarint(b)
+			if err != nil {
+				return err
+			}
+		case wire64bit:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			fd.value, n = binary.LittleEndian.Uint64(b), 8
+		case wire32bit:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			fd.value, n = uint64(binary.LittleEndian.Uint32(b)), 4
+		case wireBytes:
+			l, m, err := readVarint(b)
+			if err != nil {
+				return err
+			}
+			if uint64(len(b)-m) < l {
+				return errTruncated
+			}
+			fd.bytes, n = b[m:m+int(l)], m+int(l)
+		default:
+			return fmt.Errorf("onnx: unsupported wire type %d", fd.wire)
+		}
+		b = b[n:]
+		if err := f(fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f field) int() int64 {
+	return int64(f.value)
+}
+
+func (f field) float() float32 {
+	return math.Float32frombits(uint32(f.value))
+}
+
+// ints は、packedでもそうでなくても読む
+func (f field) ints() ([]int64, error) {
+	if f.wire != wireBytes {
+		return []int64{f.int()}, nil
+	}
+	vs := []int64{}
+	for b := f.bytes; len(b) > 0; {
+		v, n, err := readVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, int64(v))
+		b = b[n:]
+	}
+	return vs, nil
+}
+
+func (f field) floats() []float32 {
+	if f.wire != wireBytes {
+		return []float32{f.float()}
+	}
+	vs := make([]float32, len(f.bytes)/4)
+	for i := range vs {
+		vs[i] = math.Float32frombits(binary.LittleEndian.Uint32(f.bytes[4*i:]))
+	}
+	return vs
+}
+
+func (f field) doubles() []float64 {
+	if f.wire != wireBytes {
+		return []float64{math.Float64frombits(f.value)}
+	}
+	vs := make([]float64, len(f.bytes)/8)
+	for i := range vs {
+		vs[i] = math.Float64frombits(binary.LittleEndian.Uint64(f.bytes[8*i:]))
+	}
+	return vs
+}
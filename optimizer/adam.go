@@ -13,6 +13,7 @@ type Adam struct {
 	Iter  int
 	M     map[string]*num.Matrix
 	V     map[string]*num.Matrix
+	ParamGroups
 }
 
 func NewAdam(lr float64) *Adam {
@@ -37,11 +38,13 @@ func (a *Adam) Update(params, grads map[string]*num.Matrix) map[string]*num.Matr
 	}
 	a.Iter++
 	fIter := float64(a.Iter)
-	lrT := a.LR * math.Sqrt(1.0-math.Pow(a.Beta2, fIter)) / (1.0 - math.Pow(a.Beta1, fIter))
 
 	newParams := map[string]*num.Matrix{}
 	for k, g := range grads {
-		a.M[k] = num.Add(a.M[k], num.Mul(1.0-a.Beta1, num.Sub(g, a.M[k])))
+		g = a.decay(k, params[k], g)
+		beta1 := a.momentum(k, a.Beta1)
+		lrT := a.lr(k, a.LR) * math.Sqrt(1.0-math.Pow(a.Beta2, fIter)) / (1.0 - math.Pow(beta1, fIter))
+		a.M[k] = num.Add(a.M[k], num.Mul(1.0-beta1, num.Sub(g, a.M[k])))
 		a.V[k] = num.Add(a.V[k], num.Mul(1.0-a.Beta2, num.Sub(num.Pow(g, 2), a.V[k])))
 
 		delta := num.Div(num.Mul(lrT, a.M[k]), num.Add(num.Sqrt(a.V[k]), 1e-7))
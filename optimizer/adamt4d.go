@@ -17,6 +17,7 @@ type AdamAny struct {
 	Iter  int
 	M     map[string]interface{}
 	V     map[string]interface{}
+	ParamGroups
 }
 
 func NewAdamAny(lr float64) *AdamAny {
@@ -48,19 +49,21 @@ func (a *AdamAny) Update(params, grads map[string]interface{}) map[string]interf
 	}
 	a.Iter++
 	fIter := float64(a.Iter)
-	lrT := a.LR * math.Sqrt(1.0-math.Pow(a.Beta2, fIter)) / (1.0 - math.Pow(a.Beta1, fIter))
 
 	newParams := map[string]interface{}{}
 	for k, g := range grads {
+		g = a.decayAny(k, params[k], g)
+		beta1 := a.momentum(k, a.Beta1)
+		lrT := a.lr(k, a.LR) * math.Sqrt(1.0-math.Pow(a.Beta2, fIter)) / (1.0 - math.Pow(beta1, fIter))
 		if t4d, ok := g.(num.Tensor4D); ok {
-			a.M[k] = num.AddT4D(a.M[k], num.MulT4D(1.0-a.Beta1, num.SubT4D(g, a.M[k])))
+			a.M[k] = num.AddT4D(a.M[k], num.MulT4D(1.0-beta1, num.SubT4D(g, a.M[k])))
 			a.V[k] = num.AddT4D(a.V[k], num.MulT4D(1.0-a.Beta2, num.SubT4D(num.PowT4D(t4d, 2), a.V[k])))
 
 			delta := num.DivT4D(num.MulT4D(lrT, a.M[k]), num.AddT4D(num.SqrtT4D(a.V[k].(num.Tensor4D)), 1e-7))
 			newParams[k] = num.SubT4D(params[k], delta)
 		}
 		if mat, ok := g.(*num.Matrix); ok {
-			a.M[k] = num.Add(a.M[k], num.Mul(1.0-a.Beta1, num.Sub(g, a.M[k])))
+			a.M[k] = num.Add(a.M[k], num.Mul(1.0-beta1, num.Sub(g, a.M[k])))
 			a.V[k] = num.Add(a.V[k], num.Mul(1.0-a.Beta2, num.Sub(num.Pow(mat, 2), a.V[k])))
 
 			delta := num.Div(num.Mul(lrT, a.M[k]), num.Add(num.Sqrt(a.V[k].(*num.Matrix)), 1e-7))
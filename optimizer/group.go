@@ -0,0 +1,103 @@
+package optimizer
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+// ParamGroup は、名前がPatternに合うパラメタのハイパーパラメタ
+// Patternはpath.Matchの書式（"b*"、"W[12]"など）で、nilの値はオプティマイザの値を使う
+type ParamGroup struct {
+	Pattern     string
+	LR          *float64
+	Momentum    *float64 // MomentumのMomentum、Adam・AdamAnyのBeta1（SGD・AdaGradは使わない）
+	WeightDecay *float64
+}
+
+// ParamGroups は、各オプティマイザに埋め込むパラメタグループ
+// パラメタには、名前に最初に合ったグループの値を使う
+// 重み減衰をオプティマイザで行うときは、ネットワークのWeightDecayLambdaを0にする（両方はネットワークを作るときにエラー）
+type ParamGroups struct {
+	WeightDecay float64 // 勾配にWeightDecay*パラメタを足す（L2正則化）
+	Groups      []ParamGroup
+}
+
+// Float は、ParamGroupの値を書くためのポインタ
+func Float(v float64) *float64 {
+	return &v
+}
+
+// AddGroup は、グループを最後に追加する（先に追加したグループが優先）
+func (p *ParamGroups) AddGroup(g ParamGroup) error {
+	if _, err := path.Match(g.Pattern, ""); err != nil {
+		return fmt.Errorf("param group %q: %v", g.Pattern, err)
+	}
+	p.Groups = append(p.Groups, g)
+	return nil
+}
+
+// Group は、nameのパラメタのグループ（どれにも合わなければnil）
+func (p *ParamGroups) Group(name string) *ParamGroup {
+	for i := range p.Groups {
+		if ok, _ := path.Match(p.Groups[i].Pattern, name); ok {
+			return &p.Groups[i]
+		}
+	}
+	return nil
+}
+
+// HasWeightDecay は、いずれかのパラメタに重み減衰をするかどうか
+func (p *ParamGroups) HasWeightDecay() bool {
+	if p.WeightDecay != 0 {
+		return true
+	}
+	for _, g := range p.Groups {
+		if g.WeightDecay != nil && *g.WeightDecay != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ParamGroups) lr(name string, lr float64) float64 {
+	if g := p.Group(name); g != nil && g.LR != nil {
+		return *g.LR
+	}
+	return lr
+}
+
+func (p *ParamGroups) momentum(name string, momentum float64) float64 {
+	if g := p.Group(name); g != nil && g.Momentum != nil {
+		return *g.Momentum
+	}
+	return momentum
+}
+
+func (p *ParamGroups) weightDecay(name string) float64 {
+	if g := p.Group(name); g != nil && g.WeightDecay != nil {
+		return *g.WeightDecay
+	}
+	return p.WeightDecay
+}
+
+// decay は、重み減衰を足した勾配
+func (p *ParamGroups) decay(name string, param, grad *num.Matrix) *num.Matrix {
+	wd := p.weightDecay(name)
+	if wd == 0 {
+		return grad
+	}
+	return num.Add(grad, num.Mul(wd, param))
+}
+
+func (p *ParamGroups) decayAny(name string, param, grad interface{}) interface{} {
+	wd := p.weightDecay(name)
+	if wd == 0 {
+		return grad
+	}
+	if t4d, ok := grad.(num.Tensor4D); ok {
+		return num.AddT4D(t4d, num.MulT4D(wd, param))
+	}
+	return num.Add(grad, num.Mul(wd, param))
+}
@@ -0,0 +1,84 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/num"
+)
+
+func row(v ...float64) *num.Matrix {
+	return &num.Matrix{Vector: v, Rows: 1, Columns: len(v)}
+}
+
+func params() (map[string]*num.Matrix, map[string]*num.Matrix) {
+	ps := map[string]*num.Matrix{
+		"W1": row(1, 2),
+		"b1": row(1, 2),
+		"W2": row(1, 2),
+	}
+	gs := map[string]*num.Matrix{}
+	for k := range ps {
+		gs[k] = row(0.5, -0.5)
+	}
+	return ps, gs
+}
+
+func TestSGDParamGroups(t *testing.T) {
+	sgd := NewSGD(0.1)
+	sgd.WeightDecay = 0.2
+	sgd.AddGroup(ParamGroup{Pattern: "b*", WeightDecay: Float(0)})
+	sgd.AddGroup(ParamGroup{Pattern: "W2", LR: Float(0.01)})
+	// 先に追加したグループが優先（b1はLRを省略したので0.1）
+	sgd.AddGroup(ParamGroup{Pattern: "*", LR: Float(1)})
+
+	ps, gs := params()
+	updated := sgd.Update(ps, gs)
+	expected := map[string][]float64{
+		"W1": {1 - 1*(0.5+0.2*1), 2 - 1*(-0.5+0.2*2)},
+		"b1": {1 - 0.1*0.5, 2 + 0.1*0.5},
+		"W2": {1 - 0.01*(0.5+0.2*1), 2 - 0.01*(-0.5+0.2*2)},
+	}
+	for k, e := range expected {
+		for i, v := range e {
+			if math.Abs(updated[k].Vector[i]-v) > 1e-12 {
+				fmt.Println(k, updated[k], e)
+				t.Fail()
+			}
+		}
+	}
+
+	if err := sgd.AddGroup(ParamGroup{Pattern: "W["}); err == nil {
+		t.Fail()
+	}
+}
+
+func TestAdamParamGroups(t *testing.T) {
+	// グループのないパラメタは、今までと同じ
+	plain, grouped := NewAdam(0.01), NewAdam(0.01)
+	grouped.AddGroup(ParamGroup{Pattern: "b?", LR: Float(0.1), Momentum: Float(0.5)})
+	ps, gs := params()
+	p1, p2 := plain.Update(ps, gs), grouped.Update(ps, gs)
+	for i := 0; i < 2; i++ {
+		p1, p2 = plain.Update(p1, gs), grouped.Update(p2, gs)
+	}
+	if !num.Equal(p1["W1"], p2["W1"]) || num.Equal(p1["b1"], p2["b1"]) {
+		fmt.Println(p1, p2)
+		t.Fail()
+	}
+	// 勾配が一定なら、バイアス補正後の1回の更新はLRの大きさ
+	if d := 1 - p2["b1"].Vector[0]; math.Abs(d-0.3) > 1e-5 {
+		fmt.Println(d)
+		t.Fail()
+	}
+
+	momentum := NewMomentum(0.1)
+	momentum.AddGroup(ParamGroup{Pattern: "W*", Momentum: Float(0)})
+	ps, gs = params()
+	updated := momentum.Update(momentum.Update(ps, gs), gs)
+	if w, b := updated["W1"].Vector[0], updated["b1"].Vector[0]; math.Abs(w-0.9) > 1e-12 || math.Abs(b-(1-0.05-0.095)) > 1e-12 {
+		fmt.Println(w, b)
+		t.Fail()
+	}
+}
@@ -8,6 +8,7 @@ type Optimizer interface {
 
 type SGD struct {
 	LR float64
+	ParamGroups
 }
 
 func NewSGD(lr float64) *SGD {
@@ -19,7 +20,8 @@ func NewSGD(lr float64) *SGD {
 func (sgd *SGD) Update(params, grads map[string]*num.Matrix) map[string]*num.Matrix {
 	newParams := map[string]*num.Matrix{}
 	for k, g := range grads {
-		newParams[k] = num.Sub(params[k], num.Mul(g, sgd.LR))
+		g = sgd.decay(k, params[k], g)
+		newParams[k] = num.Sub(params[k], num.Mul(g, sgd.lr(k, sgd.LR)))
 	}
 	return newParams
 }
@@ -28,6 +30,7 @@ type Momentum struct {
 	LR       float64
 	Momentum float64
 	V        map[string]*num.Matrix
+	ParamGroups
 }
 
 func NewMomentum(lr float64) *Momentum {
@@ -48,7 +51,8 @@ func (mo *Momentum) Update(params, grads map[string]*num.Matrix) map[string]*num
 
 	newParams := map[string]*num.Matrix{}
 	for k, g := range grads {
-		mo.V[k] = num.Sub(num.Mul(mo.Momentum, mo.V[k]), num.Mul(mo.LR, g))
+		g = mo.decay(k, params[k], g)
+		mo.V[k] = num.Sub(num.Mul(mo.momentum(k, mo.Momentum), mo.V[k]), num.Mul(mo.lr(k, mo.LR), g))
 		newParams[k] = num.Add(params[k], mo.V[k])
 	}
 	return newParams
@@ -57,6 +61,7 @@ func (mo *Momentum) Update(params, grads map[string]*num.Matrix) map[string]*num
 type AdaGrad struct {
 	LR float64
 	H  map[string]*num.Matrix
+	ParamGroups
 }
 
 func NewAdaGrad(lr float64) *AdaGrad {
@@ -75,8 +80,9 @@ func (ad *AdaGrad) Update(params, grads map[string]*num.Matrix) map[string]*num.
 	}
 	newParams := map[string]*num.Matrix{}
 	for k, g := range grads {
+		g = ad.decay(k, params[k], g)
 		ad.H[k] = num.Add(ad.H[k], num.Pow(g, 2))
-		delta := num.Div(num.Mul(ad.LR, g), num.Add(num.Sqrt(ad.H[k]), 1e-7))
+		delta := num.Div(num.Mul(ad.lr(k, ad.LR), g), num.Add(num.Sqrt(ad.H[k]), 1e-7))
 		newParams[k] = num.Sub(params[k], delta)
 	}
 	return newParams
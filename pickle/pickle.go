@@ -0,0 +1,702 @@
+package pickle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/naronA/zero_deeplearning/npy"
+)
+
+// Pythonのpickle（プロトコル0〜5）のうち、numpy.ndarrayの辞書やリストを読むのに必要な部分だけを読む
+// https://github.com/python/cpython/blob/main/Lib/pickletools.py
+//
+// 読んだ値は次のGoの値になる
+//
+//	dict → map[string]interface{}（キーは文字列だけ）
+//	list, tuple → []interface{}
+//	int → int64（大きな値は*big.Int）, float → float64, bool → bool, None → nil
+//	str → string, bytes → []byte
+//	numpy.ndarray → *npy.Array
+
+const (
+	opMark           = '('
+	opStop           = '.'
+	opPop            = '0'
+	opPopMark        = '1'
+	opDup            = '2'
+	opFloat          = 'F'
+	opInt            = 'I'
+	opBinInt         = 'J'
+	opBinInt1        = 'K'
+	opLong           = 'L'
+	opBinInt2        = 'M'
+	opNone           = 'N'
+	opReduce         = 'R'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opUnicode        = 'V'
+	opBinUnicode     = 'X'
+	opAppend         = 'a'
+	opBuild          = 'b'
+	opGlobal         = 'c'
+	opDict           = 'd'
+	opEmptyDict      = '}'
+	opAppends        = 'e'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opLongBinGet     = 'j'
+	opList           = 'l'
+	opEmptyList      = ']'
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opSetItem        = 's'
+	opTuple          = 't'
+	opEmptyTuple     = ')'
+	opSetItems       = 'u'
+	opBinFloat       = 'G'
+
+	// プロトコル2
+	opProto    = 0x80
+	opNewObj   = 0x81
+	opTuple1   = 0x85
+	opTuple2   = 0x86
+	opTuple3   = 0x87
+	opNewTrue  = 0x88
+	opNewFalse = 0x89
+	opLong1    = 0x8a
+	opLong4    = 0x8b
+
+	// プロトコル3
+	opBinBytes      = 'B'
+	opShortBinBytes = 'C'
+
+	// プロトコル4
+	opShortBinUnicode = 0x8c
+	opBinUnicode8     = 0x8d
+	opBinBytes8       = 0x8e
+	opStackGlobal     = 0x93
+	opMemoize         = 0x94
+	opFrame           = 0x95
+
+	// プロトコル5
+	opByteArray8 = 0x96
+)
+
+// mark は、スタック上のMARKの位置
+type mark struct{}
+
+// global は、モジュールの関数やクラス
+type global struct {
+	module, name string
+}
+
+// dtype は、numpy.dtypeの途中の状態
+type dtype struct {
+	kind  string // "f4"など
+	order string // "<", ">", "|"
+}
+
+// ndarray は、numpy.ndarrayの途中の状態
+type ndarray struct {
+	array *npy.Array
+}
+
+// Load は、rからpickleを1つ読む
+func Load(r io.Reader) (interface{}, error) {
+	u := &unpickler{r: bufio.NewReader(r), memo: map[int]interface{}{}}
+	return u.load()
+}
+
+type unpickler struct {
+	r     *bufio.Reader
+	stack []interface{}
+	memo  map[int]interface{}
+}
+
+func (u *unpickler) push(v interface{}) {
+	u.stack = append(u.stack, v)
+}
+
+func (u *unpickler) pop() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("pickle: stack underflow")
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("pickle: stack underflow")
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+// popMark は、最後のMARKより上の値を取り出す
+func (u *unpickler) popMark() ([]interface{}, error) {
+	for i := len(u.stack) - 1; i >= 0; i-- {
+		if _, ok := u.stack[i].(mark); ok {
+			items := append([]interface{}{}, u.stack[i+1:]...)
+			u.stack = u.stack[:i]
+			return items, nil
+		}
+	}
+	return nil, errors.New("pickle: mark not found")
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// read は、nバイトを読む
+// nはファイルに書かれた長さなので、実際に読めた分だけ確保する
+func (u *unpickler) read(n uint64) ([]byte, error) {
+	if n > uint64(maxInt) {
+		return nil, fmt.Errorf("pickle: length %d is too large", n)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, u.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (u *unpickler) readUint(n int) (uint64, error) {
+	b, err := u.read(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(0)
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, nil
+}
+
+func (u *unpickler) readLine() (string, error) {
+	line, err := u.r.ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+func (u *unpickler) load() (interface{}, error) {
+	for {
+		op, err := u.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("pickle: %v", err)
+		}
+		if op == opStop {
+			v, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			return finish(v)
+		}
+		if err := u.dispatch(op); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (u *unpickler) dispatch(op byte) error {
+	switch op {
+	case opProto:
+		_, err := u.r.ReadByte()
+		return err
+	case opFrame:
+		_, err := u.read(8)
+		return err
+	case opMark:
+		u.push(mark{})
+	case opPop:
+		_, err := u.pop()
+		return err
+	case opPopMark:
+		_, err := u.popMark()
+		return err
+	case opDup:
+		v, err := u.top()
+		if err != nil {
+			return err
+		}
+		u.push(v)
+
+	case opNone:
+		u.push(nil)
+	case opNewTrue:
+		u.push(true)
+	case opNewFalse:
+		u.push(false)
+	case opBinInt:
+		v, err := u.readUint(4)
+		u.push(int64(int32(v)))
+		return err
+	case opBinInt1:
+		v, err := u.readUint(1)
+		u.push(int64(v))
+		return err
+	case opBinInt2:
+		v, err := u.readUint(2)
+		u.push(int64(v))
+		return err
+	case opLong1, opLong4:
+		size := 1
+		if op == opLong4 {
+			size = 4
+		}
+		n, err := u.readUint(size)
+		if err != nil {
+			return err
+		}
+		b, err := u.read(n)
+		if err != nil {
+			return err
+		}
+		u.push(decodeLong(b))
+	case opInt, opLong:
+		line, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "00":
+			u.push(false)
+		case "01":
+			u.push(true)
+		default:
+			v, ok := new(big.Int).SetString(strings.TrimSuffix(line, "L"), 10)
+			if !ok {
+				return fmt.Errorf("pickle: invalid int %q", line)
+			}
+			u.push(smallInt(v))
+		}
+	case opFloat:
+		line, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		v, err := strconv.ParseFloat(line, 64)
+		u.push(v)
+		return err
+	case opBinFloat:
+		v, err := u.read(8)
+		u.push(math.Float64frombits(binary.BigEndian.Uint64(v)))
+		return err
+
+	case opShortBinString, opShortBinBytes, opShortBinUnicode:
+		return u.pushBytes(op, 1)
+	case opBinString, opBinBytes, opBinUnicode:
+		return u.pushBytes(op, 4)
+	case opBinUnicode8, opBinBytes8, opByteArray8:
+		return u.pushBytes(op, 8)
+	case opString:
+		line, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		s, err := strconv.Unquote(`"` + strings.Trim(line, `'"`) + `"`)
+		if err != nil {
+			return fmt.Errorf("pickle: invalid string %q", line)
+		}
+		u.push(s)
+	case opUnicode:
+		line, err := u.readLine()
+		u.push(line)
+		return err
+
+	case opEmptyTuple:
+		u.push([]interface{}{})
+	case opTuple1, opTuple2, opTuple3:
+		n := int(op-opTuple1) + 1
+		if len(u.stack) < n {
+			return errors.New("pickle: stack underflow")
+		}
+		items := append([]interface{}{}, u.stack[len(u.stack)-n:]...)
+		u.stack = u.stack[:len(u.stack)-n]
+		u.push(items)
+	case opTuple:
+		items, err := u.popMark()
+		if err != nil {
+			return err
+		}
+		u.push(items)
+	case opList:
+		items, err := u.popMark()
+		if err != nil {
+			return err
+		}
+		u.push(&list{items})
+	case opEmptyList:
+		u.push(&list{})
+	case opAppend:
+		v, err := u.pop()
+		if err != nil {
+			return err
+		}
+		return u.appendTo([]interface{}{v})
+	case opAppends:
+		items, err := u.popMark()
+		if err != nil {
+			return err
+		}
+		return u.appendTo(items)
+	case opEmptyDict:
+		u.push(map[string]interface{}{})
+	case opDict:
+		items, err := u.popMark()
+		if err != nil {
+			return err
+		}
+		u.push(map[string]interface{}{})
+		return u.setItems(items)
+	case opSetItem:
+		v, err := u.pop()
+		if err != nil {
+			return err
+		}
+		k, err := u.pop()
+		if err != nil {
+			return err
+		}
+		return u.setItems([]interface{}{k, v})
+	case opSetItems:
+		items, err := u.popMark()
+		if err != nil {
+			return err
+		}
+		return u.setItems(items)
+
+	case opPut:
+		line, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		i, err := strconv.Atoi(line)
+		if err != nil {
+			return err
+		}
+		return u.put(i)
+	case opBinPut:
+		i, err := u.readUint(1)
+		if err != nil {
+			return err
+		}
+		return u.put(int(i))
+	case opLongBinPut:
+		i, err := u.readUint(4)
+		if err != nil {
+			return err
+		}
+		return u.put(int(i))
+	case opMemoize:
+		return u.put(len(u.memo))
+	case opGet:
+		line, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		i, err := strconv.Atoi(line)
+		if err != nil {
+			return err
+		}
+		return u.get(i)
+	case opBinGet:
+		i, err := u.readUint(1)
+		if err != nil {
+			return err
+		}
+		return u.get(int(i))
+	case opLongBinGet:
+		i, err := u.readUint(4)
+		if err != nil {
+			return err
+		}
+		return u.get(int(i))
+
+	case opGlobal:
+		module, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		name, err := u.readLine()
+		if err != nil {
+			return err
+		}
+		u.push(global{module, name})
+	case opStackGlobal:
+		name, err := u.pop()
+		if err != nil {
+			return err
+		}
+		module, err := u.pop()
+		if err != nil {
+			return err
+		}
+		m, ok1 := module.(string)
+		n, ok2 := name.(string)
+		if !ok1 || !ok2 {
+			return errors.New("pickle: invalid STACK_GLOBAL")
+		}
+		u.push(global{m, n})
+	case opReduce, opNewObj:
+		args, err := u.pop()
+		if err != nil {
+			return err
+		}
+		f, err := u.pop()
+		if err != nil {
+			return err
+		}
+		v, err := call(f, args)
+		if err != nil {
+			return err
+		}
+		u.push(v)
+	case opBuild:
+		state, err := u.pop()
+		if err != nil {
+			return err
+		}
+		obj, err := u.top()
+		if err != nil {
+			return err
+		}
+		return build(obj, state)
+	default:
+		return fmt.Errorf("pickle: unsupported opcode 0x%02x", op)
+	}
+	return nil
+}
+
+// list は、APPENDで要素を追加するリスト
+type list struct {
+	items []interface{}
+}
+
+func (u *unpickler) appendTo(items []interface{}) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	l, ok := v.(*list)
+	if !ok {
+		return fmt.Errorf("pickle: cannot append to %T", v)
+	}
+	l.items = append(l.items, items...)
+	return nil
+}
+
+func (u *unpickler) setItems(items []interface{}) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("pickle: cannot set items of %T", v)
+	}
+	for i := 0; i+1 < len(items); i += 2 {
+		k, ok := items[i].(string)
+		if !ok {
+			return fmt.Errorf("pickle: unsupported dict key %v", items[i])
+		}
+		d[k] = items[i+1]
+	}
+	return nil
+}
+
+func (u *unpickler) put(i int) error {
+	v, err := u.top()
+	u.memo[i] = v
+	return err
+}
+
+func (u *unpickler) get(i int) error {
+	v, ok := u.memo[i]
+	if !ok {
+		return fmt.Errorf("pickle: memo %d not found", i)
+	}
+	u.push(v)
+	return nil
+}
+
+func (u *unpickler) pushBytes(op byte, size int) error {
+	n, err := u.readUint(size)
+	if err != nil {
+		return err
+	}
+	b, err := u.read(n)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case opShortBinBytes, opBinBytes, opBinBytes8, opByteArray8:
+		u.push(b)
+	default:
+		u.push(string(b))
+	}
+	return nil
+}
+
+// decodeLong は、2の補数のリトルエンディアンの整数
+func decodeLong(b []byte) interface{} {
+	if len(b) == 0 {
+		return int64(0)
+	}
+	be := make([]byte, len(b))
+	for i, c := range b {
+		be[len(b)-1-i] = c
+	}
+	v := new(big.Int).SetBytes(be)
+	if b[len(b)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return smallInt(v)
+}
+
+func smallInt(v *big.Int) interface{} {
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	return v
+}
+
+// call は、REDUCEで呼ばれる関数のうちndarrayの復元に必要なものだけを実行する
+func call(f, args interface{}) (interface{}, error) {
+	g, ok := f.(global)
+	if !ok {
+		return nil, fmt.Errorf("pickle: cannot call %T", f)
+	}
+	a, _ := args.([]interface{})
+	switch g.module + "." + g.name {
+	case "numpy.core.multiarray._reconstruct", "numpy._core.multiarray._reconstruct":
+		return &ndarray{}, nil
+	case "numpy.dtype":
+		if len(a) == 0 {
+			return nil, errors.New("pickle: numpy.dtype needs an argument")
+		}
+		kind, ok := a[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("pickle: invalid dtype %v", a[0])
+		}
+		return &dtype{kind: kind, order: "|"}, nil
+	case "_codecs.encode":
+		// プロトコル2では、bytesを_codecs.encode(str, 'latin1')として保存する
+		if len(a) != 2 {
+			return nil, errors.New("pickle: invalid _codecs.encode")
+		}
+		s, ok := a[0].(string)
+		if !ok || a[1] != "latin1" {
+			return nil, fmt.Errorf("pickle: unsupported _codecs.encode(%v)", a)
+		}
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("pickle: unsupported callable %s.%s", g.module, g.name)
+}
+
+// build は、BUILDでdtypeとndarrayの状態を設定する
+func build(obj, state interface{}) error {
+	s, _ := state.([]interface{})
+	switch o := obj.(type) {
+	case *dtype:
+		// (version, byteorder, subdescr, names, fields, elsize, alignment, flags)
+		if len(s) < 2 {
+			return errors.New("pickle: invalid dtype state")
+		}
+		if order, ok := s[1].(string); ok {
+			o.order = order
+		}
+		return nil
+	case *ndarray:
+		// (version, shape, dtype, is_fortran, data)
+		if len(s) != 5 {
+			return errors.New("pickle: invalid ndarray state")
+		}
+		shape := []int{}
+		dims, _ := s[1].([]interface{})
+		for _, d := range dims {
+			n, ok := d.(int64)
+			if !ok {
+				return fmt.Errorf("pickle: invalid shape %v", s[1])
+			}
+			shape = append(shape, int(n))
+		}
+		dt, ok := s[2].(*dtype)
+		if !ok {
+			return fmt.Errorf("pickle: invalid dtype %v", s[2])
+		}
+		fortran, _ := s[3].(bool)
+		var raw []byte
+		switch d := s[4].(type) {
+		case []byte:
+			raw = d
+		case string:
+			// Python 2のstr（STRING・BINSTRING・SHORT_BINSTRING）はバイト列そのもの
+			raw = []byte(d)
+		default:
+			return fmt.Errorf("pickle: unsupported ndarray data %T", s[4])
+		}
+		order := dt.order
+		if order == "=" {
+			order = "<"
+		}
+		a, err := npy.Decode(order+dt.kind, fortran, shape, raw)
+		if err != nil {
+			return fmt.Errorf("pickle: %v", err)
+		}
+		o.array = a
+		return nil
+	}
+	return fmt.Errorf("pickle: cannot build %T", obj)
+}
+
+// finish は、読み込み途中の値をGoの値に置き換える
+func finish(v interface{}) (interface{}, error) {
+	switch o := v.(type) {
+	case *ndarray:
+		if o.array == nil {
+			return nil, errors.New("pickle: ndarray has no state")
+		}
+		return o.array, nil
+	case *list:
+		return finish(o.items)
+	case []interface{}:
+		items := make([]interface{}, len(o))
+		for i, item := range o {
+			f, err := finish(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = f
+		}
+		return items, nil
+	case map[string]interface{}:
+		d := map[string]interface{}{}
+		for k, item := range o {
+			f, err := finish(item)
+			if err != nil {
+				return nil, err
+			}
+			d[k] = f
+		}
+		return d, nil
+	case global, *dtype, mark:
+		return nil, fmt.Errorf("pickle: unsupported value %v", v)
+	}
+	return v, nil
+}
@@ -0,0 +1,178 @@
+package pickle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/naronA/zero_deeplearning/npy"
+)
+
+// writer は、テスト用にPythonと同じ並びのpickleを組み立てる
+type writer struct {
+	bytes.Buffer
+	proto int
+	py2   bool // Python 2では文字列・bytesをBINSTRINGで書く
+}
+
+func (w *writer) op(b ...byte) *writer {
+	w.Write(b)
+	return w
+}
+
+func (w *writer) unicode(s string) *writer {
+	if w.py2 {
+		return w.bytes([]byte(s))
+	}
+	if w.proto >= 4 && len(s) < 256 {
+		w.op(opShortBinUnicode, byte(len(s)))
+	} else {
+		w.op(opBinUnicode)
+		binary.Write(w, binary.LittleEndian, uint32(len(s)))
+	}
+	w.WriteString(s)
+	return w
+}
+
+func (w *writer) global(module, name string) *writer {
+	if w.proto >= 4 {
+		return w.unicode(module).unicode(name).op(opStackGlobal)
+	}
+	w.op(opGlobal)
+	w.WriteString(module + "\n" + name + "\n")
+	return w
+}
+
+// bytes は、プロトコル2では_codecs.encode(str, 'latin1')、3以降はBINBYTES
+func (w *writer) bytes(b []byte) *writer {
+	if w.py2 {
+		w.op(opBinString)
+		binary.Write(w, binary.LittleEndian, uint32(len(b)))
+		w.Write(b)
+		return w
+	}
+	if w.proto >= 3 {
+		w.op(opBinBytes)
+		binary.Write(w, binary.LittleEndian, uint32(len(b)))
+		w.Write(b)
+		return w
+	}
+	s := make([]rune, len(b))
+	for i, c := range b {
+		s[i] = rune(c)
+	}
+	return w.global("_codecs", "encode").unicode(string(s)).unicode("latin1").op(opTuple2, opReduce)
+}
+
+// ndarray は、numpy.ndarrayのpickle（float32, C順）
+func (w *writer) ndarray(shape []int, data []float32) *writer {
+	w.global("numpy.core.multiarray", "_reconstruct")
+	w.global("numpy", "ndarray").op(opBinInt1, 0, opTuple1).bytes([]byte("b")).op(opTuple3, opReduce)
+	w.op(opMark, opBinInt1, 1, opMark)
+	for _, s := range shape {
+		w.op(opBinInt1, byte(s))
+	}
+	w.op(opTuple)
+	w.global("numpy", "dtype").unicode("f4").op(opBinInt1, 0, opBinInt1, 1, opTuple3, opReduce)
+	w.op(opMark, opBinInt1, 3).unicode("<").op(opNone, opNone, opNone, opBinInt, 0xff, 0xff, 0xff, 0xff, opBinInt, 0xff, 0xff, 0xff, 0xff, opBinInt1, 0, opTuple, opBuild)
+	w.op(opNewFalse)
+	raw := &bytes.Buffer{}
+	binary.Write(raw, binary.LittleEndian, data)
+	return w.bytes(raw.Bytes()).op(opTuple, opBuild)
+}
+
+func TestLoadNdarrayDict(t *testing.T) {
+	for _, proto := range []int{2, 3, 4} {
+		w := &writer{proto: proto}
+		w.op(opProto, byte(proto))
+		if proto >= 4 {
+			// フレームの長さは読み飛ばす
+			w.op(opFrame, 0, 0, 0, 0, 0, 0, 0, 0)
+		}
+		w.op(opEmptyDict, opBinPut, 0, opMark)
+		w.unicode("W1").ndarray([]int{2, 3}, []float32{1, 2, 3, 4, 5, 6.5})
+		w.unicode("b1").ndarray([]int{3}, []float32{0.5, -1, 2})
+		w.unicode("epochs").op(opBinInt2, 0x2c, 0x01)
+		w.unicode("names").op(opEmptyList, opBinPut, 1).unicode("a").op(opBinPut, 2, opAppend, opBinGet, 2, opAppend)
+		w.op(opSetItems, opStop)
+
+		v, err := Load(&w.Buffer)
+		if err != nil {
+			fmt.Println(proto, err)
+			t.Fail()
+			continue
+		}
+		d := v.(map[string]interface{})
+		expected := map[string]interface{}{
+			"W1":     &npy.Array{Shape: []int{2, 3}, Data: []float64{1, 2, 3, 4, 5, 6.5}, Dtype: "<f4"},
+			"b1":     &npy.Array{Shape: []int{3}, Data: []float64{0.5, -1, 2}, Dtype: "<f4"},
+			"epochs": int64(300),
+		}
+		for k, e := range expected {
+			if !reflect.DeepEqual(d[k], e) {
+				fmt.Println(proto, k, d[k])
+				t.Fail()
+			}
+		}
+		// BINGETでメモの値を参照する
+		names := d["names"].([]interface{})
+		if !reflect.DeepEqual(names, []interface{}{"a", "a"}) {
+			fmt.Println(proto, names)
+			t.Fail()
+		}
+	}
+}
+
+func TestLoadPython2Ndarray(t *testing.T) {
+	// 値のバイト列はUTF-8として正しくない
+	w := &writer{proto: 2, py2: true}
+	w.op(opProto, 2)
+	w.ndarray([]int{2}, []float32{-1.5, 0.1}).op(opStop)
+	v, err := Load(&w.Buffer)
+	expected := &npy.Array{Shape: []int{2}, Data: []float64{-1.5, float64(float32(0.1))}, Dtype: "<f4"}
+	if err != nil || !reflect.DeepEqual(v, expected) {
+		fmt.Println(v, err)
+		t.Fail()
+	}
+}
+
+func TestLoadScalars(t *testing.T) {
+	w := &writer{proto: 2}
+	w.op(opProto, 2, opMark)
+	w.op(opBinInt, 0xfe, 0xff, 0xff, 0xff) // -2
+	w.op(opLong1, 2, 0x00, 0x80)           // -32768
+	w.op(opBinFloat)
+	binary.Write(w, binary.BigEndian, math.Pi)
+	w.op(opNewTrue, opNone)
+	w.WriteString("I42\n")
+	w.op(opTuple, opStop)
+	v, err := Load(&w.Buffer)
+	expected := []interface{}{int64(-2), int64(-32768), math.Pi, true, nil, int64(42)}
+	if err != nil || !reflect.DeepEqual(v, expected) {
+		fmt.Println(v, err)
+		t.Fail()
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"callable":  append([]byte("\x80\x02cos\nsystem\n"), opShortBinUnicode, 2, 'l', 's', opTuple1, opReduce, opStop),
+		"truncated": {opProto, 2, opEmptyDict},
+		"opcode":    {opProto, 2, 0xff},
+		// 長さが負・大きすぎる・実際のデータより長い
+		"bytes8":    {opProto, 4, opBinBytes8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"unicode8":  {opProto, 4, opBinUnicode8, 0, 0, 0, 0, 0, 0, 0, 0x40},
+		"bytearray": {opProto, 5, opByteArray8, 0, 0, 0, 0, 0, 0, 0, 0x40, 'a'},
+		"binstring": {opProto, 2, opBinString, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"long4":     {opProto, 2, opLong4, 0, 0, 0, 0x10, 1, opStop},
+	}
+	for name, b := range cases {
+		if _, err := Load(bytes.NewReader(b)); err == nil {
+			fmt.Println(name)
+			t.Fail()
+		}
+	}
+}
@@ -231,20 +231,19 @@ func StepFunction(x Vector) []int {
 	return result
 }
 
+// ArgMax は、最大値の最初の位置（負の値だけでもよい）
 func ArgMax(x Vector) int {
-	max := math.SmallestNonzeroFloat64
 	maxIndex := 0
 	for i, v := range x {
-		if max != math.Max(max, v) {
+		if v > x[maxIndex] {
 			maxIndex = i
-			max = math.Max(max, v)
 		}
 	}
 	return maxIndex
 }
 
 func Max(x Vector) float64 {
-	max := math.SmallestNonzeroFloat64
+	max := math.Inf(-1)
 	for _, v := range x {
 		max = math.Max(max, v)
 	}
@@ -41,6 +41,11 @@ func TestVectorMax(t *testing.T) {
 	if result != 10 {
 		t.Fail()
 	}
+	negative := Vector{-3, -1, -2}
+	if Max(negative) != -1 || ArgMax(negative) != 1 {
+		log.Println(Max(negative), ArgMax(negative))
+		t.Fail()
+	}
 }
 
 func TestVectorDivide(t *testing.T) {